@@ -0,0 +1,197 @@
+/*
+Package binfmt defines the binary container used for everything this
+repository writes to disk in binary form, so that every file starts the
+same way and files written by older versions of the tools stay loadable.
+
+A container is
+
+	magic       4 bytes, "GCBF"
+	version     uint16, big endian: the container layout version
+	kind        uvarint length + bytes: what the payload is, e.g. "sexpr"
+	kindVersion uint16, big endian: version of the payload encoding
+	length      uvarint: payload length in bytes
+	payload     length bytes
+	checksum    uint32, big endian: CRC-32 (IEEE) of the payload
+
+Readers accept every container version up to Version.  Packages storing
+payloads pick a kind string and own its kindVersion: when a payload
+encoding changes they bump it and keep decoding the old versions.
+*/
+package binfmt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Magic starts every container.
+const Magic = "GCBF"
+
+// Version is the container layout version written by this package.
+const Version uint16 = 1
+
+// MaxPayload bounds the payload size Read accepts, as a guard against
+// corrupt length fields.  Read never allocates more than it has
+// actually read, so a short file claiming a huge payload fails cheaply.
+const MaxPayload = 1 << 30
+
+// the longest kind name Read accepts
+const maxKind = 1 << 8
+
+var (
+	ErrBadMagic    = errors.New("binfmt: not a container (bad magic)")
+	ErrVersion     = errors.New("binfmt: unsupported container version")
+	ErrChecksum    = errors.New("binfmt: payload checksum mismatch")
+	ErrKind        = errors.New("binfmt: unexpected payload kind")
+	ErrKindVersion = errors.New("binfmt: unsupported payload version")
+)
+
+// Header describes a container's payload.
+type Header struct {
+	Version     uint16 // container version the file was written with
+	Kind        string
+	KindVersion uint16
+}
+
+// Write writes payload to w in a container of the given kind and
+// payload version.
+func Write(w io.Writer, kind string, kindVersion uint16, payload []byte) error {
+	var buf []byte
+	buf = append(buf, Magic...)
+	buf = binary.BigEndian.AppendUint16(buf, Version)
+	buf = binary.AppendUvarint(buf, uint64(len(kind)))
+	buf = append(buf, kind...)
+	buf = binary.BigEndian.AppendUint16(buf, kindVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(payload)))
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, crc32.ChecksumIEEE(payload))
+}
+
+// Read reads one container from r, checking the magic, version and
+// checksum, and returns its header and payload.  r is read exactly up
+// to the end of the container, so several containers can be stored
+// back to back.
+func Read(r io.Reader) (Header, []byte, error) {
+	var h Header
+	br := byteReader(r)
+
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return h, nil, err
+	}
+	if string(magic) != Magic {
+		return h, nil, ErrBadMagic
+	}
+	if err := binary.Read(br, binary.BigEndian, &h.Version); err != nil {
+		return h, nil, unexpected(err)
+	}
+	if h.Version == 0 || h.Version > Version {
+		return h, nil, fmt.Errorf("%w %d (this reader supports up to %d)", ErrVersion, h.Version, Version)
+	}
+
+	// version 1 layout; later versions branch here
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return h, nil, unexpected(err)
+	}
+	if n > maxKind {
+		return h, nil, fmt.Errorf("binfmt: kind name too long (%d bytes)", n)
+	}
+	kind, err := readN(br, n)
+	if err != nil {
+		return h, nil, err
+	}
+	h.Kind = string(kind)
+	if err := binary.Read(br, binary.BigEndian, &h.KindVersion); err != nil {
+		return h, nil, unexpected(err)
+	}
+	n, err = binary.ReadUvarint(br)
+	if err != nil {
+		return h, nil, unexpected(err)
+	}
+	if n > MaxPayload {
+		return h, nil, fmt.Errorf("binfmt: payload too large (%d bytes)", n)
+	}
+	payload, err := readN(br, n)
+	if err != nil {
+		return h, nil, err
+	}
+	var sum uint32
+	if err := binary.Read(br, binary.BigEndian, &sum); err != nil {
+		return h, nil, unexpected(err)
+	}
+	if sum != crc32.ChecksumIEEE(payload) {
+		return h, nil, ErrChecksum
+	}
+	return h, payload, nil
+}
+
+// ReadKind is Read, but also checks that the payload is of the expected
+// kind and that its version is at most maxVersion.
+func ReadKind(r io.Reader, kind string, maxVersion uint16) (Header, []byte, error) {
+	h, payload, err := Read(r)
+	if err != nil {
+		return h, nil, err
+	}
+	if h.Kind != kind {
+		return h, nil, fmt.Errorf("%w: got %q, want %q", ErrKind, h.Kind, kind)
+	}
+	if h.KindVersion == 0 || h.KindVersion > maxVersion {
+		return h, nil, fmt.Errorf("%w: %s version %d (this reader supports up to %d)",
+			ErrKindVersion, kind, h.KindVersion, maxVersion)
+	}
+	return h, payload, nil
+}
+
+// the next n bytes of r.  the length comes from the file, so the buffer
+// grows with what is actually there rather than being allocated up front.
+func readN(r io.Reader, n uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		return nil, unexpected(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// a truncated container is an unexpected EOF, not a clean one
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readers that can hand out single bytes, as ReadUvarint needs, without
+// reading past the container the way a bufio.Reader would
+type reader interface {
+	io.Reader
+	io.ByteReader
+}
+
+func byteReader(r io.Reader) reader {
+	if br, ok := r.(reader); ok {
+		return br
+	}
+	return &oneByteReader{r: r}
+}
+
+type oneByteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (o *oneByteReader) Read(p []byte) (int, error) { return o.r.Read(p) }
+
+func (o *oneByteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(o.r, o.buf[:])
+	return o.buf[0], err
+}
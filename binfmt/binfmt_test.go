@@ -0,0 +1,92 @@
+package binfmt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for _, p := range []string{"", "hello", "world"} {
+		if err := Write(&buf, "test", 2, []byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// no ReadByte, so Read must not read past each container
+	r := io.MultiReader(&buf)
+	for _, want := range []string{"", "hello", "world"} {
+		h, p, err := ReadKind(r, "test", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Version != Version || h.KindVersion != 2 || string(p) != want {
+			t.Errorf("got %+v %q, want %q", h, p, want)
+		}
+	}
+	if _, _, err := Read(r); err != io.EOF {
+		t.Errorf("at the end got %v, want EOF", err)
+	}
+}
+
+// a header with the given kind and payload lengths and nothing after it
+func header(kind, payload uint64) []byte {
+	b := []byte(Magic)
+	b = binary.BigEndian.AppendUint16(b, Version)
+	b = binary.AppendUvarint(b, kind)
+	b = append(b, bytes.Repeat([]byte("k"), int(min(kind, 4)))...)
+	if kind > 4 {
+		return b
+	}
+	b = binary.BigEndian.AppendUint16(b, 1)
+	return binary.AppendUvarint(b, payload)
+}
+
+func TestReadCorrupt(t *testing.T) {
+	var good bytes.Buffer
+	Write(&good, "test", 1, []byte("payload"))
+	bad := bytes.Clone(good.Bytes())
+	bad[len(bad)-1] ^= 1
+	tests := []struct {
+		name string
+		in   []byte
+		want error
+	}{
+		{"magic", []byte("GCBX\x00\x01"), ErrBadMagic},
+		{"version", []byte("GCBF\x00\x09"), ErrVersion},
+		{"checksum", bad, ErrChecksum},
+		{"truncated", good.Bytes()[:good.Len()-6], io.ErrUnexpectedEOF},
+		{"kind truncated", header(4, 0)[:9], io.ErrUnexpectedEOF},
+		// lengths that would have Read allocate gigabytes for a file of
+		// a few bytes
+		{"huge payload", header(4, MaxPayload), io.ErrUnexpectedEOF},
+		{"huge kind", header(maxKind, 0), io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		_, _, err := Read(bytes.NewReader(tt.in))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	for _, in := range [][]byte{header(4, MaxPayload+1), header(maxKind+1, 0)} {
+		if _, _, err := Read(bytes.NewReader(in)); err == nil || errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%q: got %v, want a too-large error", in, err)
+		}
+	}
+}
+
+// a short file claiming a huge payload costs what the file holds, not
+// what it claims
+func TestReadAllocation(t *testing.T) {
+	in := header(4, MaxPayload)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	Read(bytes.NewReader(in))
+	runtime.ReadMemStats(&after)
+	if d := after.TotalAlloc - before.TotalAlloc; d > 1<<20 {
+		t.Errorf("Read of a %d byte file allocated %d bytes", len(in), d)
+	}
+}
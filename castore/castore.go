@@ -0,0 +1,257 @@
+/*
+Package castore is a content-addressed store for s-expressions.  every
+element is stored once under its content hash (see sexpr.Hash), with
+lists stored as the hashes of their elements, so a subtree that occurs
+a thousand times in a corpus takes up the space of one.  documents are
+put in and get a hash back; the hash is all it takes to rebuild them.
+
+the store sits on a Blobs, a plain hash-to-bytes map: MemBlobs keeps
+everything in memory and DirBlobs in a directory tree on disk.  other
+backends (a key-value database, an object store) only need to
+implement the three methods of Blobs.
+*/
+package castore
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+// Blobs holds byte strings by hash.  a Put of a hash that is already
+// present may be ignored: the bytes are the same.
+type Blobs interface {
+	Has(h sexpr.Hash) (bool, error)
+	Get(h sexpr.Hash) ([]byte, error)
+	Put(h sexpr.Hash, data []byte) error
+}
+
+// ErrNotFound is returned (possibly wrapped) for hashes not in a store.
+var ErrNotFound = errors.New("castore: not found")
+
+// ErrCorrupt is returned when stored bytes don't rebuild the element
+// their hash names.
+var ErrCorrupt = errors.New("castore: corrupt blob")
+
+// MemBlobs is a Blobs in memory, safe for concurrent use.
+type MemBlobs struct {
+	mu sync.RWMutex
+	m  map[sexpr.Hash][]byte
+}
+
+// NewMemBlobs returns an empty MemBlobs.
+func NewMemBlobs() *MemBlobs {
+	return &MemBlobs{m: make(map[sexpr.Hash][]byte)}
+}
+
+func (b *MemBlobs) Has(h sexpr.Hash) (bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	_, ok := b.m[h]
+	return ok, nil
+}
+
+func (b *MemBlobs) Get(h sexpr.Hash) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	data, ok := b.m[h]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+func (b *MemBlobs) Put(h sexpr.Hash, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.m[h]; !ok {
+		b.m[h] = append([]byte(nil), data...)
+	}
+	return nil
+}
+
+// blob layout: a tag byte, then the atom's text or the element hashes
+// of a list.  a document (a sequence of forms) is stored like a list of
+// them under its own tag, so it can't be mistaken for one.  a dotted
+// list has a tag of its own too, with its tail's hash last.
+const (
+	tagAtom byte = iota
+	tagList
+	tagDoc
+	tagDotted
+)
+
+// the first byte hashed for a document, past the kind bytes sexpr.Hash
+// uses for elements
+const docKind byte = 0xff
+
+// Stats counts what a Store has been asked to do.
+type Stats struct {
+	Nodes   int64 // nodes put, counting repeats
+	Written int64 // nodes that weren't already stored
+	Bytes   int64 // blob bytes written
+}
+
+// Store puts and gets s-expressions in a Blobs.  it is safe for
+// concurrent use if the Blobs is, but note that Put hashes the trees
+// given to it (see sexpr.Hash).
+type Store struct {
+	blobs                 Blobs
+	nodes, written, bytes atomic.Int64
+}
+
+// New returns a Store keeping its blobs in b.
+func New(b Blobs) *Store {
+	return &Store{blobs: b}
+}
+
+// Stats returns the counts so far.
+func (st *Store) Stats() Stats {
+	return Stats{Nodes: st.nodes.Load(), Written: st.written.Load(), Bytes: st.bytes.Load()}
+}
+
+// Put stores the element s (not the elements following it) and
+// everything under it, returning its hash.  subtrees already in the
+// store are not visited.
+func (st *Store) Put(s *sexpr.Sexpr) (sexpr.Hash, error) {
+	h := s.Hash()
+	st.nodes.Add(1)
+	if ok, err := st.blobs.Has(h); err != nil || ok {
+		return h, err
+	}
+	var data []byte
+	if s.IsAtom() {
+		data = append([]byte{tagAtom}, s.Value()...)
+	} else {
+		data = []byte{tagList}
+		kids := s.Children()
+		if t := s.Tail(); t != nil {
+			data[0] = tagDotted
+			kids = append(kids, t)
+		}
+		for _, c := range kids {
+			ch, err := st.Put(c)
+			if err != nil {
+				return h, err
+			}
+			data = append(data, ch[:]...)
+		}
+	}
+	return h, st.write(h, data)
+}
+
+func (st *Store) write(h sexpr.Hash, data []byte) error {
+	if err := st.blobs.Put(h, data); err != nil {
+		return err
+	}
+	st.written.Add(1)
+	st.bytes.Add(int64(len(data)))
+	return nil
+}
+
+// PutDocument stores s and the forms following it, as returned by
+// sexpr.Parse, and returns a hash naming the whole sequence.
+func (st *Store) PutDocument(s *sexpr.Sexpr) (sexpr.Hash, error) {
+	var forms []*sexpr.Sexpr
+	for cur := s; cur != nil; cur = cur.Next() {
+		forms = append(forms, cur)
+	}
+	data := []byte{tagDoc}
+	for _, f := range forms {
+		h, err := st.Put(f)
+		if err != nil {
+			return sexpr.Hash{}, err
+		}
+		data = append(data, h[:]...)
+	}
+	h := docHash(data)
+	if ok, err := st.blobs.Has(h); err != nil || ok {
+		return h, err
+	}
+	return h, st.write(h, data)
+}
+
+// Get rebuilds the element stored under h.
+func (st *Store) Get(h sexpr.Hash) (*sexpr.Sexpr, error) {
+	s, err := st.get(h)
+	if err != nil {
+		return nil, err
+	}
+	if s.Hash() != h {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupt, h)
+	}
+	return s, nil
+}
+
+// GetDocument rebuilds a document stored with PutDocument, returning its
+// first form.
+func (st *Store) GetDocument(h sexpr.Hash) (*sexpr.Sexpr, error) {
+	data, err := st.blobs.Get(h)
+	if err != nil {
+		return nil, fmt.Errorf("document %s: %w", h, err)
+	}
+	if len(data) == 0 || data[0] != tagDoc || (len(data)-1)%len(h) != 0 || docHash(data) != h {
+		return nil, fmt.Errorf("%w: %s is not a document", ErrCorrupt, h)
+	}
+	var forms []*sexpr.Sexpr
+	for rest := data[1:]; len(rest) > 0; rest = rest[len(h):] {
+		f, err := st.Get(sexpr.Hash(rest[:len(h)]))
+		if err != nil {
+			return nil, err
+		}
+		forms = append(forms, f)
+	}
+	return sexpr.NewForms(forms...), nil
+}
+
+// the name of a document with blob data.  forms have Merkle hashes, so
+// it can be the hash of the blob, but not quite as it is: the tag is
+// where sexpr.Hash puts its kind byte, and tagDoc is the byte of a
+// dotted list, which would give a document of forms a and b the hash of
+// (a . b).  the document's hash starts with a byte no element's does.
+func docHash(data []byte) sexpr.Hash {
+	d := sha256.New()
+	d.Write([]byte{docKind})
+	d.Write(data[1:])
+	var h sexpr.Hash
+	d.Sum(h[:0])
+	return h
+}
+
+func (st *Store) get(h sexpr.Hash) (*sexpr.Sexpr, error) {
+	data, err := st.blobs.Get(h)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", h, err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: %s is empty", ErrCorrupt, h)
+	}
+	switch data[0] {
+	case tagAtom:
+		return sexpr.NewAtom(string(data[1:])), nil
+	case tagList, tagDotted:
+		if (len(data)-1)%len(h) != 0 {
+			break
+		}
+		var kids []*sexpr.Sexpr
+		for rest := data[1:]; len(rest) > 0; rest = rest[len(h):] {
+			k, err := st.get(sexpr.Hash(rest[:len(h)]))
+			if err != nil {
+				return nil, err
+			}
+			kids = append(kids, k)
+		}
+		if data[0] == tagDotted {
+			if len(kids) < 2 {
+				break
+			}
+			return sexpr.NewDotted(kids[:len(kids)-1], kids[len(kids)-1]), nil
+		}
+		return sexpr.NewList(kids...), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrCorrupt, h)
+}
@@ -0,0 +1,163 @@
+package castore
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+	"testing/quick"
+
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+func parse(t *testing.T, src string) *sexpr.Sexpr {
+	t.Helper()
+	forms, err := sexpr.ParseAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sexpr.NewForms(forms...)
+}
+
+func dirBlobs(t *testing.T) Blobs {
+	b, err := NewDirBlobs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// whatever is put comes back, from memory and from disk
+func TestRoundTrip(t *testing.T) {
+	for name, b := range map[string]Blobs{"mem": NewMemBlobs(), "dir": dirBlobs(t)} {
+		st := New(b)
+		cfg := &quick.Config{MaxCount: 300, Rand: rand.New(rand.NewSource(1))}
+		prop := func(s *sexpr.Sexpr) bool {
+			h, err := st.Put(s)
+			if err != nil {
+				t.Logf("%s: Put(%s): %v", name, s.Text(), err)
+				return false
+			}
+			back, err := st.Get(h)
+			if err != nil || !sexpr.Equal(back, s) {
+				t.Logf("%s: %s came back as %v, %v", name, s.Text(), back, err)
+				return false
+			}
+			d, err := st.PutDocument(s)
+			if err != nil {
+				return false
+			}
+			doc, err := st.GetDocument(d)
+			if err != nil || !sexpr.EqualForms(doc, s) {
+				t.Logf("%s: document %s came back as %v, %v", name, s.Text(), doc, err)
+				return false
+			}
+			return true
+		}
+		if err := quick.Check(prop, cfg); err != nil {
+			t.Error(name, err)
+		}
+	}
+}
+
+func TestSharing(t *testing.T) {
+	st := New(NewMemBlobs())
+	s := parse(t, `(a (b "c") (b "c") . (b "c"))`)
+	h, err := st.Put(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the list, a, (b "c") and its two atoms are written once; the two
+	// repeats of (b "c") are only looked up
+	if got, want := st.Stats(), (Stats{Nodes: 7, Written: 5}); got.Nodes != want.Nodes || got.Written != want.Written {
+		t.Errorf("Stats() = %+v, want %d nodes and %d written", got, want.Nodes, want.Written)
+	}
+	before := st.Stats()
+	if h2, err := st.Put(parse(t, `(a (b "c") (b "c") . (b "c"))`)); err != nil || h2 != h {
+		t.Errorf("putting the same tree again gave %s, %v, want %s", h2, err, h)
+	}
+	if after := st.Stats(); after.Written != before.Written || after.Bytes != before.Bytes {
+		t.Errorf("putting the same tree again wrote %+v, after %+v", after, before)
+	}
+
+	// a document is named apart from a list of the same forms
+	forms := parse(t, `a (b "c")`)
+	d, err := st.PutDocument(forms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := st.Put(sexpr.NewList(parse(t, `a (b "c")`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d == l {
+		t.Errorf("document and list share the hash %s", d)
+	}
+	if _, err := st.GetDocument(l); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("GetDocument of a list = %v, want ErrCorrupt", err)
+	}
+
+	// and from a dotted list of them
+	dotted := parse(t, `(a . (b "c"))`)
+	p, err := st.Put(dotted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p == d {
+		t.Errorf("document and dotted list share the hash %s", d)
+	}
+	if back, err := st.Get(p); err != nil || !sexpr.Equal(back, dotted) {
+		t.Errorf("%s came back as %v, %v", dotted.Text(), back, err)
+	}
+	if doc, err := st.GetDocument(d); err != nil || !sexpr.EqualForms(doc, forms) {
+		t.Errorf("document %s came back as %v, %v", forms.Text(), doc, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for name, b := range map[string]Blobs{"mem": NewMemBlobs(), "dir": dirBlobs(t)} {
+		st := New(b)
+		missing := parse(t, `(not stored)`).Hash()
+		if _, err := st.Get(missing); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: Get of a missing hash = %v, want ErrNotFound", name, err)
+		}
+		if _, err := st.GetDocument(missing); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: GetDocument of a missing hash = %v, want ErrNotFound", name, err)
+		}
+
+		// a list whose element went missing
+		x, err := st.Put(parse(t, `x`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		list := sexpr.Hash{0xdd}
+		if err := b.Put(list, append(append([]byte{tagList}, x[:]...), missing[:]...)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := st.Get(list); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: Get of a list with a missing element = %v, want ErrNotFound", name, err)
+		}
+
+		// a list in place of another one
+		other, err := st.Put(parse(t, `(y)`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, bad := range [][]byte{
+			nil,
+			{tagList, 1, 2, 3},
+			{tagDotted},
+			{9},
+			append([]byte{tagAtom}, "other"...),
+			append([]byte{tagList}, other[:]...),
+		} {
+			h := sexpr.Hash{byte(len(bad)), 0xee}
+			if err := b.Put(h, bad); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := st.Get(h); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("%s: Get of %v = %v, want ErrCorrupt", name, bad, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package castore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+// DirBlobs is a Blobs keeping each blob in a file of its own under a
+// directory, named by its hash and fanned out over 256 subdirectories
+// by the first byte, as git does with loose objects.  blobs are written
+// to a temporary file and renamed into place, so readers (including
+// other processes) never see half of one.
+type DirBlobs struct {
+	dir string
+}
+
+// NewDirBlobs returns a DirBlobs rooted at dir, creating it if needed.
+func NewDirBlobs(dir string) (*DirBlobs, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DirBlobs{dir: dir}, nil
+}
+
+func (b *DirBlobs) path(h sexpr.Hash) string {
+	s := h.String()
+	return filepath.Join(b.dir, s[:2], s[2:])
+}
+
+func (b *DirBlobs) Has(h sexpr.Hash) (bool, error) {
+	_, err := os.Stat(b.path(h))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *DirBlobs) Get(h sexpr.Hash) ([]byte, error) {
+	data, err := os.ReadFile(b.path(h))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (b *DirBlobs) Put(h sexpr.Hash, data []byte) error {
+	p := b.path(h)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), "tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("castore: writing %s: %w", h, err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Command libsexpr is built as a C shared library exporting the sexpr
+// parser to non-Go programs:
+//
+//	go build -buildmode=c-shared -o libsexpr.so ./cmd/libsexpr
+//
+// The C interface is described in sexpr.h, which is kept stable
+// independently of the header cgo generates.
+package main
+
+/*
+#include <stdlib.h>
+#define SEXPR_TYPES_ONLY
+#include "sexpr.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"runtime/cgo"
+	"strings"
+	"unsafe"
+
+	"github.com/mjsottile/gocode/diag"
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+// api version reported to C; bump along with SEXPR_API_VERSION
+const apiVersion = 1
+
+//export sexpr_api_version
+func sexpr_api_version() C.int {
+	return apiVersion
+}
+
+//export sexpr_parse
+func sexpr_parse(text *C.char, n C.size_t, cerr *C.sexpr_error) C.sexpr_handle {
+	input := C.GoStringN(text, C.int(n))
+	forms, err := sexpr.ParseAll(input)
+	s := sexpr.NewForms(forms...)
+	if err != nil {
+		if cerr != nil {
+			cerr.message = C.CString(err.Error())
+			cerr.line, cerr.column, cerr.offset = 0, 0, 0
+			var se *diag.SourceError
+			if errors.As(err, &se) {
+				cerr.line = C.int(se.Pos.Line)
+				cerr.column = C.int(se.Pos.Column)
+				cerr.offset = C.int(se.Pos.Offset)
+			}
+		}
+		return 0
+	}
+	return C.sexpr_handle(cgo.NewHandle(s))
+}
+
+//export sexpr_format
+func sexpr_format(h C.sexpr_handle) *C.char {
+	s := cgo.Handle(h).Value().(*sexpr.Sexpr)
+	var b strings.Builder
+	for cur := s; cur != nil; cur = cur.Next() {
+		if cur != s {
+			b.WriteByte(' ')
+		}
+		cur.WriteTo(&b)
+	}
+	return C.CString(b.String())
+}
+
+//export sexpr_to_json
+func sexpr_to_json(h C.sexpr_handle) *C.char {
+	s := cgo.Handle(h).Value().(*sexpr.Sexpr)
+	b, err := sexpr.FormsJSON(s)
+	if err != nil {
+		return nil
+	}
+	return C.CString(string(b))
+}
+
+//export sexpr_free
+func sexpr_free(h C.sexpr_handle) {
+	if h != 0 {
+		cgo.Handle(h).Delete()
+	}
+}
+
+//export sexpr_free_string
+func sexpr_free_string(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
+
+// required for package main, unused in c-shared mode
+func main() {}
@@ -0,0 +1,71 @@
+/*
+ * sexpr.h - C interface to the Go sexpr parser.
+ *
+ * Build the shared library with
+ *
+ *     go build -buildmode=c-shared -o libsexpr.so ./cmd/libsexpr
+ *
+ * and include this header (not the one go build generates, whose
+ * contents vary between Go releases).
+ *
+ * A successful sexpr_parse returns a non-zero handle to the parsed
+ * forms, which stays valid until it is passed to sexpr_free.  Strings
+ * returned by the library are allocated with malloc and must be
+ * released with sexpr_free_string.
+ */
+#ifndef GOCODE_SEXPR_H
+#define GOCODE_SEXPR_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+#define SEXPR_API_VERSION 1
+
+typedef uintptr_t sexpr_handle;
+
+/* filled in by sexpr_parse on failure.  line and column are 1-based and
+ * zero when unknown; offset is a byte offset into the input. */
+typedef struct sexpr_error {
+	char *message;
+	int line;
+	int column;
+	int offset;
+} sexpr_error;
+
+/* the Go side includes this header for the types only; cgo generates
+ * its own (non-const) prototypes for the exported functions */
+#ifndef SEXPR_TYPES_ONLY
+
+/* API version of the loaded library, for checking against
+ * SEXPR_API_VERSION at run time. */
+int sexpr_api_version(void);
+
+/* parse len bytes of text.  returns 0 on failure, in which case *err (if
+ * err is not NULL) describes the problem and err->message must be freed
+ * with sexpr_free_string. */
+sexpr_handle sexpr_parse(const char *text, size_t len, sexpr_error *err);
+
+/* unparse the forms behind h back into text. */
+char *sexpr_format(sexpr_handle h);
+
+/* the forms behind h as a JSON array, one entry per top-level form,
+ * with lists as arrays and atoms as strings. */
+char *sexpr_to_json(sexpr_handle h);
+
+/* release a handle returned by sexpr_parse.  0 is ignored. */
+void sexpr_free(sexpr_handle h);
+
+/* release a string returned by the library.  NULL is ignored. */
+void sexpr_free_string(char *s);
+
+#endif /* SEXPR_TYPES_ONLY */
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif /* GOCODE_SEXPR_H */
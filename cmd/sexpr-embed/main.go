@@ -0,0 +1,155 @@
+// Command sexpr-embed turns .sexpr resource files into Go source, so a
+// program can carry static s-expression data without parsing it at run
+// time, and a syntax error in the data breaks the build rather than the
+// program.  It is meant to be run by go generate:
+//
+//	//go:generate sexpr-embed -o rules_sexpr.go rules.sexpr defaults.sexpr
+//
+// For each file it declares a package-level variable named after the
+// file (rules.sexpr becomes rules, my-defaults.sexpr myDefaults; -export
+// capitalizes them) holding the file's top-level forms, built directly
+// with sexpr.NewAtom, sexpr.NewList and sexpr.NewForms.  With -canonical
+// it declares string constants holding the canonical text instead, for
+// programs that want the bytes (to hash or send somewhere) and just the
+// check.
+//
+// The package name comes from -pkg, or from $GOPACKAGE when run by go
+// generate.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mjsottile/gocode/diag"
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+var (
+	pkg       = flag.String("pkg", os.Getenv("GOPACKAGE"), "package name of the generated file")
+	output    = flag.String("o", "", "output file (default: first input with _sexpr.go in place of .sexpr)")
+	export    = flag.Bool("export", false, "export the generated names")
+	canonical = flag.Bool("canonical", false, "embed canonical text instead of constructed trees")
+)
+
+// the Go identifier for a file name
+func identFor(file string) string {
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	var b strings.Builder
+	upper := *export
+	for _, r := range base {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = b.Len() > 0 || *export
+			continue
+		}
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			b.WriteByte('x')
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+		} else if b.Len() == 0 {
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+		upper = false
+	}
+	name := b.String()
+	if name == "" || token.Lookup(name).IsKeyword() {
+		name += "Sexpr"
+	}
+	return name
+}
+
+// write the Go expression constructing s
+func writeTree(b *bytes.Buffer, s *sexpr.Sexpr) {
+	if s.IsAtom() {
+		fmt.Fprintf(b, "sexpr.NewAtom(%s)", strconv.Quote(s.Value()))
+		return
+	}
+	kids := s.Children()
+	if len(kids) == 0 {
+		b.WriteString("sexpr.NewList()")
+		return
+	}
+	b.WriteString("sexpr.NewList(\n")
+	for _, c := range kids {
+		writeTree(b, c)
+		b.WriteString(",\n")
+	}
+	b.WriteString(")")
+}
+
+func generate(files []string) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by sexpr-embed from %s; DO NOT EDIT.\n\n", strings.Join(files, ", "))
+	fmt.Fprintf(&b, "package %s\n\n", *pkg)
+	if !*canonical {
+		b.WriteString("import \"github.com/mjsottile/gocode/sexpr\"\n\n")
+	}
+	seen := make(map[string]string)
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		forms, err := sexpr.ParseAll(string(src))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file, diag.Describe(err, string(src)))
+		}
+		s := sexpr.NewForms(forms...)
+		name := identFor(file)
+		if prev, ok := seen[name]; ok {
+			return nil, fmt.Errorf("%s and %s would both be named %s", prev, file, name)
+		}
+		seen[name] = file
+
+		if *canonical {
+			fmt.Fprintf(&b, "// %s is the canonical text of %s.\n", name, filepath.Base(file))
+			fmt.Fprintf(&b, "const %s = %s\n\n", name, strconv.Quote(string(sexpr.EncodeCanonical(s))))
+			continue
+		}
+		fmt.Fprintf(&b, "// %s holds the top-level forms of %s.\n", name, filepath.Base(file))
+		fmt.Fprintf(&b, "var %s = sexpr.NewForms(\n", name)
+		for f := s; f != nil; f = f.Next() {
+			writeTree(&b, f)
+			b.WriteString(",\n")
+		}
+		b.WriteString(")\n\n")
+	}
+	return format.Source(b.Bytes())
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: sexpr-embed [-pkg name] [-o file] [-export] [-canonical] file.sexpr...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 || *pkg == "" {
+		if *pkg == "" {
+			fmt.Fprintln(os.Stderr, "sexpr-embed: no package name; use -pkg or run from go generate")
+		}
+		flag.Usage()
+		os.Exit(2)
+	}
+	out := *output
+	if out == "" {
+		out = strings.TrimSuffix(flag.Arg(0), filepath.Ext(flag.Arg(0))) + "_sexpr.go"
+	}
+	src, err := generate(flag.Args())
+	if err == nil {
+		err = os.WriteFile(out, src, 0644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "sexpr-embed:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,343 @@
+// Command sexpr-lsp is a Language Server Protocol server for generic
+// s-expression files, speaking JSON-RPC over stdin and stdout.  It
+// provides
+//
+//   - diagnostics for anything the sexpr parser rejects
+//   - whole-document formatting
+//   - folding ranges for lists spanning several lines
+//   - go-to-matching-paren, through textDocument/definition on a paren
+//     and through the custom sexpr/matchingParen request, which takes the
+//     same parameters and returns the position of the matching paren
+//
+// Documents are synchronized incrementally; each change is applied with
+// sexpr.Reparse so only the edited region of a large file is parsed
+// again.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mjsottile/gocode/diag"
+	"github.com/mjsottile/gocode/internal/sexprutil"
+	"github.com/mjsottile/gocode/sexpr"
+	"github.com/mjsottile/gocode/tree"
+)
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     position               `json:"position"`
+}
+
+type location struct {
+	URI   string    `json:"uri"`
+	Range textRange `json:"range"`
+}
+
+type diagnostic struct {
+	Range    textRange `json:"range"`
+	Severity int       `json:"severity"`
+	Source   string    `json:"source"`
+	Message  string    `json:"message"`
+}
+
+type foldingRange struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+type textEdit struct {
+	Range   textRange `json:"range"`
+	NewText string    `json:"newText"`
+}
+
+// an open document along with its most recent parse
+type document struct {
+	text  string
+	forms *sexpr.Sexpr
+	err   error
+}
+
+func newDocument(text string) *document {
+	forms, err := sexpr.ParseAll(text)
+	return &document{text: text, forms: sexpr.NewForms(forms...), err: err}
+}
+
+// apply an edit, reusing the previous parse when there is one
+func (d *document) apply(e sexpr.Edit) *document {
+	if d.err != nil {
+		return newDocument(e.Apply(d.text))
+	}
+	s, text, err := sexpr.Reparse(d.forms, d.text, e)
+	return &document{text: text, forms: s, err: err}
+}
+
+type server struct {
+	c        *conn
+	docs     map[string]*document
+	shutdown bool
+}
+
+func (s *server) publishDiagnostics(uri string) error {
+	diags := []diagnostic{}
+	if d, ok := s.docs[uri]; ok && d.err != nil {
+		var se *diag.SourceError
+		msg, off := d.err.Error(), len(d.text)
+		if errors.As(d.err, &se) {
+			msg, off = se.Msg, se.Pos.Offset
+			if msg == "" && se.Err != nil {
+				msg = se.Err.Error()
+			}
+		}
+		p := offsetToPosition(d.text, off)
+		end := p
+		if off < len(d.text) {
+			end = offsetToPosition(d.text, off+1)
+		}
+		diags = append(diags, diagnostic{
+			Range:    textRange{p, end},
+			Severity: 1,
+			Source:   "sexpr",
+			Message:  msg,
+		})
+	}
+	return s.c.notify("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri":         uri,
+		"diagnostics": diags,
+	})
+}
+
+// every list in the document, outermost first
+func (d *document) lists() []*sexpr.Sexpr {
+	var out []*sexpr.Sexpr
+	for f := d.forms; f != nil; f = f.Next() {
+		tree.Walk(f, func(n *sexpr.Sexpr, _ int) bool {
+			if n.IsList() {
+				out = append(out, n)
+			}
+			return true
+		})
+	}
+	return out
+}
+
+// the offset of the paren matching the one at, or just before, off
+func (d *document) matchingParen(off int) (int, bool) {
+	for _, try := range []int{off, off - 1} {
+		for _, l := range d.lists() {
+			switch try {
+			case l.Pos():
+				return l.End() - 1, true
+			case l.End() - 1:
+				return l.Pos(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (d *document) foldingRanges() []foldingRange {
+	out := []foldingRange{}
+	for _, l := range d.lists() {
+		start := offsetToPosition(d.text, l.Pos()).Line
+		end := offsetToPosition(d.text, l.End()).Line
+		if end > start {
+			out = append(out, foldingRange{StartLine: start, EndLine: end})
+		}
+	}
+	return out
+}
+
+// the formatted document, or false if it can't be formatted safely
+func (d *document) format(indent int) (string, bool) {
+	// the tree doesn't keep comments, so reformatting would drop them;
+	// leave files that have any alone
+	if d.err != nil || sexprutil.StripComments(d.text) != d.text {
+		return "", false
+	}
+	var parts []string
+	for _, f := range sexprutil.Forms(d.forms) {
+		parts = append(parts, sexpr.Format(f, sexpr.FormatOptions{Indent: indent}))
+	}
+	return strings.Join(parts, "\n\n") + "\n", true
+}
+
+func (s *server) handle(m *message) (interface{}, error) {
+	switch m.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           2,
+				"documentFormattingProvider": true,
+				"foldingRangeProvider":       true,
+				"definitionProvider":         true,
+			},
+			"serverInfo": map[string]string{"name": "sexpr-lsp"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var p struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil, err
+		}
+		s.docs[p.TextDocument.URI] = newDocument(p.TextDocument.Text)
+		return nil, s.publishDiagnostics(p.TextDocument.URI)
+	case "textDocument/didChange":
+		var p struct {
+			TextDocument   textDocumentIdentifier `json:"textDocument"`
+			ContentChanges []struct {
+				Range *textRange `json:"range"`
+				Text  string     `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil, err
+		}
+		d, err := s.doc(p.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range p.ContentChanges {
+			if c.Range == nil {
+				// a change without a range replaces the whole text
+				d = newDocument(c.Text)
+				continue
+			}
+			start := positionToOffset(d.text, c.Range.Start)
+			end := positionToOffset(d.text, c.Range.End)
+			if end < start {
+				start, end = end, start
+			}
+			d = d.apply(sexpr.Edit{Offset: start, Len: end - start, Text: c.Text})
+		}
+		s.docs[p.TextDocument.URI] = d
+		return nil, s.publishDiagnostics(p.TextDocument.URI)
+	case "textDocument/didClose":
+		var p struct {
+			TextDocument textDocumentIdentifier `json:"textDocument"`
+		}
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		return nil, s.publishDiagnostics(p.TextDocument.URI)
+	case "textDocument/formatting":
+		var p struct {
+			TextDocument textDocumentIdentifier `json:"textDocument"`
+			Options      struct {
+				TabSize int `json:"tabSize"`
+			} `json:"options"`
+		}
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil, err
+		}
+		d, err := s.doc(p.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		indent := p.Options.TabSize
+		if indent <= 0 {
+			indent = 2
+		}
+		text, ok := d.format(indent)
+		if !ok || text == d.text {
+			return []textEdit{}, nil
+		}
+		whole := textRange{position{}, offsetToPosition(d.text, len(d.text))}
+		return []textEdit{{Range: whole, NewText: text}}, nil
+	case "textDocument/foldingRange":
+		var p struct {
+			TextDocument textDocumentIdentifier `json:"textDocument"`
+		}
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil, err
+		}
+		d, err := s.doc(p.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		return d.foldingRanges(), nil
+	case "textDocument/definition", "sexpr/matchingParen":
+		var p textDocumentPositionParams
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil, err
+		}
+		d, err := s.doc(p.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		off, ok := d.matchingParen(positionToOffset(d.text, p.Position))
+		if !ok {
+			return nil, nil
+		}
+		pos := offsetToPosition(d.text, off)
+		if m.Method == "sexpr/matchingParen" {
+			return pos, nil
+		}
+		end := offsetToPosition(d.text, off+1)
+		return location{URI: p.TextDocument.URI, Range: textRange{pos, end}}, nil
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: "method not found: " + m.Method}
+}
+
+func (s *server) doc(uri string) (*document, error) {
+	d, ok := s.docs[uri]
+	if !ok {
+		return nil, fmt.Errorf("unknown document %s", uri)
+	}
+	return d, nil
+}
+
+// process messages until exit is requested or the input ends.  returns
+// the process exit status.
+func (s *server) run() int {
+	for {
+		body, err := s.c.read()
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintln(os.Stderr, "sexpr-lsp:", err)
+			}
+			return 1
+		}
+		var m message
+		if err := json.Unmarshal(body, &m); err != nil {
+			s.c.reply(nil, nil, &rpcError{Code: codeParseError, Message: err.Error()})
+			continue
+		}
+		if m.Method == "exit" {
+			if s.shutdown {
+				return 0
+			}
+			return 1
+		}
+		result, err := s.handle(&m)
+		if m.ID == nil {
+			// notifications get no reply, even on error
+			continue
+		}
+		if err := s.c.reply(m.ID, result, err); err != nil {
+			fmt.Fprintln(os.Stderr, "sexpr-lsp:", err)
+			return 1
+		}
+	}
+}
+
+func main() {
+	s := &server{c: newConn(os.Stdin, os.Stdout), docs: map[string]*document{}}
+	os.Exit(s.run())
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// LSP positions are 0-based lines and 0-based character offsets counted
+// in UTF-16 code units, while the parser works in byte offsets.  these
+// convert between the two.
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type textRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+// position of a byte offset within text
+func offsetToPosition(text string, off int) position {
+	if off > len(text) {
+		off = len(text)
+	}
+	line := strings.Count(text[:off], "\n")
+	start := strings.LastIndexByte(text[:off], '\n') + 1
+	return position{Line: line, Character: utf16Len(text[start:off])}
+}
+
+// byte offset of a position within text, clamped to the text
+func positionToOffset(text string, p position) int {
+	off := 0
+	for i := 0; i < p.Line; i++ {
+		nl := strings.IndexByte(text[off:], '\n')
+		if nl < 0 {
+			return len(text)
+		}
+		off += nl + 1
+	}
+	for units := 0; units < p.Character && off < len(text); {
+		r, w := utf8.DecodeRuneInString(text[off:])
+		if r == '\n' {
+			break
+		}
+		units += utf16RuneLen(r)
+		off += w
+	}
+	return off
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16RuneLen(r)
+	}
+	return n
+}
+
+func utf16RuneLen(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,85 @@
+// Command sexpr-schema generates Go struct types from a schema document
+// (see package schema for the syntax), for use with go generate:
+//
+//	//go:generate sexpr-schema -o config_gen.go config.schema
+//
+// Each struct in the schema becomes a Go struct with sexpr field tags
+// and a nil-safe Get method per field that applies the schema's
+// defaults.  The package name comes from -pkg, or from $GOPACKAGE when
+// run by go generate.  With -check the schema is only validated; with
+// -skeleton an example document for the -root struct (by default the
+// first one) is written instead of Go code.
+//
+// To go the other way, from Go types to a schema, see schema.FromType.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mjsottile/gocode/diag"
+	"github.com/mjsottile/gocode/schema"
+)
+
+var (
+	pkg    = flag.String("pkg", os.Getenv("GOPACKAGE"), "package name of the generated file")
+	output = flag.String("o", "", "output file (default: the schema file name with _gen.go)")
+	check  = flag.Bool("check", false, "only check the schema")
+	skel   = flag.Bool("skeleton", false, "write an example document to standard output")
+	root   = flag.String("root", "", "struct to write the -skeleton for")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: sexpr-schema [-pkg name] [-o file] [-check] [-skeleton [-root name]] schema-file")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	file := flag.Arg(0)
+	src, err := os.ReadFile(file)
+	if err != nil {
+		fail(err)
+	}
+	s, err := schema.Parse(string(src))
+	if err != nil {
+		fail(fmt.Errorf("%s: %s", file, diag.Describe(err, string(src))))
+	}
+	if *check {
+		return
+	}
+	if *skel {
+		doc := s.Skeleton(*root)
+		if doc == nil {
+			fail(fmt.Errorf("%s: no struct %q", file, *root))
+		}
+		os.Stdout.Write(doc)
+		return
+	}
+	if *pkg == "" {
+		fmt.Fprintln(os.Stderr, "sexpr-schema: no package name; use -pkg or run from go generate")
+		os.Exit(2)
+	}
+	out, err := s.GoSource(*pkg, filepath.Base(file))
+	if err != nil {
+		fail(err)
+	}
+	name := *output
+	if name == "" {
+		name = strings.TrimSuffix(file, filepath.Ext(file)) + "_gen.go"
+	}
+	if err := os.WriteFile(name, out, 0644); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "sexpr-schema:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,97 @@
+//go:build js && wasm
+
+// Command sexpr-wasm exposes the sexpr parser to JavaScript when built
+// for WebAssembly:
+//
+//	GOOS=js GOARCH=wasm go build -o sexpr.wasm ./cmd/sexpr-wasm
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" .
+//
+// Once loaded it installs a global sexprGo object with three functions,
+// each taking the source text and returning an object of the form
+// {ok: true, value: ...} or {ok: false, error: {message, line, column,
+// offset}}:
+//
+//	parse(text)   value is the forms as nested arrays of atom strings
+//	format(text)  value is the text unparsed back from the parse tree
+//	toJSON(text)  value is the forms as a JSON string
+//
+// sexpr.js wraps this in a friendlier promise-based loader.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"syscall/js"
+
+	"github.com/mjsottile/gocode/diag"
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+// wrap a function of the parsed forms into a JS callable taking the
+// source text as its only argument
+func binding(f func(s *sexpr.Sexpr) (interface{}, error)) js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) != 1 || args[0].Type() != js.TypeString {
+			return failure(errors.New("expected a single string argument"))
+		}
+		forms, err := sexpr.ParseAll(args[0].String())
+		if err != nil {
+			return failure(err)
+		}
+		v, err := f(sexpr.NewForms(forms...))
+		if err != nil {
+			return failure(err)
+		}
+		return map[string]interface{}{"ok": true, "value": v}
+	})
+}
+
+// build the JS-side error object, including a position when we have one
+func failure(err error) interface{} {
+	e := map[string]interface{}{"message": err.Error()}
+	var se *diag.SourceError
+	if errors.As(err, &se) {
+		e["line"] = se.Pos.Line
+		e["column"] = se.Pos.Column
+		e["offset"] = se.Pos.Offset
+	}
+	return map[string]interface{}{"ok": false, "error": e}
+}
+
+// unparse every form into a string, separated by spaces
+func unparseString(s *sexpr.Sexpr) string {
+	var b strings.Builder
+	for cur := s; cur != nil; cur = cur.Next() {
+		if cur != s {
+			b.WriteByte(' ')
+		}
+		cur.WriteTo(&b)
+	}
+	return b.String()
+}
+
+func main() {
+	js.Global().Set("sexprGo", map[string]interface{}{
+		"parse": binding(func(s *sexpr.Sexpr) (interface{}, error) {
+			b, err := sexpr.FormsJSON(s)
+			if err != nil {
+				return nil, err
+			}
+			// round trip through encoding/json to get values that
+			// js.ValueOf understands
+			var v interface{}
+			err = json.Unmarshal(b, &v)
+			return v, err
+		}),
+		"format": binding(func(s *sexpr.Sexpr) (interface{}, error) {
+			return unparseString(s), nil
+		}),
+		"toJSON": binding(func(s *sexpr.Sexpr) (interface{}, error) {
+			b, err := sexpr.FormsJSON(s)
+			return string(b), err
+		}),
+	})
+	// keep the Go side alive so the callbacks stay valid
+	select {}
+}
@@ -0,0 +1,45 @@
+// Thin loader for the sexpr WebAssembly module built from main.go.
+// Requires wasm_exec.js from the Go distribution to have been loaded
+// first (it defines the global Go class).
+//
+//   const sx = await loadSexpr("sexpr.wasm");
+//   sx.parse("(a (b c))");   // => [["a", ["b", "c"]]]
+//   sx.format("(a  b)");     // => "(a b)"
+//   sx.toJSON("(a b)");      // => '[["a","b"]]'
+//
+// Each function throws a SexprError (with line, column and offset when
+// known) if the input does not parse.
+
+class SexprError extends Error {
+  constructor(err) {
+    super(err.message);
+    this.name = "SexprError";
+    this.line = err.line;
+    this.column = err.column;
+    this.offset = err.offset;
+  }
+}
+
+async function loadSexpr(url) {
+  const go = new Go();
+  const result = await WebAssembly.instantiateStreaming(fetch(url), go.importObject);
+  // main never returns; it installs globalThis.sexprGo and then blocks
+  go.run(result.instance);
+  const raw = globalThis.sexprGo;
+  const unwrap = (f) => (text) => {
+    const r = f(text);
+    if (!r.ok) {
+      throw new SexprError(r.error);
+    }
+    return r.value;
+  };
+  return {
+    parse: unwrap(raw.parse),
+    format: unwrap(raw.format),
+    toJSON: unwrap(raw.toJSON),
+  };
+}
+
+if (typeof module !== "undefined") {
+  module.exports = { loadSexpr, SexprError };
+}
@@ -0,0 +1,36 @@
+// Command sexpr is a small demonstration of the sexpr package: it parses a
+// fixed test expression, writes it to a graphviz dot file and unparses it
+// back to standard output.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mjsottile/gocode/diag"
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+func main() {
+	// make a test string
+	testexpr := "(test (test2 \"i am long\" test3) blah a b c d e f)"
+
+	// lex and parse the string into an s-expression structure
+	s, err := sexpr.Parse(testexpr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, diag.Describe(err, testexpr))
+		os.Exit(1)
+	}
+
+	// given the struct, now we can...
+
+	// put it in a dot file to look at with graphviz
+	if err := sexpr.ToDotFile(s, "test.dot"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// or, unparse it back out
+	s.WriteTo(os.Stdout)
+	fmt.Println()
+}
@@ -0,0 +1,193 @@
+// Command sexprd serves the sexpr parser to other programs over a simple
+// request/response protocol on stdin and stdout, so scripts in Python, R
+// and the like can use it without linking against Go code.
+//
+// Each request is one JSON object on a line of its own; each gets back
+// exactly one JSON object on a line, in order.  Requests look like
+//
+//	{"id": 1, "op": "parse", "text": "(a (b c))"}
+//
+// The input is taken from "text", or read from the file named by "file"
+// if "text" is absent.  The id is echoed back untouched.  Supported ops:
+//
+//	parse     result is the forms as nested JSON arrays of atom strings
+//	validate  result is {"valid": bool}, plus "error" when not valid
+//	convert   result is the input rendered in the format named by "to",
+//	          any of those registered with the formats package (sexpr,
+//	          json, dot, mermaid, graphml, ...); binary formats come back
+//	          base64 encoded
+//	query     result is {"json": ..., "text": ...} for the element at
+//	          "path", a dot-separated list of 0-based indices such as
+//	          "0.2" (third element of the first form)
+//
+// Responses are {"id": ..., "ok": true, "result": ...} on success and
+// {"id": ..., "ok": false, "error": {"message": ..., "line": ...,
+// "column": ..., "offset": ...}} on failure, with the position fields
+// present only when the error has one.  The process exits when stdin is
+// closed.
+//
+// From Python, for example:
+//
+//	p = subprocess.Popen(["sexprd"], stdin=PIPE, stdout=PIPE, text=True)
+//	p.stdin.write(json.dumps({"op": "parse", "text": src}) + "\n")
+//	p.stdin.flush()
+//	reply = json.loads(p.stdout.readline())
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mjsottile/gocode/diag"
+	"github.com/mjsottile/gocode/formats"
+	"github.com/mjsottile/gocode/internal/sexprutil"
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+type request struct {
+	ID   json.RawMessage `json:"id,omitempty"`
+	Op   string          `json:"op"`
+	Text *string         `json:"text,omitempty"`
+	File string          `json:"file,omitempty"`
+	To   string          `json:"to,omitempty"`
+	Path string          `json:"path,omitempty"`
+}
+
+type response struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	OK     bool            `json:"ok"`
+	Result interface{}     `json:"result,omitempty"`
+	Error  *errorInfo      `json:"error,omitempty"`
+}
+
+type errorInfo struct {
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Offset  *int   `json:"offset,omitempty"`
+}
+
+func newErrorInfo(err error) *errorInfo {
+	e := &errorInfo{Message: err.Error()}
+	var se *diag.SourceError
+	if errors.As(err, &se) {
+		off := se.Pos.Offset
+		e.Line, e.Column, e.Offset = se.Pos.Line, se.Pos.Column, &off
+	}
+	return e
+}
+
+// the input text for a request
+func (r *request) input() (string, error) {
+	if r.Text != nil {
+		return *r.Text, nil
+	}
+	if r.File != "" {
+		b, err := os.ReadFile(r.File)
+		return string(b), err
+	}
+	return "", fmt.Errorf("request has neither text nor file")
+}
+
+func handle(r *request) (interface{}, error) {
+	text, err := r.input()
+	if err != nil {
+		return nil, err
+	}
+	forms, err := sexpr.ParseAll(text)
+	s := sexpr.NewForms(forms...)
+	if r.Op == "validate" {
+		if err != nil {
+			return map[string]interface{}{"valid": false, "error": newErrorInfo(err)}, nil
+		}
+		return map[string]interface{}{"valid": true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch r.Op {
+	case "parse":
+		b, err := sexpr.FormsJSON(s)
+		return json.RawMessage(b), err
+	case "convert":
+		return convert(s, r.To)
+	case "query":
+		path, err := sexprutil.ParsePath(r.Path)
+		if err != nil {
+			return nil, err
+		}
+		e, err := sexprutil.Select(sexprutil.Forms(s), path)
+		if err != nil {
+			return nil, err
+		}
+		b, err := e.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"json": json.RawMessage(b),
+			"text": e.Text(),
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", r.Op)
+}
+
+func convert(s *sexpr.Sexpr, to string) (interface{}, error) {
+	f, ok := formats.Lookup(to)
+	if !ok {
+		return nil, fmt.Errorf("unknown conversion target %q (have %v)", to, formats.Names())
+	}
+	var buf bytes.Buffer
+	if err := f.Write(&buf, s); err != nil {
+		return nil, err
+	}
+	if f.Binary {
+		// encoding/json base64-encodes byte slices
+		return buf.Bytes(), nil
+	}
+	return buf.String(), nil
+}
+
+// read requests until EOF, answering each one in turn
+func serve(in io.Reader, out io.Writer) error {
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 64*1024), 1<<30)
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var r request
+		var resp response
+		if err := json.Unmarshal(line, &r); err != nil {
+			resp.Error = newErrorInfo(fmt.Errorf("bad request: %v", err))
+		} else if result, err := handle(&r); err != nil {
+			resp.ID, resp.Error = r.ID, newErrorInfo(err)
+		} else {
+			resp.ID, resp.OK, resp.Result = r.ID, true, result
+		}
+		if err := enc.Encode(&resp); err != nil {
+			return err
+		}
+		// flush per response so the caller isn't left waiting
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+func main() {
+	if err := serve(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "sexprd:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,107 @@
+// Command sexprdiff compares two s-expression files structurally, so
+// that differences in layout or whitespace don't count.
+//
+//	sexprdiff [-script] [-q] old.sexpr new.sexpr
+//
+// By default it prints a readable list of changes in document order,
+// each headed by the path of the element it affects (dot-separated
+// 0-based indices, the first picking a top-level form):
+//
+//	@ 0.2.2
+//	- y
+//	+ w
+//
+// With -script it prints the machine-readable edit script from
+// sexpr.EncodeChanges instead, which sexprpatch can apply.  Either file
+// may be "-" for standard input.
+//
+// The exit status is 0 if the files are structurally equal, 1 if they
+// differ and 2 if something went wrong, as with diff(1).
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mjsottile/gocode/diag"
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+var (
+	script = flag.Bool("script", false, "print a machine-readable edit script")
+	quiet  = flag.Bool("q", false, "print nothing; only set the exit status")
+)
+
+func load(name string) (*sexpr.Sexpr, error) {
+	var b []byte
+	var err error
+	if name == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	forms, err := sexpr.ParseAll(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, diag.Describe(err, string(b)))
+	}
+	return sexpr.NewForms(forms...), nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: sexprdiff [-script] [-q] old new")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	a, err := load(flag.Arg(0))
+	if err != nil {
+		fail(err)
+	}
+	b, err := load(flag.Arg(1))
+	if err != nil {
+		fail(err)
+	}
+
+	changes := sexpr.Diff(a, b)
+	if len(changes) == 0 {
+		os.Exit(0)
+	}
+	if !*quiet {
+		w := bufio.NewWriter(os.Stdout)
+		if *script {
+			w.Write(sexpr.EncodeChanges(changes))
+		} else {
+			fmt.Fprintf(w, "--- %s\n+++ %s\n", flag.Arg(0), flag.Arg(1))
+			// the script runs back to front; people read front to back
+			for i := len(changes) - 1; i >= 0; i-- {
+				c := changes[i]
+				fmt.Fprintf(w, "@ %s\n", sexpr.PathString(c.Path))
+				if c.Old != nil {
+					fmt.Fprintf(w, "- %s", sexpr.EncodeCanonical(c.Old))
+				}
+				if c.New != nil {
+					fmt.Fprintf(w, "+ %s", sexpr.EncodeCanonical(c.New))
+				}
+			}
+		}
+		if err := w.Flush(); err != nil {
+			fail(err)
+		}
+	}
+	os.Exit(1)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "sexprdiff:", err)
+	os.Exit(2)
+}
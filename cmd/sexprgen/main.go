@@ -0,0 +1,79 @@
+// Command sexprgen writes a random s-expression document to standard
+// output, for seeding fuzzers and benchmarking the parser and tools at a
+// known scale.  The same flags and seed always produce the same document.
+//
+//	sexprgen -forms 1000 -seed 7 > corpus.sexpr
+//	sexprgen -bytes 100000000 -indent -mix 1,1,1,1 > big.sexpr
+//	sexprgen -forms 50 -invalid 0.1 -v > broken.sexpr
+//
+// -mix gives the relative weights of symbols, integers, floats and
+// strings.  With -v a summary, including where any broken forms were
+// broken, goes to standard error.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mjsottile/gocode/corpus"
+)
+
+func parseMix(s string) (corpus.AtomMix, error) {
+	var m corpus.AtomMix
+	if s == "" {
+		return m, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return m, fmt.Errorf("-mix wants four weights: symbol,integer,float,string")
+	}
+	w := make([]int, 4)
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || n < 0 {
+			return m, fmt.Errorf("bad -mix weight %q", p)
+		}
+		w[i] = n
+	}
+	return corpus.AtomMix{Symbol: w[0], Integer: w[1], Float: w[2], String: w[3]}, nil
+}
+
+func main() {
+	var cfg corpus.Config
+	flag.Int64Var(&cfg.Seed, "seed", 1, "random seed")
+	flag.IntVar(&cfg.Forms, "forms", 0, "number of top-level forms")
+	flag.IntVar(&cfg.Bytes, "bytes", 0, "generate about this many bytes (when -forms is not given)")
+	flag.IntVar(&cfg.MaxDepth, "depth", 6, "maximum nesting depth")
+	flag.IntVar(&cfg.MaxWidth, "width", 8, "maximum elements in a list")
+	flag.BoolVar(&cfg.Indent, "indent", false, "spread forms over indented lines")
+	flag.BoolVar(&cfg.Comments, "comments", false, "include ; and #| |# comments")
+	flag.Float64Var(&cfg.Invalid, "invalid", 0, "fraction of forms to break")
+	mix := flag.String("mix", "", "atom weights: symbol,integer,float,string")
+	verbose := flag.Bool("v", false, "print a summary to standard error")
+	flag.Parse()
+
+	var err error
+	if cfg.Mix, err = parseMix(*mix); err != nil {
+		fmt.Fprintln(os.Stderr, "sexprgen:", err)
+		os.Exit(2)
+	}
+	if cfg.Forms <= 0 && cfg.Bytes <= 0 {
+		cfg.Forms = 100
+	}
+
+	st, err := corpus.Generate(os.Stdout, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "sexprgen:", err)
+		os.Exit(1)
+	}
+	if *verbose {
+		fmt.Fprintf(os.Stderr, "%d forms, %d nodes (%d atoms), depth %d, %d bytes\n",
+			st.Forms, st.Nodes, st.Atoms, st.Depth, st.Bytes)
+		for _, b := range st.Broken {
+			fmt.Fprintf(os.Stderr, "form %d: %s at offset %d\n", b.Form, b.Kind, b.Offset)
+		}
+	}
+}
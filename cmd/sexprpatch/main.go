@@ -0,0 +1,137 @@
+// Command sexprpatch applies an edit script written by sexprdiff -script
+// to an s-expression file, or merges two edited copies of a file.
+//
+//	sexprpatch doc.sexpr script
+//	sexprpatch -merge base.sexpr ours.sexpr theirs.sexpr
+//
+// The result goes to standard output (or the -o file) in canonical form,
+// one top-level form per line.  A script that doesn't fit the document,
+// because the elements it deletes or replaces aren't there, is refused
+// rather than applied in part.  In -merge mode changes made on only one
+// side are combined; if the two sides change the same element in
+// different ways the conflicts are listed on standard error and nothing
+// is written.  Any file may be "-" for standard input.
+//
+// The exit status is 0 on success, 1 on a conflict and 2 on any other
+// error, so the -merge form can be used as a git merge driver:
+//
+//	sexprpatch -merge -o %A %O %A %B
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mjsottile/gocode/diag"
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+var (
+	merge  = flag.Bool("merge", false, "three-way merge: base ours theirs")
+	output = flag.String("o", "", "write the result to this file instead of standard output")
+)
+
+func read(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+func load(name string) (*sexpr.Sexpr, error) {
+	b, err := read(name)
+	if err != nil {
+		return nil, err
+	}
+	forms, err := sexpr.ParseAll(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, diag.Describe(err, string(b)))
+	}
+	return sexpr.NewForms(forms...), nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: sexprpatch [-o out] doc script")
+		fmt.Fprintln(os.Stderr, "       sexprpatch -merge [-o out] base ours theirs")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var result *sexpr.Sexpr
+	var err error
+	if *merge {
+		if flag.NArg() != 3 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		result, err = doMerge(flag.Arg(0), flag.Arg(1), flag.Arg(2))
+	} else {
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		result, err = doPatch(flag.Arg(0), flag.Arg(1))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "sexprpatch:", err)
+		if errors.Is(err, sexpr.ErrConflict) {
+			os.Exit(1)
+		}
+		os.Exit(2)
+	}
+
+	out := sexpr.EncodeCanonical(result)
+	if *output != "" {
+		err = os.WriteFile(*output, out, 0644)
+	} else {
+		_, err = os.Stdout.Write(out)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "sexprpatch:", err)
+		os.Exit(2)
+	}
+}
+
+func doPatch(docName, scriptName string) (*sexpr.Sexpr, error) {
+	doc, err := load(docName)
+	if err != nil {
+		return nil, err
+	}
+	b, err := read(scriptName)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := sexpr.ParseChanges(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", scriptName, diag.Describe(err, string(b)))
+	}
+	return sexpr.Patch(doc, cs)
+}
+
+func doMerge(baseName, oursName, theirsName string) (*sexpr.Sexpr, error) {
+	base, err := load(baseName)
+	if err != nil {
+		return nil, err
+	}
+	ours, err := load(oursName)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := load(theirsName)
+	if err != nil {
+		return nil, err
+	}
+	cs, conflicts := sexpr.Merge(base, ours, theirs)
+	for _, c := range conflicts {
+		fmt.Fprintf(os.Stderr, "conflict at %s\n  ours:   %s\n  theirs: %s\n",
+			sexpr.PathString(c.Ours.Path), c.Ours, c.Theirs)
+	}
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("%d conflicts, nothing written: %w", len(conflicts), sexpr.ErrConflict)
+	}
+	return sexpr.Patch(base, cs)
+}
@@ -0,0 +1,317 @@
+// Command sexprpipe is a stdin to stdout filter for s-expression data,
+// in the spirit of jq.  Stages are given as flags and run in the order
+// they appear on the command line:
+//
+//	-strip-comments  drop ; and #| |# comments from the raw input
+//	-normalize       re-emit each top-level form on one line with single
+//	                 spaces
+//	-select PATH     keep only the element at PATH, a dot-separated list
+//	                 of 0-based indices ("0.2" is the third element of the
+//	                 first form)
+//	-format          pretty-print with indentation (see -indent, -width,
+//	                 -head, -atoms)
+//
+// For example
+//
+//	sexprpipe -select 0.1 -format < config.sexpr
+//
+// The input is read a form at a time and each form is run through the
+// stages and written out before the next is read, so sexprpipe works on
+// streams of any length in the memory of their largest form.  The
+// parser skips comments, so they never reach the output and
+// -strip-comments is only kept for scripts written before it did.
+// Output is the resulting forms in s-expression syntax; with no -format
+// stage each form is written on a line of its own.  -format=NAME
+// instead writes the result in any format registered with the formats
+// package (json, yaml, dot, ...); these make one document of all the
+// forms, so they are held until the input ends.
+//
+// With -yaml the input is read as YAML instead, converted as the
+// yamlconv package describes, so
+//
+//	sexprpipe -yaml < config.yaml > config.sexpr
+//	sexprpipe -format=yaml < config.sexpr > config.yaml
+//
+// go back and forth.  a YAML stream is read a document at a time, and
+// the forms of each go through the stages as the forms of s-expression
+// input do.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mjsottile/gocode/diag"
+	"github.com/mjsottile/gocode/formats"
+	"github.com/mjsottile/gocode/internal/sexprutil"
+	"github.com/mjsottile/gocode/sexpr"
+	"github.com/mjsottile/gocode/yamlconv"
+)
+
+// one form on its way through the pipeline
+type doc struct {
+	form   *sexpr.Sexpr // nil once a stage has dropped it
+	pretty bool
+	output string // registered format to write, if not s-expression text
+}
+
+type stage struct {
+	name string
+	run  func(d *doc) error
+	done func() error // once the input has run out, if set
+}
+
+var (
+	indent = flag.Int("indent", 2, "indent width for -format")
+	width  = flag.Int("width", 80, "line width for -format")
+	head   = flag.Int("head", 1, "elements kept on the opening line of a broken list (0 for none), for -format")
+	atoms  = flag.Int("atoms", 1, "atoms allowed to share a line, for -format")
+	yaml   = flag.Bool("yaml", false, "read the input as YAML")
+)
+
+func main() {
+	var stages []stage
+	flag.BoolFunc("strip-comments", "remove comments from the raw input", func(string) error {
+		// the parser has already dropped them
+		return nil
+	})
+	flag.BoolFunc("normalize", "one form per line, single spaces", func(string) error {
+		stages = append(stages, stage{"normalize", func(d *doc) error {
+			d.pretty, d.output = false, ""
+			return nil
+		}, nil})
+		return nil
+	})
+	flag.Func("select", "keep only the element at `PATH`", func(p string) error {
+		path, err := sexprutil.ParsePath(p)
+		if err != nil {
+			return err
+		}
+		n := 0 // forms that have reached this stage
+		stages = append(stages, stage{"select " + p, func(d *doc) error {
+			i := n
+			n++
+			if i != path[0] {
+				d.form = nil
+				return nil
+			}
+			// Select counts forms from the start of the input, and
+			// this is the only one still around
+			forms := make([]*sexpr.Sexpr, i+1)
+			forms[i] = d.form
+			e, err := sexprutil.Select(forms, path)
+			if err != nil {
+				return err
+			}
+			// reparse the selection on its own so the elements that
+			// followed it in its list don't come along
+			d.form, err = sexpr.Parse(e.Text())
+			return err
+		}, func() error {
+			if n <= path[0] {
+				return fmt.Errorf("path %v: index %d out of range (%d forms)", path, path[0], n)
+			}
+			return nil
+		}})
+		return nil
+	})
+	flag.Var(optionalValue(func(v string) error {
+		if v != "true" {
+			if _, ok := formats.Lookup(v); !ok {
+				return fmt.Errorf("unknown format %q (have %v)", v, formats.Names())
+			}
+		}
+		stages = append(stages, stage{"format", func(d *doc) error {
+			if v == "true" {
+				d.pretty, d.output = true, ""
+			} else {
+				d.output = v
+			}
+			return nil
+		}, nil})
+		return nil
+	}), "format", "pretty-print the output, or with -format=`NAME` write it in a registered format")
+	flag.Parse()
+	if flag.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "usage: sexprpipe [stages] < input > output")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	next := sexprForms(os.Stdin)
+	if *yaml {
+		next = yamlForms(os.Stdin)
+	}
+	opts := sexpr.FormatOptions{Indent: *indent, Width: *width, Head: *head, MaxAtoms: *atoms}
+	if *head == 0 {
+		opts.Head = -1
+	}
+	out := bufio.NewWriter(os.Stdout)
+	var (
+		output  string
+		pending []*sexpr.Sexpr // for a registered format, which writes one document
+	)
+	for {
+		f, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fail(err)
+		}
+		d := &doc{form: f}
+		for _, st := range stages {
+			if err := st.run(d); err != nil {
+				fail(fmt.Errorf("%s: %w", st.name, err))
+			}
+			if d.form == nil {
+				break
+			}
+		}
+		switch {
+		case d.form == nil:
+		case d.output != "":
+			output = d.output
+			pending = append(pending, d.form)
+		default:
+			if d.pretty {
+				out.WriteString(sexpr.Format(d.form, opts))
+			} else {
+				out.WriteString(d.form.Text())
+			}
+			out.WriteByte('\n')
+			if err := out.Flush(); err != nil {
+				fail(err)
+			}
+		}
+	}
+	for _, st := range stages {
+		if st.done == nil {
+			continue
+		}
+		if err := st.done(); err != nil {
+			fail(fmt.Errorf("%s: %w", st.name, err))
+		}
+	}
+	if output != "" {
+		if err := formats.Write(out, output, sexpr.NewForms(pending...)); err != nil {
+			fail(err)
+		}
+		if err := out.Flush(); err != nil {
+			fail(err)
+		}
+	}
+}
+
+// the forms of an s-expression stream, one at a time; io.EOF after the
+// last
+func sexprForms(r io.Reader) func() (*sexpr.Sexpr, error) {
+	dec := sexpr.NewDecoder(r)
+	return func() (*sexpr.Sexpr, error) {
+		var f *sexpr.Sexpr
+		err := dec.Decode(&f)
+		return f, err
+	}
+}
+
+// the forms of a YAML stream, read a document at a time
+func yamlForms(r io.Reader) func() (*sexpr.Sexpr, error) {
+	docs := &yamlDocs{r: bufio.NewReader(r), pos: diag.Position{Line: 1, Column: 1}}
+	var forms []*sexpr.Sexpr
+	return func() (*sexpr.Sexpr, error) {
+		for len(forms) == 0 {
+			text, at, err := docs.next()
+			if err != nil {
+				return nil, err
+			}
+			decoded, err := yamlconv.Decode([]byte(text))
+			if err != nil {
+				var se *diag.SourceError
+				if errors.As(err, &se) && se.Pos.IsValid() {
+					// documents start at the start of a line
+					se.Pos.Line += at.Line - 1
+					se.Pos.Offset += at.Offset
+				}
+				return nil, err
+			}
+			for _, d := range decoded {
+				forms = append(forms, sexprutil.Forms(d)...)
+			}
+		}
+		f := forms[0]
+		forms = forms[1:]
+		return f, nil
+	}
+}
+
+// splits a YAML stream into its documents at the "---" and "..."
+// markers, which YAML only allows at the start of a line and never
+// inside a node
+type yamlDocs struct {
+	r    *bufio.Reader
+	pos  diag.Position // of the start of the next line
+	line string        // read but belonging to the next document
+}
+
+// the text of the next document and where it starts, or io.EOF
+func (y *yamlDocs) next() (string, diag.Position, error) {
+	at := y.pos
+	var b strings.Builder
+	content := false // past the directives, comments and blank lines
+	for {
+		line := y.line
+		y.line = ""
+		if line == "" {
+			var err error
+			line, err = y.r.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return "", at, err
+			}
+			if line == "" {
+				if b.Len() == 0 {
+					return "", at, io.EOF
+				}
+				return b.String(), at, nil
+			}
+		}
+		if content && marker(line, "---") {
+			y.line = line
+			return b.String(), at, nil
+		}
+		b.WriteString(line)
+		y.pos.Offset += len(line)
+		y.pos.Line += strings.Count(line, "\n")
+		trimmed := strings.TrimLeft(line, " \t\r\n")
+		switch {
+		case content && marker(line, "..."):
+			return b.String(), at, nil
+		case trimmed == "" || trimmed[0] == '#' || !content && line[0] == '%':
+		default:
+			content = true
+		}
+	}
+}
+
+// whether line starts with the document marker m
+func marker(line, m string) bool {
+	rest, ok := strings.CutPrefix(line, m)
+	return ok && (rest == "" || strings.ContainsRune(" \t\r\n", rune(rest[0])))
+}
+
+// a flag that may be given bare, like a boolean, or with a value.  bare
+// uses get "true".
+type optionalValue func(string) error
+
+func (f optionalValue) Set(v string) error { return f(v) }
+func (f optionalValue) String() string     { return "" }
+func (f optionalValue) IsBoolFlag() bool   { return true }
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "sexprpipe:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,213 @@
+// Command sexprsplit divides a large file of s-expressions into chunk
+// files at top-level form boundaries, for processing the pieces in
+// parallel.  It streams, so the input can be much larger than memory;
+// only a single form has to fit.
+//
+//	sexprsplit -n 8 corpus.sexpr           8 chunks of about equal size
+//	sexprsplit -bytes 64m < corpus.sexpr   chunks of about 64MB each
+//	sexprsplit -forms 10000 corpus.sexpr   10000 forms per chunk
+//
+// -n needs to know the input size up front, so it works on files (or
+// standard input redirected from one) but not pipes; the others work on
+// anything.  A chunk is closed after the form that takes it past its
+// share, so chunks come out slightly over size rather than under.
+// Chunks are written to PREFIX0000.sexpr, PREFIX0001.sexpr and so on,
+// one form per line, and concatenating them in order gives back the
+// forms of the input.  Their names and sizes are listed on standard
+// output.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+var (
+	chunks  = flag.Int("n", 0, "split into this many chunks of about equal size")
+	maxSize = flag.String("bytes", "", "close each chunk once it reaches this size (k, m and g suffixes allowed)")
+	perFile = flag.Int("forms", 0, "put this many forms in each chunk")
+	prefix  = flag.String("prefix", "chunk-", "prefix of the chunk file names")
+	suffix  = flag.String("suffix", ".sexpr", "suffix of the chunk file names")
+	maxForm = flag.Int("max-form", 1<<30, "largest single form accepted, in bytes")
+)
+
+// parse sizes like 512, 64k or 1g
+func parseSize(s string) (int64, error) {
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(strings.ToLower(s), "k"):
+		mult = 1 << 10
+	case strings.HasSuffix(strings.ToLower(s), "m"):
+		mult = 1 << 20
+	case strings.HasSuffix(strings.ToLower(s), "g"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("bad size %q", s)
+	}
+	return n * mult, nil
+}
+
+// the chunk being written
+type chunk struct {
+	index int
+	name  string
+	file  *os.File
+	w     *bufio.Writer
+	bytes int64
+	forms int
+}
+
+func (c *chunk) close() error {
+	if err := c.w.Flush(); err != nil {
+		c.file.Close()
+		return err
+	}
+	if err := c.file.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("%s\t%d forms\t%d bytes\n", c.name, c.forms, c.bytes)
+	return nil
+}
+
+func open(index int) (*chunk, error) {
+	name := fmt.Sprintf("%s%04d%s", *prefix, index, *suffix)
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &chunk{index: index, name: name, file: f, w: bufio.NewWriter(f)}, nil
+}
+
+func split(in io.Reader, full func(c *chunk) bool) error {
+	sc := bufio.NewScanner(in)
+	sc.Buffer(nil, *maxForm)
+	sc.Split(sexpr.ScanForms)
+	var cur *chunk
+	next, seen := 0, 0
+	for sc.Scan() {
+		if cur == nil {
+			var err error
+			if cur, err = open(next); err != nil {
+				return err
+			}
+			next++
+		}
+		form := sc.Bytes()
+		seen++
+		cur.w.Write(form)
+		if err := cur.w.WriteByte('\n'); err != nil {
+			return err
+		}
+		cur.bytes += int64(len(form) + 1)
+		cur.forms++
+		if full(cur) {
+			if err := cur.close(); err != nil {
+				return err
+			}
+			cur = nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			err = fmt.Errorf("form %d is larger than -max-form", seen+1)
+		} else {
+			err = fmt.Errorf("after %d forms: %w", seen, err)
+		}
+		// keep what was read before the problem
+		if cur != nil {
+			cur.close()
+		}
+		return err
+	}
+	if cur != nil {
+		return cur.close()
+	}
+	return nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: sexprsplit (-n N | -bytes SIZE | -forms N) [-prefix P] [-suffix S] [file]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	in := os.Stdin
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if flag.NArg() == 1 && flag.Arg(0) != "-" {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fail(err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var full func(c *chunk) bool
+	set := 0
+	if *chunks > 0 {
+		set++
+		fi, err := in.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			fail(fmt.Errorf("-n needs a regular file to know its size; use -bytes on pipes"))
+		}
+		total, n := fi.Size(), int64(*chunks)
+		var written int64
+		full = func(c *chunk) bool {
+			// chunk i ends once everything so far reaches (i+1)/n of the
+			// input, which keeps one big form from skewing the rest
+			written += int64(len(""))
+			return int64(c.index) < n-1 && written+c.bytes >= (int64(c.index)+1)*total/n
+		}
+		// the bytes in the chunks already closed
+		prev := full
+		full = func(c *chunk) bool {
+			if prev(c) {
+				written += c.bytes
+				return true
+			}
+			return false
+		}
+	}
+	if *maxSize != "" {
+		set++
+		limit, err := parseSize(*maxSize)
+		if err != nil {
+			fail(err)
+		}
+		full = func(c *chunk) bool { return c.bytes >= limit }
+	}
+	if *perFile > 0 {
+		set++
+		n := *perFile
+		full = func(c *chunk) bool { return c.forms >= n }
+	}
+	if set != 1 {
+		fmt.Fprintln(os.Stderr, "sexprsplit: give exactly one of -n, -bytes and -forms")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := split(in, full); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "sexprsplit:", err)
+	os.Exit(1)
+}
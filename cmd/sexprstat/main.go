@@ -0,0 +1,253 @@
+// Command sexprstat reports statistics about s-expression files: how
+// many nodes of each kind they hold, how deeply they nest, what sort of
+// atoms they contain, which subtrees are largest and which subtrees are
+// repeated the most.  It is meant for getting a feel for big
+// machine-generated dumps.
+//
+//	sexprstat [-n N] [-min SIZE] [-json] file...
+//
+// With no files it reads standard input.  Paths in the report are
+// dot-separated 0-based indices, the first picking a top-level form, as
+// accepted by sexprpipe -select.  Duplicates are lists of at least -min
+// nodes that occur more than once, ranked by the number of nodes the
+// extra copies take up.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mjsottile/gocode/diag"
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+var (
+	top     = flag.Int("n", 5, "number of largest and duplicated subtrees to list")
+	minSize = flag.Int("min", 4, "smallest subtree, in nodes, counted as a duplicate")
+	asJSON  = flag.Bool("json", false, "print the report as JSON")
+)
+
+// how much of a subtree's text to show
+const snippetLen = 60
+
+type subtree struct {
+	Path string `json:"path"`
+	Size int    `json:"size"`
+	Text string `json:"text"`
+
+	node *sexpr.Sexpr
+}
+
+type duplicate struct {
+	Count  int      `json:"count"`
+	Size   int      `json:"size"`
+	Wasted int      `json:"wasted"`
+	Text   string   `json:"text"`
+	Paths  []string `json:"paths"`
+}
+
+type report struct {
+	File      string         `json:"file"`
+	Bytes     int            `json:"bytes"`
+	Forms     int            `json:"forms"`
+	Nodes     int            `json:"nodes"`
+	Atoms     int            `json:"atoms"`
+	Lists     int            `json:"lists"`
+	Empty     int            `json:"empty_lists"`
+	MaxDepth  int            `json:"max_depth"`
+	MaxWidth  int            `json:"max_width"`
+	AtomKinds map[string]int `json:"atom_kinds"`
+	Largest   []subtree      `json:"largest"`
+	Repeated  []duplicate    `json:"duplicates"`
+
+	seen map[sexpr.Hash]*duplicate
+}
+
+func snippet(s *sexpr.Sexpr) string {
+	t := s.Text()
+	if utf8.RuneCountInString(t) <= snippetLen {
+		return t
+	}
+	r := []rune(t)
+	return string(r[:snippetLen-1]) + "…"
+}
+
+// visit records s and everything below it, returning its size in nodes
+func (r *report) visit(s *sexpr.Sexpr, path []int, depth int) int {
+	r.Nodes++
+	if depth > r.MaxDepth {
+		r.MaxDepth = depth
+	}
+	if s.IsAtom() {
+		r.Atoms++
+		r.AtomKinds[s.AtomKind().String()]++
+		return 1
+	}
+	r.Lists++
+	kids := s.Children()
+	if len(kids) == 0 {
+		r.Empty++
+	}
+	if len(kids) > r.MaxWidth {
+		r.MaxWidth = len(kids)
+	}
+	size := 1
+	for i, c := range kids {
+		size += r.visit(c, append(path, i), depth+1)
+	}
+
+	if size >= *minSize {
+		key := s.Hash()
+		d := r.seen[key]
+		if d == nil {
+			d = &duplicate{Size: size, Text: snippet(s)}
+			r.seen[key] = d
+		}
+		d.Count++
+		d.Paths = append(d.Paths, sexpr.PathString(path))
+	}
+	r.Largest = append(r.Largest, subtree{Path: sexpr.PathString(path), Size: size, node: s})
+	return size
+}
+
+func analyze(name string, src []byte) (*report, error) {
+	forms, err := sexpr.ParseAll(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, diag.Describe(err, string(src)))
+	}
+	r := &report{
+		File:      name,
+		Bytes:     len(src),
+		AtomKinds: make(map[string]int),
+		seen:      make(map[sexpr.Hash]*duplicate),
+	}
+	r.Forms = len(forms)
+	for i, f := range forms {
+		r.visit(f, []int{i}, 1)
+	}
+
+	sort.SliceStable(r.Largest, func(i, j int) bool { return r.Largest[i].Size > r.Largest[j].Size })
+	if len(r.Largest) > *top {
+		r.Largest = r.Largest[:*top]
+	}
+	for i := range r.Largest {
+		r.Largest[i].Text = snippet(r.Largest[i].node)
+	}
+
+	for _, d := range r.seen {
+		if d.Count > 1 {
+			d.Wasted = (d.Count - 1) * d.Size
+			r.Repeated = append(r.Repeated, *d)
+		}
+	}
+	sort.Slice(r.Repeated, func(i, j int) bool {
+		a, b := r.Repeated[i], r.Repeated[j]
+		if a.Wasted != b.Wasted {
+			return a.Wasted > b.Wasted
+		}
+		return a.Text < b.Text
+	})
+	if len(r.Repeated) > *top {
+		r.Repeated = r.Repeated[:*top]
+	}
+	return r, nil
+}
+
+func (r *report) print(w io.Writer) {
+	fmt.Fprintf(w, "%s: %d bytes, %d forms\n", r.File, r.Bytes, r.Forms)
+	fmt.Fprintf(w, "  nodes      %d (%d atoms, %d lists, %d empty)\n", r.Nodes, r.Atoms, r.Lists, r.Empty)
+	fmt.Fprintf(w, "  max depth  %d\n", r.MaxDepth)
+	fmt.Fprintf(w, "  max width  %d\n", r.MaxWidth)
+	kinds := make([]string, 0, len(r.AtomKinds))
+	for k := range r.AtomKinds {
+		kinds = append(kinds, k)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		a, b := r.AtomKinds[kinds[i]], r.AtomKinds[kinds[j]]
+		return a > b || a == b && kinds[i] < kinds[j]
+	})
+	if len(kinds) > 0 {
+		fmt.Fprintln(w, "  atoms")
+	}
+	for _, k := range kinds {
+		n := r.AtomKinds[k]
+		fmt.Fprintf(w, "    %-9s %8d  %5.1f%%\n", k, n, 100*float64(n)/float64(r.Atoms))
+	}
+	if len(r.Largest) > 0 {
+		fmt.Fprintln(w, "  largest subtrees")
+	}
+	for _, t := range r.Largest {
+		fmt.Fprintf(w, "    %8d  %-12s %s\n", t.Size, t.Path, t.Text)
+	}
+	if len(r.Repeated) > 0 {
+		fmt.Fprintln(w, "  duplicated subtrees (count x size)")
+	}
+	for _, d := range r.Repeated {
+		fmt.Fprintf(w, "    %4d x %-6d %s\n", d.Count, d.Size, d.Text)
+		fmt.Fprintf(w, "                  at %s\n", strings.Join(firstN(d.Paths, 4), ", "))
+	}
+}
+
+func firstN(paths []string, n int) []string {
+	if len(paths) <= n {
+		return paths
+	}
+	return append(paths[:n:n], fmt.Sprintf("... %d more", len(paths)-n))
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: sexprstat [-n N] [-min SIZE] [-json] file...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	names := flag.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+
+	var reports []*report
+	status := 0
+	for _, name := range names {
+		var src []byte
+		var err error
+		if name == "-" {
+			src, err = io.ReadAll(os.Stdin)
+		} else {
+			src, err = os.ReadFile(name)
+		}
+		if err == nil {
+			var r *report
+			if r, err = analyze(name, src); err == nil {
+				reports = append(reports, r)
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "sexprstat:", err)
+			status = 1
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			fmt.Fprintln(os.Stderr, "sexprstat:", err)
+			status = 1
+		}
+	} else {
+		for i, r := range reports {
+			if i > 0 {
+				fmt.Println()
+			}
+			r.print(os.Stdout)
+		}
+	}
+	os.Exit(status)
+}
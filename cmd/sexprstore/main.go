@@ -0,0 +1,91 @@
+// Command sexprstore keeps s-expression documents in a content-addressed
+// store on disk (see package castore), where every distinct subtree is
+// stored once however many documents repeat it.
+//
+//	sexprstore [-dir DIR] put file...   store files, printing their hashes
+//	sexprstore [-dir DIR] get HASH      write a stored document to stdout
+//
+// put prints one "HASH FILE" line per file, and with -v a summary of how
+// many nodes were new.  get writes the document in canonical form, one
+// form per line.  The store defaults to ./.sexprstore.
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mjsottile/gocode/castore"
+	"github.com/mjsottile/gocode/diag"
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+var (
+	dir     = flag.String("dir", ".sexprstore", "store directory")
+	verbose = flag.Bool("v", false, "print a summary after put")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: sexprstore [-dir DIR] [-v] put file...")
+		fmt.Fprintln(os.Stderr, "       sexprstore [-dir DIR] get HASH")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	blobs, err := castore.NewDirBlobs(*dir)
+	if err != nil {
+		fail(err)
+	}
+	st := castore.New(blobs)
+
+	switch flag.Arg(0) {
+	case "put":
+		var in int64
+		for _, name := range flag.Args()[1:] {
+			src, err := os.ReadFile(name)
+			if err != nil {
+				fail(err)
+			}
+			forms, err := sexpr.ParseAll(string(src))
+			if err != nil {
+				fail(fmt.Errorf("%s: %s", name, diag.Describe(err, string(src))))
+			}
+			h, err := st.PutDocument(sexpr.NewForms(forms...))
+			if err != nil {
+				fail(err)
+			}
+			in += int64(len(src))
+			fmt.Printf("%s %s\n", h, name)
+		}
+		if *verbose {
+			s := st.Stats()
+			fmt.Fprintf(os.Stderr, "%d nodes put, %d new; %d bytes written for %d bytes of input\n",
+				s.Nodes, s.Written, s.Bytes, in)
+		}
+	case "get":
+		var h sexpr.Hash
+		b, err := hex.DecodeString(flag.Arg(1))
+		if err != nil || len(b) != len(h) {
+			fail(fmt.Errorf("bad hash %q", flag.Arg(1)))
+		}
+		copy(h[:], b)
+		s, err := st.GetDocument(h)
+		if err != nil {
+			fail(err)
+		}
+		os.Stdout.Write(sexpr.EncodeCanonical(s))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "sexprstore:", err)
+	os.Exit(1)
+}
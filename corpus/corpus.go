@@ -0,0 +1,329 @@
+/*
+Package corpus generates random s-expression documents for exercising
+the parser: seeding fuzzers, load testing the tools and benchmarking at
+a known scale.  Documents are reproducible from their Config, seed
+included.  By default they are syntactically valid; a fraction of forms
+can be deliberately broken in the ways people break real files (a
+missing or extra ')', an unterminated string) to test error reporting.
+*/
+package corpus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// AtomMix gives the relative weights of the kinds of atom generated.
+// the zero value means DefaultMix.
+type AtomMix struct {
+	Symbol  int // bare words like define or foo-bar
+	Integer int // 42, -7
+	Float   int // 3.25, -1e-3
+	String  int // double quoted, may contain spaces and parens
+}
+
+// DefaultMix is mostly symbols with some of everything else.
+var DefaultMix = AtomMix{Symbol: 6, Integer: 2, Float: 1, String: 1}
+
+// Breakage says how a broken form was broken.
+type Breakage int
+
+const (
+	MissingParen Breakage = iota // a ')' dropped
+	ExtraParen                   // a stray ')' added
+	OpenString                   // a string left unterminated
+)
+
+var breakageNames = [...]string{"missing-paren", "extra-paren", "open-string"}
+
+func (b Breakage) String() string {
+	if int(b) < len(breakageNames) {
+		return breakageNames[b]
+	}
+	return fmt.Sprintf("Breakage(%d)", int(b))
+}
+
+// Config controls the shape of a generated document.
+type Config struct {
+	Seed int64
+
+	// number of top-level forms.  if zero, forms are generated until
+	// the output reaches Bytes.
+	Forms int
+	Bytes int
+
+	// nesting and list length limits; zero means 6 and 8.  lists are
+	// drawn between empty and MaxWidth elements, and nesting stops
+	// early at random, so most forms are well under the limits.
+	MaxDepth int
+	MaxWidth int
+
+	Mix AtomMix
+
+	// lay forms out over several indented lines, the way people write
+	// them, rather than one form per line
+	Indent bool
+
+	// sprinkle ; line comments and #| |# block comments between
+	// elements.  sexpr.Parse skips them, so the forms come out the same
+	// as without.
+	Comments bool
+
+	// fraction of top-level forms, 0 to 1, to break.  everything after
+	// the first broken form is still generated, but of course a parser
+	// may see it differently.
+	Invalid float64
+}
+
+// Stats describes a generated document.
+type Stats struct {
+	Forms  int
+	Nodes  int // atoms and lists
+	Atoms  int
+	Depth  int // deepest nesting seen; a top-level atom has depth 1
+	Bytes  int
+	Broken []Break
+}
+
+// Break records one deliberately broken form.
+type Break struct {
+	Form   int // index of the top-level form
+	Offset int // byte offset of the damage in the output
+	Kind   Breakage
+}
+
+type generator struct {
+	cfg   Config
+	r     *rand.Rand
+	mix   [4]int
+	total int
+	st    Stats
+
+	// the form being generated, so breaking it can rewrite it
+	buf strings.Builder
+}
+
+// Generate writes a document to w.
+func Generate(w io.Writer, cfg Config) (Stats, error) {
+	g := newGenerator(cfg)
+	bw := bufio.NewWriter(w)
+	for i := 0; cfg.Forms > 0 && i < cfg.Forms || cfg.Forms <= 0 && g.st.Bytes < cfg.Bytes; i++ {
+		form := g.form(i)
+		if _, err := bw.WriteString(form); err != nil {
+			return g.st, err
+		}
+		g.st.Bytes += len(form)
+	}
+	return g.st, bw.Flush()
+}
+
+// String returns a document as a string.
+func String(cfg Config) (string, Stats) {
+	var b strings.Builder
+	st, _ := Generate(&b, cfg)
+	return b.String(), st
+}
+
+func newGenerator(cfg Config) *generator {
+	if cfg.MaxDepth <= 0 {
+		cfg.MaxDepth = 6
+	}
+	if cfg.MaxWidth <= 0 {
+		cfg.MaxWidth = 8
+	}
+	if cfg.Mix == (AtomMix{}) {
+		cfg.Mix = DefaultMix
+	}
+	g := &generator{cfg: cfg, r: rand.New(rand.NewSource(cfg.Seed))}
+	g.mix = [4]int{cfg.Mix.Symbol, cfg.Mix.Integer, cfg.Mix.Float, cfg.Mix.String}
+	for i, w := range g.mix {
+		if w < 0 {
+			g.mix[i] = 0
+		}
+		g.total += g.mix[i]
+	}
+	if g.total == 0 {
+		g.mix[0], g.total = 1, 1
+	}
+	return g
+}
+
+// one top-level form followed by a newline
+func (g *generator) form(i int) string {
+	g.buf.Reset()
+	g.st.Forms++
+	if g.cfg.Comments && g.r.Intn(4) == 0 {
+		g.buf.WriteString("; form " + strconv.Itoa(i) + "\n")
+	}
+	if g.r.Intn(8) == 0 {
+		g.atom()
+		g.note(1)
+	} else {
+		g.list(1, 0)
+	}
+	g.buf.WriteByte('\n')
+	s := g.buf.String()
+	if g.cfg.Invalid > 0 && g.r.Float64() < g.cfg.Invalid {
+		s = g.breakForm(s, i)
+	}
+	return s
+}
+
+func (g *generator) note(depth int) {
+	g.st.Nodes++
+	if depth > g.st.Depth {
+		g.st.Depth = depth
+	}
+}
+
+// a list at the given depth, its '(' in column col
+func (g *generator) list(depth, col int) {
+	g.note(depth)
+	g.buf.WriteByte('(')
+	n := 0
+	if depth < g.cfg.MaxDepth {
+		n = g.r.Intn(g.cfg.MaxWidth + 1)
+	}
+	// lists start with a symbol, like most real code
+	for k := 0; k < n; k++ {
+		if k > 0 {
+			g.separate(col)
+		}
+		switch {
+		case k == 0:
+			g.buf.WriteString(g.symbol())
+			g.st.Atoms++
+		case depth < g.cfg.MaxDepth && g.r.Intn(3) == 0:
+			g.list(depth+1, col+2)
+			continue
+		default:
+			g.atom()
+		}
+		g.note(depth + 1)
+	}
+	g.buf.WriteByte(')')
+}
+
+// the space between two elements of a list opened in column col
+func (g *generator) separate(col int) {
+	if g.cfg.Comments && g.r.Intn(12) == 0 {
+		if g.r.Intn(2) == 0 {
+			g.buf.WriteString(" #| note |#")
+		} else {
+			g.buf.WriteString(" ; note\n" + strings.Repeat(" ", col+2))
+			return
+		}
+	}
+	if g.cfg.Indent && g.r.Intn(3) == 0 {
+		g.buf.WriteString("\n" + strings.Repeat(" ", col+2))
+		return
+	}
+	g.buf.WriteByte(' ')
+}
+
+var symbols = []string{
+	"define", "lambda", "let", "if", "cond", "list", "car", "cdr", "cons",
+	"x", "y", "z", "foo", "bar-baz", "set!", "null?", "+", "-", "*", "<=",
+	"node", "edge", "weight", "label", "α", "λ",
+}
+
+func (g *generator) symbol() string {
+	if g.r.Intn(4) == 0 {
+		return symbols[g.r.Intn(len(symbols))] + strconv.Itoa(g.r.Intn(100))
+	}
+	return symbols[g.r.Intn(len(symbols))]
+}
+
+var words = []string{"hello", "world", "a (paren) or two", "tab\there", "ünïcode", "", "x y z"}
+
+func (g *generator) atom() {
+	g.st.Atoms++
+	k := g.r.Intn(g.total)
+	switch {
+	case k < g.mix[0]:
+		g.buf.WriteString(g.symbol())
+	case k < g.mix[0]+g.mix[1]:
+		g.buf.WriteString(strconv.Itoa(g.r.Intn(2001) - 1000))
+	case k < g.mix[0]+g.mix[1]+g.mix[2]:
+		f := (g.r.Float64() - 0.5) * 1000
+		if g.r.Intn(4) == 0 {
+			g.buf.WriteString(strconv.FormatFloat(f/1e6, 'e', 3, 64))
+		} else {
+			g.buf.WriteString(strconv.FormatFloat(f, 'f', 2, 64))
+		}
+	default:
+		g.buf.WriteString(`"` + words[g.r.Intn(len(words))] + `"`)
+	}
+}
+
+// damage form number i, already rendered as s
+func (g *generator) breakForm(s string, i int) string {
+	kind := Breakage(g.r.Intn(3))
+	var at int
+	switch kind {
+	case MissingParen:
+		at = randomOffset(g.r, s, func(c byte) bool { return c == ')' })
+		if at < 0 {
+			kind = ExtraParen
+			break
+		}
+		s = s[:at] + s[at+1:]
+	case OpenString:
+		// drop the closing quote of the last string in the form, or
+		// start one that never ends if there are no strings
+		end := strings.LastIndexByte(s, '"')
+		if end < 0 {
+			at = len(s) - 1
+			s = s[:at] + ` "unterminated` + s[at:]
+			at++
+			break
+		}
+		at = strings.LastIndexByte(s[:end], '"')
+		s = s[:end] + s[end+1:]
+	}
+	if kind == ExtraParen {
+		// anywhere but inside a string or comment, where it would be
+		// harmless
+		at = randomOffset(g.r, s, func(byte) bool { return true })
+		s = s[:at] + ")" + s[at:]
+	}
+	g.st.Broken = append(g.st.Broken, Break{Form: i, Offset: g.st.Bytes + at, Kind: kind})
+	return s
+}
+
+// a random offset in s outside of any string or comment whose byte
+// satisfies ok, or -1 if there is none
+func randomOffset(r *rand.Rand, s string, ok func(byte) bool) int {
+	var idx []int
+	inString, inComment := false, ""
+	for i := 0; i < len(s); i++ {
+		switch {
+		case inComment != "":
+			if strings.HasPrefix(s[i:], inComment) {
+				i += len(inComment) - 1
+				inComment = ""
+			}
+			continue
+		case !inString && s[i] == ';':
+			inComment = "\n"
+			continue
+		case !inString && strings.HasPrefix(s[i:], "#|"):
+			inComment = "|#"
+			continue
+		}
+		if !inString && ok(s[i]) {
+			idx = append(idx, i)
+		}
+		if s[i] == '"' {
+			inString = !inString
+		}
+	}
+	if len(idx) == 0 {
+		return -1
+	}
+	return idx[r.Intn(len(idx))]
+}
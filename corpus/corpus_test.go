@@ -0,0 +1,128 @@
+package corpus
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+// nodes, atoms and depth of s, an element at depth
+func count(s *sexpr.Sexpr, depth int, st *Stats) {
+	st.Nodes++
+	if depth > st.Depth {
+		st.Depth = depth
+	}
+	if s.IsAtom() {
+		st.Atoms++
+		return
+	}
+	for _, k := range s.Children() {
+		count(k, depth+1, st)
+	}
+}
+
+// valid documents parse, and their Stats describe what was parsed
+func TestGenerateValid(t *testing.T) {
+	configs := []Config{
+		{Forms: 50},
+		{Forms: 50, Indent: true},
+		{Forms: 50, Comments: true},
+		{Forms: 50, Indent: true, Comments: true, MaxDepth: 3, MaxWidth: 20},
+		{Forms: 50, Mix: AtomMix{String: 1, Float: 1}},
+		{Forms: 50, Mix: AtomMix{Symbol: -1}},
+		{Bytes: 10000, Indent: true},
+	}
+	for i, cfg := range configs {
+		for seed := int64(0); seed < 20; seed++ {
+			cfg.Seed = seed
+			doc, st := String(cfg)
+			forms, err := sexpr.ParseAll(doc)
+			if err != nil {
+				t.Fatalf("config %d, seed %d: %v\n%s", i, seed, err, doc)
+			}
+			var got Stats
+			for _, f := range forms {
+				count(f, 1, &got)
+			}
+			got.Forms, got.Bytes = len(forms), len(doc)
+			if got.Forms != st.Forms || got.Nodes != st.Nodes || got.Atoms != st.Atoms ||
+				got.Depth != st.Depth || got.Bytes != st.Bytes || len(st.Broken) != 0 {
+				t.Errorf("config %d, seed %d: Stats %+v, but parsed %+v", i, seed, st, got)
+			}
+			if cfg.MaxDepth > 0 && st.Depth > cfg.MaxDepth+1 {
+				t.Errorf("config %d, seed %d: depth %d past MaxDepth %d", i, seed, st.Depth, cfg.MaxDepth)
+			}
+		}
+	}
+}
+
+func TestGenerateSize(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 5000} {
+		doc, st := String(Config{Bytes: n, Seed: 3})
+		last := strings.LastIndexByte(strings.TrimSuffix(doc, "\n"), '\n') + 1
+		if len(doc) < n || last >= n && n > 0 {
+			t.Errorf("Bytes %d gave %d bytes, the last form starting at %d", n, len(doc), last)
+		}
+		if st.Forms != strings.Count(doc, "\n") {
+			t.Errorf("Bytes %d gave %d lines, Stats say %d forms", n, strings.Count(doc, "\n"), st.Forms)
+		}
+	}
+	if doc, _ := String(Config{Forms: 7, Bytes: 1 << 20}); strings.Count(doc, "\n") != 7 {
+		t.Errorf("Forms 7 gave\n%s", doc)
+	}
+}
+
+func TestGenerateReproducible(t *testing.T) {
+	cfg := Config{Seed: 42, Forms: 30, Indent: true, Comments: true, Invalid: 0.3}
+	a, sa := String(cfg)
+	b, sb := String(cfg)
+	if a != b || len(sa.Broken) != len(sb.Broken) {
+		t.Errorf("the same Config gave different documents")
+	}
+	cfg.Seed++
+	if c, _ := String(cfg); c == a {
+		t.Errorf("different seeds gave the same document")
+	}
+}
+
+// every broken form fails to parse, and its Break points at the damage
+func TestGenerateInvalid(t *testing.T) {
+	seen := make(map[Breakage]bool)
+	for seed := int64(0); seed < 300; seed++ {
+		doc, st := String(Config{Seed: seed, Forms: 1, Invalid: 1, Comments: seed%2 == 0})
+		if len(st.Broken) != 1 {
+			t.Fatalf("seed %d: %d forms broken, want 1", seed, len(st.Broken))
+		}
+		b := st.Broken[0]
+		seen[b.Kind] = true
+		if _, err := sexpr.ParseAll(doc); err == nil {
+			t.Errorf("seed %d: %s form parses:\n%s", seed, b.Kind, doc)
+		}
+		switch b.Kind {
+		case ExtraParen:
+			if doc[b.Offset] != ')' {
+				t.Errorf("seed %d: no ')' at %d in\n%s", seed, b.Offset, doc)
+			}
+		case OpenString:
+			if doc[b.Offset] != '"' || strings.Count(doc[b.Offset:], `"`) != 1 {
+				t.Errorf("seed %d: no open string at %d in\n%s", seed, b.Offset, doc)
+			}
+		}
+	}
+	for k := MissingParen; k <= OpenString; k++ {
+		if !seen[k] {
+			t.Errorf("no form was broken with %s", k)
+		}
+	}
+
+	doc, st := String(Config{Seed: 1, Forms: 200, Invalid: 0.1})
+	if n := len(st.Broken); n < 5 || n > 50 {
+		t.Errorf("Invalid 0.1 broke %d forms of 200", n)
+	}
+	for _, b := range st.Broken {
+		if b.Offset < 0 || b.Offset >= len(doc) {
+			t.Errorf("break %+v outside the %d byte document", b, len(doc))
+		}
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Package diag holds the error and source-position types shared by the
+packages in this repository, so that tools built on top of them can
+report and inspect problems in input files the same way no matter which
+package found them.
+
+A *SourceError carries a Position and, optionally, an underlying error.
+Packages export sentinel errors for the kinds of failure they report and
+wrap them in a SourceError, so callers can use errors.Is to ask what went
+wrong and errors.As to find out where.
+*/
+package diag
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Position is a location in some source text.  Offset is a 0-based byte
+// offset; Line and Column are 1-based, with Column counted in characters
+// (runes).  a zero Line means line information is unknown.
+type Position struct {
+	Filename string
+	Offset   int
+	Line     int
+	Column   int
+}
+
+// IsValid reports whether the position carries line information.
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// String formats the position as file:line:col, leaving out whatever
+// isn't known.
+func (p Position) String() string {
+	s := p.Filename
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	} else if s == "" {
+		s = fmt.Sprintf("offset %d", p.Offset)
+	}
+	return s
+}
+
+// PositionFor computes the full position of a byte offset within src.
+// offsets past the end of src are clamped to the end.
+func PositionFor(filename, src string, offset int) Position {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	line := 1 + strings.Count(src[:offset], "\n")
+	start := strings.LastIndexByte(src[:offset], '\n') + 1
+	return Position{
+		Filename: filename,
+		Offset:   offset,
+		Line:     line,
+		Column:   1 + utf8.RuneCountInString(src[start:offset]),
+	}
+}
+
+// SourceError is an error tied to a position in some input.  Err, if set,
+// is the underlying cause and is what errors.Is and errors.As see through
+// Unwrap; Msg, if set, replaces Err's text in the message.
+type SourceError struct {
+	Pos Position
+	Msg string
+	Err error
+}
+
+// Errorf builds a SourceError at pos wrapping err, with a formatted
+// message.  err may be nil.
+func Errorf(pos Position, err error, format string, args ...interface{}) *SourceError {
+	return &SourceError{Pos: pos, Msg: fmt.Sprintf(format, args...), Err: err}
+}
+
+func (e *SourceError) Error() string {
+	msg := e.Msg
+	if msg == "" && e.Err != nil {
+		msg = e.Err.Error()
+	}
+	return e.Pos.String() + ": " + msg
+}
+
+func (e *SourceError) Unwrap() error { return e.Err }
+
+// Snippet renders the source line containing the error with a caret
+// under the offending column, for showing to people.  src must be the
+// text the position refers to.
+func (e *SourceError) Snippet(src string) string {
+	pos := e.Pos
+	if !pos.IsValid() {
+		pos = PositionFor(pos.Filename, src, pos.Offset)
+	}
+	off := pos.Offset
+	if off > len(src) {
+		off = len(src)
+	}
+	start := strings.LastIndexByte(src[:off], '\n') + 1
+	end := strings.IndexByte(src[off:], '\n')
+	if end < 0 {
+		end = len(src)
+	} else {
+		end += off
+	}
+	line := src[start:end]
+	// keep tabs in the padding so the caret lines up with the text above
+	pad := strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, src[start:off])
+	return line + "\n" + pad + "^"
+}
+
+// Describe formats err for display.  if err wraps a SourceError, the
+// message is followed by a snippet of src pointing at the problem.
+func Describe(err error, src string) string {
+	var se *SourceError
+	if errors.As(err, &se) {
+		return err.Error() + "\n" + se.Snippet(src)
+	}
+	return err.Error()
+}
@@ -0,0 +1,114 @@
+package diag
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestPositionFor(t *testing.T) {
+	src := "ab\nλx\tz\n\nend"
+	tests := []struct {
+		offset, line, col, clamped int
+	}{
+		{0, 1, 1, 0},
+		{2, 1, 3, 2},
+		{3, 2, 1, 3},
+		{5, 2, 2, 5}, // after the two bytes of λ
+		{7, 2, 4, 7},
+		{9, 3, 1, 9},
+		{len(src), 4, 4, len(src)},
+		{100, 4, 4, len(src)},
+		{-5, 1, 1, 0},
+	}
+	for _, tt := range tests {
+		p := PositionFor("f.sexpr", src, tt.offset)
+		want := Position{Filename: "f.sexpr", Offset: tt.clamped, Line: tt.line, Column: tt.col}
+		if p != want {
+			t.Errorf("PositionFor(%d) = %+v, want %+v", tt.offset, p, want)
+		}
+	}
+}
+
+func TestPositionString(t *testing.T) {
+	tests := []struct {
+		p    Position
+		want string
+	}{
+		{Position{Filename: "a.sexpr", Line: 3, Column: 7}, "a.sexpr:3:7"},
+		{Position{Line: 3, Column: 7}, "3:7"},
+		{Position{Filename: "a.sexpr", Offset: 12}, "a.sexpr"},
+		{Position{Offset: 12}, "offset 12"},
+	}
+	for _, tt := range tests {
+		if got := tt.p.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.p, got, tt.want)
+		}
+		if tt.p.IsValid() != (tt.p.Line > 0) {
+			t.Errorf("%+v.IsValid() = %v", tt.p, tt.p.IsValid())
+		}
+	}
+}
+
+var errBad = errors.New("bad input")
+
+func TestSourceError(t *testing.T) {
+	pos := Position{Filename: "x", Line: 2, Column: 5}
+	e := Errorf(pos, errBad, "no %s here", "paren")
+	if e.Error() != "x:2:5: no paren here" {
+		t.Errorf("Error() = %q", e.Error())
+	}
+	// the sentinel and the position are both found through wrapping
+	wrapped := fmt.Errorf("loading config: %w", e)
+	var se *SourceError
+	if !errors.Is(wrapped, errBad) || !errors.As(wrapped, &se) || se.Pos != pos {
+		t.Errorf("errors.Is/As can't see through %v", wrapped)
+	}
+
+	// with no message, the underlying error's text
+	e = &SourceError{Pos: pos, Err: io.ErrUnexpectedEOF}
+	if e.Error() != "x:2:5: unexpected EOF" || !errors.Is(e, io.ErrUnexpectedEOF) {
+		t.Errorf("Error() = %q", e.Error())
+	}
+	if e := Errorf(pos, nil, "plain"); e.Unwrap() != nil || e.Error() != "x:2:5: plain" {
+		t.Errorf("Errorf with no cause = %q, %v", e.Error(), e.Unwrap())
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	src := "(a\n\t(λb c\n"
+	tests := []struct {
+		offset int
+		want   string
+	}{
+		{0, "(a\n^"},
+		{2, "(a\n  ^"},
+		{5, "\t(λb c\n\t ^"},
+		{7, "\t(λb c\n\t  ^"}, // after the two bytes of λ
+		{len(src), "\n^"},
+	}
+	for _, tt := range tests {
+		e := Errorf(PositionFor("", src, tt.offset), errBad, "x")
+		if got := e.Snippet(src); got != tt.want {
+			t.Errorf("Snippet at %d = %q, want %q", tt.offset, got, tt.want)
+		}
+		// a position with only an offset finds its line
+		e.Pos = Position{Offset: tt.offset}
+		if got := e.Snippet(src); got != tt.want {
+			t.Errorf("Snippet at bare offset %d = %q, want %q", tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	src := "(a b))"
+	err := fmt.Errorf("parse: %w", Errorf(PositionFor("", src, 5), errBad, "unexpected )"))
+	want := "parse: 1:6: unexpected )\n(a b))\n     ^"
+	if got := Describe(err, src); got != want {
+		t.Errorf("Describe = %q, want %q", got, want)
+	}
+	if got := Describe(errBad, src); got != "bad input" {
+		t.Errorf("Describe of a plain error = %q", got)
+	}
+}
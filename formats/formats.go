@@ -0,0 +1,246 @@
+/*
+Package formats is a registry of named output backends.  command-line
+tools look formats up by the name given in their -format flag, so adding
+a backend - from this module or any other - is a matter of registering
+it, typically from an init function:
+
+	func init() {
+		formats.Register(formats.Format{
+			Name:        "toml",
+			Description: "TOML document",
+			Write:       writeTOML,
+		})
+	}
+
+and importing the package for its side effect wherever the tool is
+built.  The formats that come with the repository are registered by this
+package: sexpr, json, yaml, xml, csexp, binary, dot, mermaid and
+graphml.
+*/
+package formats
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/mjsottile/gocode/sexpr"
+	"github.com/mjsottile/gocode/viz"
+	"github.com/mjsottile/gocode/yamlconv"
+)
+
+// ErrUnsupported is returned by a format's Write for values it doesn't
+// know how to render.
+var ErrUnsupported = errors.New("formats: value not supported by this format")
+
+// Format is an output backend.  Write renders v, which for the sexpr
+// tools is the *sexpr.Sexpr returned by a parse (the first of a
+// sequence of forms); formats may accept other types as well and return
+// ErrUnsupported for anything they can't handle.
+type Format struct {
+	Name        string
+	Description string
+	Extension   string // conventional file extension, without the dot
+	Binary      bool   // output is not text
+	Write       func(w io.Writer, v any) error
+}
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]Format{}
+)
+
+// Register adds f to the registry.  like database/sql.Register it panics
+// if the name is empty, already taken, or f has no Write function.
+func Register(f Format) {
+	mu.Lock()
+	defer mu.Unlock()
+	if f.Name == "" || f.Write == nil {
+		panic("formats: Register needs a name and a Write function")
+	}
+	if _, dup := registry[f.Name]; dup {
+		panic("formats: Register called twice for " + f.Name)
+	}
+	registry[f.Name] = f
+}
+
+// Lookup returns the format registered under name.
+func Lookup(name string) (Format, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	f, ok := registry[name]
+	return f, ok
+}
+
+// Names lists the registered format names in sorted order.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for n := range registry {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Write renders v to w in the named format.
+func Write(w io.Writer, name string, v any) error {
+	f, ok := Lookup(name)
+	if !ok {
+		return fmt.Errorf("formats: unknown format %q (have %v)", name, Names())
+	}
+	return f.Write(w, v)
+}
+
+// the forms in v, for formats that only deal in s-expressions
+func forms(v any) (*sexpr.Sexpr, error) {
+	s, ok := v.(*sexpr.Sexpr)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupported, v)
+	}
+	return s, nil
+}
+
+// the graph for v, for the graph formats: anything that already is a
+// viz.Graph, or s-expressions via sexpr.ToGraph
+func graph(v any) (viz.Graph, error) {
+	switch g := v.(type) {
+	case viz.Graph:
+		return g, nil
+	case *sexpr.Sexpr:
+		return sexpr.ToGraph(g), nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnsupported, v)
+}
+
+func init() {
+	Register(Format{
+		Name:        "sexpr",
+		Description: "canonical s-expression text, one form per line",
+		Extension:   "sexpr",
+		Write: func(w io.Writer, v any) error {
+			s, err := forms(v)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(sexpr.EncodeCanonical(s))
+			return err
+		},
+	})
+	Register(Format{
+		Name:        "json",
+		Description: "JSON array of forms; lists as arrays, atoms as strings",
+		Extension:   "json",
+		Write: func(w io.Writer, v any) error {
+			s, err := forms(v)
+			if err != nil {
+				return err
+			}
+			b, err := sexpr.FormsJSON(s)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(append(b, '\n'))
+			return err
+		},
+	})
+	Register(Format{
+		Name:        "yaml",
+		Description: "YAML document; entry lists as mappings, other lists as sequences",
+		Extension:   "yaml",
+		Write: func(w io.Writer, v any) error {
+			s, err := forms(v)
+			if err != nil {
+				return err
+			}
+			return yamlconv.Encode(w, yamlconv.Options{}, s)
+		},
+	})
+	Register(Format{
+		Name:        "xml",
+		Description: "XML elements; lists as elements, keyword pairs as attributes",
+		Extension:   "xml",
+		Write: func(w io.Writer, v any) error {
+			s, err := forms(v)
+			if err != nil {
+				return err
+			}
+			b, err := sexpr.ToXML(s)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(append(b, '\n'))
+			return err
+		},
+	})
+	Register(Format{
+		Name:        "csexp",
+		Description: "Rivest canonical s-expressions, for hashing and signing",
+		Extension:   "csexp",
+		Binary:      true,
+		Write: func(w io.Writer, v any) error {
+			s, err := forms(v)
+			if err != nil {
+				return err
+			}
+			b, err := sexpr.EncodeCsexp(s)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(b)
+			return err
+		},
+	})
+	Register(Format{
+		Name:        "binary",
+		Description: "binfmt container holding the parsed forms",
+		Extension:   "bin",
+		Binary:      true,
+		Write: func(w io.Writer, v any) error {
+			s, err := forms(v)
+			if err != nil {
+				return err
+			}
+			return sexpr.WriteBinary(w, s)
+		},
+	})
+	Register(Format{
+		Name:        "dot",
+		Description: "graphviz digraph of the structure",
+		Extension:   "dot",
+		Write: func(w io.Writer, v any) error {
+			g, err := graph(v)
+			if err != nil {
+				return err
+			}
+			return viz.WriteDOT(w, "sexp", g)
+		},
+	})
+	Register(Format{
+		Name:        "mermaid",
+		Description: "mermaid flowchart of the structure",
+		Extension:   "mmd",
+		Write: func(w io.Writer, v any) error {
+			g, err := graph(v)
+			if err != nil {
+				return err
+			}
+			return viz.WriteMermaid(w, g)
+		},
+	})
+	Register(Format{
+		Name:        "graphml",
+		Description: "GraphML document of the structure",
+		Extension:   "graphml",
+		Write: func(w io.Writer, v any) error {
+			g, err := graph(v)
+			if err != nil {
+				return err
+			}
+			return viz.WriteGraphML(w, g)
+		},
+	})
+}
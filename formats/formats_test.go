@@ -0,0 +1,175 @@
+package formats
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mjsottile/gocode/sexpr"
+	"github.com/mjsottile/gocode/viz"
+	"github.com/mjsottile/gocode/yamlconv"
+)
+
+var builtin = []string{"binary", "csexp", "dot", "graphml", "mermaid", "sexpr", "xml", "yaml", "json"}
+
+func TestRegistry(t *testing.T) {
+	names := Names()
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("Names() = %v, not sorted", names)
+	}
+	for _, name := range builtin {
+		f, ok := Lookup(name)
+		if !ok || f.Name != name || f.Description == "" || f.Extension == "" {
+			t.Errorf("Lookup(%s) = %+v, %v", name, f, ok)
+		}
+	}
+	if _, ok := Lookup("toml"); ok {
+		t.Errorf("Lookup found a format that was never registered")
+	}
+	if err := Write(io.Discard, "toml", nil); err == nil || !strings.Contains(err.Error(), "unknown format") {
+		t.Errorf("Write to an unknown format = %v", err)
+	}
+
+	// once per process, as formats are
+	if _, ok := Lookup("test-count"); !ok {
+		Register(Format{Name: "test-count", Write: func(w io.Writer, v any) error {
+			s, err := forms(v)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, strings.Repeat("*", len(s.Children())))
+			return err
+		}})
+	}
+	var b strings.Builder
+	if err := Write(&b, "test-count", parse(t, "(a b c)")); err != nil || b.String() != "***" {
+		t.Errorf("the registered format wrote %q, %v", b.String(), err)
+	}
+	if i := sort.SearchStrings(Names(), "test-count"); i == len(Names()) || Names()[i] != "test-count" {
+		t.Errorf("Names() = %v, without the format registered", Names())
+	}
+
+	for _, f := range []Format{
+		{Write: func(io.Writer, any) error { return nil }},
+		{Name: "test-nowrite"},
+		{Name: "sexpr", Write: func(io.Writer, any) error { return nil }},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register(%+v) didn't panic", f)
+				}
+			}()
+			Register(f)
+		}()
+	}
+}
+
+func parse(t *testing.T, src string) *sexpr.Sexpr {
+	t.Helper()
+	forms, err := sexpr.ParseAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sexpr.NewForms(forms...)
+}
+
+// the s-expression formats write something their readers take back to
+// the same forms
+func TestRoundTrip(t *testing.T) {
+	in := parse(t, `(config (name "demo") (port 8080)) (p :class "x" "text")`)
+	read := map[string]func([]byte) (*sexpr.Sexpr, error){
+		"sexpr": func(b []byte) (*sexpr.Sexpr, error) {
+			forms, err := sexpr.ParseAll(string(b))
+			return sexpr.NewForms(forms...), err
+		},
+		"binary": func(b []byte) (*sexpr.Sexpr, error) { return sexpr.ReadBinary(bytes.NewReader(b)) },
+		"yaml": func(b []byte) (*sexpr.Sexpr, error) {
+			docs, err := yamlconv.Decode(b)
+			if err != nil || len(docs) != 1 {
+				return nil, err
+			}
+			return docs[0], nil
+		},
+	}
+	for name, read := range read {
+		var b bytes.Buffer
+		if err := Write(&b, name, in); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		out, err := read(b.Bytes())
+		if err != nil || !sexpr.EqualForms(out, in) {
+			t.Errorf("%s wrote\n%s\nwhich reads back as %v, %v", name, b.Bytes(), out, err)
+		}
+	}
+
+	// csexp has octet strings rather than kinds of atom, so "demo" and
+	// demo are the same; what it wrote is what it reads
+	var b bytes.Buffer
+	if err := Write(&b, "csexp", in); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := sexpr.ParseCsexp(b.Bytes()); err != nil {
+		t.Error(err)
+	} else if again, _ := sexpr.EncodeCsexp(out); !bytes.Equal(again, b.Bytes()) {
+		t.Errorf("csexp wrote %s, which reads back as %s", b.Bytes(), again)
+	}
+
+	// xml only writes lists headed by element names, so give it those
+	in = parse(t, `(p :class "x" "text" (b "bold"))`)
+	b.Reset()
+	if err := Write(&b, "xml", in); err != nil {
+		t.Fatal(err)
+	}
+	out, err := sexpr.FromXML(b.Bytes())
+	if err != nil || !sexpr.EqualForms(out, in) {
+		t.Errorf("xml wrote\n%s\nwhich reads back as %v, %v", b.Bytes(), out, err)
+	}
+
+	b.Reset()
+	if err := Write(&b, "json", parse(t, `(a "b" 1) c`)); err != nil {
+		t.Fatal(err)
+	}
+	// atoms as their text, quotes and all
+	if want := `[["a","\"b\"","1"],"c"]` + "\n"; b.String() != want {
+		t.Errorf("json wrote %s, want %s", b.String(), want)
+	}
+}
+
+// the graph formats draw s-expressions and any other viz.Graph
+func TestGraphs(t *testing.T) {
+	g := &viz.Digraph{}
+	g.AddNode("a", "first")
+	g.AddNode("b", "second")
+	g.AddEdge("a", "b", "to")
+	for _, name := range []string{"dot", "mermaid", "graphml"} {
+		for _, v := range []any{g, parse(t, "(first second)")} {
+			var b strings.Builder
+			if err := Write(&b, name, v); err != nil {
+				t.Errorf("%s of %T: %v", name, v, err)
+				continue
+			}
+			if !strings.Contains(b.String(), "first") || !strings.Contains(b.String(), "second") {
+				t.Errorf("%s of %T wrote\n%s", name, v, b.String())
+			}
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	for _, name := range builtin {
+		for _, v := range []any{42, "(a b)", nil} {
+			if err := Write(io.Discard, name, v); !errors.Is(err, ErrUnsupported) {
+				t.Errorf("%s of %T = %v, want ErrUnsupported", name, v, err)
+			}
+		}
+	}
+	// s-expression formats don't take graphs
+	if err := Write(io.Discard, "json", &viz.Digraph{}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("json of a graph = %v, want ErrUnsupported", err)
+	}
+}
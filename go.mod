@@ -0,0 +1,3 @@
+module github.com/mjsottile/gocode
+
+go 1.22
@@ -0,0 +1,134 @@
+// Package sexprutil holds helpers shared by the sexpr command-line tools.
+package sexprutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+// Forms returns s and the elements following it, which for the result of
+// sexpr.Parse are the top-level forms of the input.
+func Forms(s *sexpr.Sexpr) []*sexpr.Sexpr {
+	var out []*sexpr.Sexpr
+	for cur := s; cur != nil; cur = cur.Next() {
+		out = append(out, cur)
+	}
+	return out
+}
+
+// ParsePath parses a path of dot-separated, 0-based indices such as
+// "0.2.1": the first index picks a top-level form and each following
+// one an element of the list selected so far.
+func ParsePath(p string) ([]int, error) {
+	if p == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+	parts := strings.Split(p, ".")
+	path := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("bad path component %q in %q", part, p)
+		}
+		path[i] = n
+	}
+	return path, nil
+}
+
+// Select follows path (see ParsePath) through a list of top-level forms.
+func Select(forms []*sexpr.Sexpr, path []int) (*sexpr.Sexpr, error) {
+	elems := forms
+	var cur *sexpr.Sexpr
+	for depth, idx := range path {
+		if depth > 0 {
+			if !cur.IsList() {
+				return nil, fmt.Errorf("path %v: element at depth %d is not a list", path, depth)
+			}
+			elems = cur.Children()
+		}
+		if idx >= len(elems) {
+			return nil, fmt.Errorf("path %v: index %d out of range (%d elements)", path, idx, len(elems))
+		}
+		cur = elems[idx]
+	}
+	return cur, nil
+}
+
+// StripComments removes ; line comments and #| |# block comments from
+// src, by the same rules as the lexer: strings and character literals
+// are left alone, block comments nest, and #| only opens one at the
+// start of a token, which is also where the lexer puts the end of a
+// quote prefix.  the newline ending a line comment is kept so line
+// numbers don't shift.
+func StripComments(src string) string {
+	var b strings.Builder
+	tokenStart := true
+	for i := 0; i < len(src); {
+		c := src[i]
+		atStart := tokenStart
+		tokenStart = strings.IndexByte(" \t\r\n()\"", c) >= 0 ||
+			atStart && (strings.IndexByte("'`,", c) >= 0 || c == '@' && i > 0 && src[i-1] == ',')
+		switch {
+		case src[i] == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j, len(src))
+			if j < len(src) {
+				j++
+			}
+			b.WriteString(src[i:j])
+			i = j
+		case atStart && strings.HasPrefix(src[i:], `#\`):
+			// a character literal; #\; and #\" are not a comment or a
+			// string
+			j := min(i+3, len(src))
+			b.WriteString(src[i:j])
+			i = j
+		case src[i] == ';':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case atStart && strings.HasPrefix(src[i:], "#|"):
+			end := blockEnd(src, i)
+			// keep the newlines so positions after the comment still
+			// point at the right line
+			b.WriteString(strings.Repeat("\n", strings.Count(src[i:end], "\n")))
+			b.WriteByte(' ')
+			i = end
+			tokenStart = true
+		default:
+			b.WriteByte(src[i])
+			i++
+		}
+	}
+	return b.String()
+}
+
+// the offset just past the (possibly nested) block comment starting at
+// src[i], or len(src) if it isn't closed
+func blockEnd(src string, i int) int {
+	nest := 0
+	for i < len(src)-1 {
+		switch src[i : i+2] {
+		case "#|":
+			nest++
+			i += 2
+		case "|#":
+			i += 2
+			if nest--; nest == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return len(src)
+}
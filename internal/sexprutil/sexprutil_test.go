@@ -0,0 +1,49 @@
+package sexprutil
+
+import (
+	"testing"
+
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"a ; c\nb", "a \nb"},
+		{"(a #| x |# b)", "(a   b)"},
+		{`"a;b" c`, `"a;b" c`},
+		{`#\; a`, `#\; a`},
+		{`(a '#\; b)`, `(a '#\; b)`},
+		{"(`#\\; ,#\\; ,@#\\;)", "(`#\\; ,#\\; ,@#\\;)"},
+		{`a'#\; x`, `a'#\`},
+		{"x#|y|# z", "x#|y|# z"},
+	}
+	for _, tt := range tests {
+		if got := StripComments(tt.src); got != tt.want {
+			t.Errorf("StripComments(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+// stripping comments never changes what parses
+func TestStripCommentsParses(t *testing.T) {
+	srcs := []string{
+		`(a '#\; b) ; trailing`,
+		"(x #| nested #| c |# |# ,@#\\| y)",
+		"'#\\\" ; c\n`(#\\; \"s;\")",
+	}
+	for _, src := range srcs {
+		want, err := sexpr.ParseAll(src)
+		if err != nil {
+			t.Fatalf("ParseAll(%q): %v", src, err)
+		}
+		got, err := sexpr.ParseAll(StripComments(src))
+		if err != nil {
+			t.Fatalf("ParseAll(StripComments(%q)): %v", src, err)
+		}
+		if !sexpr.EqualForms(sexpr.NewForms(want...), sexpr.NewForms(got...)) {
+			t.Errorf("StripComments(%q) = %q", src, StripComments(src))
+		}
+	}
+}
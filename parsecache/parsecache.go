@@ -0,0 +1,170 @@
+/*
+Package parsecache remembers parse trees by the digest of the text they
+were parsed from, for services that parse the same few documents
+(templates, configs) over and over.  trees are kept serialized in the
+binary format (see sexpr.WriteBinary), in an in-memory LRU bounded by
+bytes and optionally in a castore.Blobs behind it, such as a
+castore.DirBlobs, so they survive restarts and can be shared between
+processes.
+
+a hit decodes a fresh tree, positions and all, so callers own what they
+get back and may change it without touching the cache or each other.
+decoding is several times cheaper than parsing but not free; a caller
+that never changes its trees can do better by keeping them itself.
+*/
+package parsecache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mjsottile/gocode/castore"
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+// Stats counts how lookups went.
+type Stats struct {
+	Hits     int64 // served from memory
+	DiskHits int64 // served from the Blobs, then kept in memory
+	Misses   int64 // parsed
+	Entries  int   // trees in memory
+	Bytes    int64 // their serialized size
+}
+
+// Cache maps input digests to parse trees.  it is safe for concurrent
+// use.  two goroutines missing on the same input at once both parse it.
+type Cache struct {
+	maxBytes int64
+	disk     castore.Blobs
+
+	mu    sync.Mutex
+	size  int64
+	lru   *list.List // of *entry, most recently used first
+	index map[sexpr.Hash]*list.Element
+
+	hits, diskHits, misses atomic.Int64
+}
+
+type entry struct {
+	key  sexpr.Hash
+	data []byte
+}
+
+// New returns a Cache keeping up to maxBytes of serialized trees in
+// memory (none if maxBytes <= 0) in front of disk, which may be nil.
+// the Blobs is keyed by input digest, not by the content hash castore
+// uses, so it shouldn't be shared with a castore.Store.
+func New(maxBytes int64, disk castore.Blobs) *Cache {
+	return &Cache{
+		maxBytes: maxBytes,
+		disk:     disk,
+		lru:      list.New(),
+		index:    make(map[sexpr.Hash]*list.Element),
+	}
+}
+
+// Parse is like sexpr.Parse, but returns a copy of the cached tree if
+// input has been parsed before.  inputs that fail to parse aren't
+// cached.
+func (c *Cache) Parse(input string) (*sexpr.Sexpr, error) {
+	return c.ParseContext(context.Background(), input)
+}
+
+// ParseContext is Parse with a context, as sexpr.ParseContext.
+func (c *Cache) ParseContext(ctx context.Context, input string) (*sexpr.Sexpr, error) {
+	key := sexpr.Hash(sha256.Sum256([]byte(input)))
+	if data := c.lookup(key); data != nil {
+		if s, err := sexpr.ReadBinary(bytes.NewReader(data)); err == nil {
+			return s, nil
+		}
+		// a damaged disk entry; parse again and overwrite it
+		c.forget(key)
+	}
+	c.misses.Add(1)
+	s, err := sexpr.ParseContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := sexpr.WriteBinary(&b, s); err != nil {
+		return s, nil
+	}
+	c.add(key, b.Bytes())
+	if c.disk != nil {
+		// the cache is an optimization: a disk that can't be written
+		// to only costs a parse next time
+		c.disk.Put(key, b.Bytes())
+	}
+	return s, nil
+}
+
+// the serialized tree for key, from memory or disk, or nil
+func (c *Cache) lookup(key sexpr.Hash) []byte {
+	c.mu.Lock()
+	if el, ok := c.index[key]; ok {
+		c.lru.MoveToFront(el)
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return el.Value.(*entry).data
+	}
+	c.mu.Unlock()
+	if c.disk == nil {
+		return nil
+	}
+	data, err := c.disk.Get(key)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	c.diskHits.Add(1)
+	c.add(key, data)
+	return data
+}
+
+func (c *Cache) add(key sexpr.Hash, data []byte) {
+	n := int64(len(data))
+	if n > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.index[key]; ok {
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.index[key] = c.lru.PushFront(&entry{key: key, data: data})
+	c.size += n
+	for c.size > c.maxBytes {
+		el := c.lru.Back()
+		e := el.Value.(*entry)
+		c.lru.Remove(el)
+		delete(c.index, e.key)
+		c.size -= int64(len(e.data))
+	}
+}
+
+func (c *Cache) forget(key sexpr.Hash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.index[key]; ok {
+		c.lru.Remove(el)
+		delete(c.index, key)
+		c.size -= int64(len(el.Value.(*entry).data))
+	}
+}
+
+// Stats returns the counts so far.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Hits:     c.hits.Load(),
+		DiskHits: c.diskHits.Load(),
+		Misses:   c.misses.Load(),
+		Entries:  c.lru.Len(),
+		Bytes:    c.size,
+	}
+}
@@ -0,0 +1,176 @@
+package parsecache
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/mjsottile/gocode/castore"
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+// an error if the elements starting at a and b differ, positions
+// included
+func same(a, b *sexpr.Sexpr) error {
+	for ; a != nil && b != nil; a, b = a.Next(), b.Next() {
+		if !sexpr.Equal(a, b) || a.Position() != b.Position() || a.End() != b.End() {
+			return fmt.Errorf("%s at %v-%d, want %s at %v-%d", a.Text(), a.Position(), a.End(), b.Text(), b.Position(), b.End())
+		}
+		ak, bk := a.Children(), b.Children()
+		for i := range ak {
+			if err := same(ak[i], bk[i]); err != nil {
+				return err
+			}
+		}
+		if a.Tail() != nil {
+			if err := same(a.Tail(), b.Tail()); err != nil {
+				return err
+			}
+		}
+	}
+	if a != nil || b != nil {
+		return fmt.Errorf("%v, want %v", a, b)
+	}
+	return nil
+}
+
+var inputs = []string{
+	"(a b c)",
+	"; config\n(server\n  (host \"example.org\")\n  (port 8080)\n  (x . y))",
+	"(#t 1/3 |YWJj| :key)",
+	"atom",
+}
+
+func TestParse(t *testing.T) {
+	c := New(1<<20, nil)
+	for round := 0; round < 3; round++ {
+		for _, in := range inputs {
+			want, err := sexpr.Parse(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := c.Parse(in)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", in, err)
+			}
+			if err := same(got, want); err != nil {
+				t.Errorf("round %d, Parse(%q): %v", round, in, err)
+			}
+		}
+	}
+	st := c.Stats()
+	if st.Misses != int64(len(inputs)) || st.Hits != int64(2*len(inputs)) || st.Entries != len(inputs) {
+		t.Errorf("Stats() = %+v", st)
+	}
+
+	// every hit is a tree of its own
+	a, _ := c.Parse(inputs[0])
+	b, _ := c.Parse(inputs[0])
+	if a == b || a.Children()[0] == b.Children()[0] {
+		t.Errorf("two hits share nodes")
+	}
+}
+
+func TestErrorsNotCached(t *testing.T) {
+	c := New(1<<20, castore.NewMemBlobs())
+	for i := 0; i < 2; i++ {
+		if _, err := c.Parse("(a"); err == nil {
+			t.Fatal("Parse of (a succeeded")
+		}
+	}
+	if st := c.Stats(); st.Misses != 2 || st.Entries != 0 {
+		t.Errorf("Stats() = %+v, want two misses and nothing kept", st)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	c := New(0, nil)
+	c.Parse("(a)")
+	c.Parse("(a)")
+	if st := c.Stats(); st.Misses != 2 || st.Entries != 0 || st.Bytes != 0 {
+		t.Errorf("with no memory, Stats() = %+v", st)
+	}
+
+	docs := make([]string, 20)
+	for i := range docs {
+		docs[i] = fmt.Sprintf("(doc %02d (some more atoms to give it size))", i)
+	}
+	one := New(1<<20, nil)
+	one.Parse(docs[0])
+	size := one.Stats().Bytes
+	c = New(5*size, nil)
+	for _, d := range docs {
+		c.Parse(d)
+	}
+	st := c.Stats()
+	if st.Entries != 5 || st.Bytes > 5*size {
+		t.Errorf("Stats() = %+v, want 5 entries of %d bytes", st, size)
+	}
+	// the most recent five are the ones kept
+	c.Parse(docs[len(docs)-1])
+	c.Parse(docs[0])
+	if st2 := c.Stats(); st2.Hits != st.Hits+1 || st2.Misses != st.Misses+1 {
+		t.Errorf("after a recent and an evicted input, Stats() = %+v, from %+v", st2, st)
+	}
+}
+
+func TestDisk(t *testing.T) {
+	disk, err := castore.NewDirBlobs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	New(1<<20, disk).Parse(inputs[1])
+	c := New(1<<20, disk)
+	want, _ := sexpr.Parse(inputs[1])
+	got, err := c.Parse(inputs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := same(got, want); err != nil {
+		t.Error(err)
+	}
+	c.Parse(inputs[1])
+	if st := c.Stats(); st.DiskHits != 1 || st.Hits != 1 || st.Misses != 0 {
+		t.Errorf("Stats() = %+v, want a disk hit and then a memory hit", st)
+	}
+
+	// a damaged entry is parsed again
+	key := sexpr.Hash(sha256.Sum256([]byte(inputs[2])))
+	disk.Put(key, []byte("not a tree"))
+	c = New(1<<20, disk)
+	want, _ = sexpr.Parse(inputs[2])
+	got, err = c.Parse(inputs[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := same(got, want); err != nil {
+		t.Error(err)
+	}
+	if st := c.Stats(); st.Misses != 1 {
+		t.Errorf("Stats() = %+v, want a miss for the damaged entry", st)
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	c := New(1<<10, castore.NewMemBlobs())
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				in := fmt.Sprintf("(n %d)", (g+i)%30)
+				s, err := c.Parse(in)
+				if err != nil || s.Text() != in {
+					t.Errorf("Parse(%q) = %v, %v", in, s, err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if st := c.Stats(); st.Bytes > 1<<10 {
+		t.Errorf("Stats() = %+v, over the 1024 bytes allowed", st)
+	}
+}
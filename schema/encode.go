@@ -0,0 +1,148 @@
+package schema
+
+import (
+	"bytes"
+
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+// how wide Encode and Skeleton let lines get
+const lineWidth = 72
+
+func atom(v string) *sexpr.Sexpr { return sexpr.NewAtom(v) }
+
+// double quote text for a string atom
+func quote(text string) *sexpr.Sexpr { return sexpr.NewString(text) }
+
+func (t *Type) sexpr() *sexpr.Sexpr {
+	switch t.Kind {
+	case Struct:
+		return atom(t.Struct)
+	case List, Map:
+		return sexpr.NewList(atom(t.Kind.String()), t.Elem.sexpr())
+	}
+	return atom(t.Kind.String())
+}
+
+// Encode writes the schema as a schema document that Parse reads back,
+// laid out like the example in the package comment.
+func (s *Schema) Encode() []byte {
+	var b bytes.Buffer
+	b.WriteString("(schema " + s.Name)
+	if s.Doc != "" {
+		b.WriteString("\n  " + sexpr.NewList(atom("doc"), quote(s.Doc)).Text())
+	}
+	for _, st := range s.Structs {
+		b.WriteString("\n  (struct " + st.Name)
+		if st.Doc != "" {
+			b.WriteString("\n    " + sexpr.NewList(atom("doc"), quote(st.Doc)).Text())
+		}
+		for _, f := range st.Fields {
+			fp := []*sexpr.Sexpr{atom("field"), atom(f.Name), f.Type.sexpr()}
+			if f.Required {
+				fp = append(fp, sexpr.NewList(atom("required")))
+			}
+			if f.Default != nil {
+				fp = append(fp, sexpr.NewList(atom("default"), atom(f.Default.Value())))
+			}
+			if f.Doc != "" {
+				fp = append(fp, sexpr.NewList(atom("doc"), quote(f.Doc)))
+			}
+			b.WriteString("\n    " + sexpr.NewList(fp...).Text())
+		}
+		b.WriteByte(')')
+	}
+	b.WriteString(")\n")
+	return b.Bytes()
+}
+
+// Skeleton writes an example document for the struct named root (the
+// first struct if root is ""), with every field filled in with its
+// default or a placeholder, as a starting point for writing one.  it
+// uses the layout documents are read in: one (name value) entry per
+// field, with the entries of a struct-valued field, the elements of a
+// list and the (key value) pairs of a map following the name in place
+// of a single value.  lists and maps get one example element.  it
+// returns nil if there is no such struct.
+func (s *Schema) Skeleton(root string) []byte {
+	st := s.Lookup(root)
+	if root == "" && len(s.Structs) > 0 {
+		st = s.Structs[0]
+	}
+	if st == nil {
+		return nil
+	}
+	var b bytes.Buffer
+	for _, e := range s.entries(st, map[string]bool{}) {
+		b.WriteString(sexpr.Format(e, sexpr.FormatOptions{Width: lineWidth}))
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// example (name value) entries for the fields of st.  active holds the
+// structs being expanded, so recursive types stop instead of looping.
+func (s *Schema) entries(st *StructType, active map[string]bool) []*sexpr.Sexpr {
+	active[st.Name] = true
+	defer delete(active, st.Name)
+	var out []*sexpr.Sexpr
+	for _, f := range st.Fields {
+		e := append([]*sexpr.Sexpr{atom(f.Name)}, s.example(f.Type, f.Default, active)...)
+		out = append(out, sexpr.NewList(e...))
+	}
+	return out
+}
+
+// the elements following a field name for a value of type t
+func (s *Schema) example(t *Type, def *sexpr.Sexpr, active map[string]bool) []*sexpr.Sexpr {
+	switch t.Kind {
+	case Struct:
+		if active[t.Struct] {
+			return nil
+		}
+		return s.entries(s.Lookup(t.Struct), active)
+	case List:
+		return []*sexpr.Sexpr{s.element(t.Elem, active)}
+	case Map:
+		kv := append([]*sexpr.Sexpr{atom("key")}, s.example(t.Elem, nil, active)...)
+		return []*sexpr.Sexpr{sexpr.NewList(kv...)}
+	}
+	if def != nil && t.Kind == Bool {
+		// any spelling ParseBool takes, written as a boolean atom
+		if b, _ := ParseBool(def.Value()); b {
+			return []*sexpr.Sexpr{atom("#t")}
+		}
+		return []*sexpr.Sexpr{atom("#f")}
+	}
+	if def != nil {
+		return []*sexpr.Sexpr{atom(def.Value())}
+	}
+	return []*sexpr.Sexpr{placeholder(t.Kind)}
+}
+
+// an example value of type t standing on its own, as a list element
+func (s *Schema) element(t *Type, active map[string]bool) *sexpr.Sexpr {
+	switch t.Kind {
+	case Struct, List, Map:
+		return sexpr.NewList(s.example(t, nil, active)...)
+	}
+	return placeholder(t.Kind)
+}
+
+func placeholder(k Kind) *sexpr.Sexpr {
+	switch k {
+	case String:
+		return atom(`""`)
+	case Int:
+		return atom("0")
+	case Float:
+		return atom("0.0")
+	case Bool:
+		return atom("#f")
+	case Bytes:
+		return atom("||")
+	case Rational:
+		return atom("0/1")
+	}
+	return sexpr.NewList()
+}
@@ -0,0 +1,147 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+type switches struct {
+	Verbose bool
+	Flags   []bool
+	Name    string
+}
+
+// booleans in a skeleton are boolean atoms, placeholders and defaults
+// alike, so the skeleton reads back into the type it was made from
+func TestSkeletonBooleans(t *testing.T) {
+	s, err := Parse(`(schema x (struct x
+	  (field quiet bool)
+	  (field color bool (default yes))
+	  (field trace bool (default off))
+	  (field modes (list bool))))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skel := s.Skeleton("")
+	want := "(quiet #f)\n(color #t)\n(trace #f)\n(modes #f)\n"
+	if string(skel) != want {
+		t.Errorf("Skeleton wrote\n%s\nwant\n%s", skel, want)
+	}
+	doc, err := sexpr.ParseAll(string(skel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conforms(s, s.Structs[0], doc); err != nil {
+		t.Errorf("%s: %v", skel, err)
+	}
+
+	s, err = FromType("switches", reflect.TypeOf(switches{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	skel = s.Skeleton("")
+	var v switches
+	if err := sexpr.Unmarshal(skel, &v); err != nil {
+		t.Fatalf("%s: %v", skel, err)
+	}
+	if !reflect.DeepEqual(v, switches{Flags: []bool{false}}) {
+		t.Errorf("%s read back as %+v", skel, v)
+	}
+}
+
+// Encode writes a schema the way the package comment lays one out, and
+// Parse reads back what it wrote
+func TestEncode(t *testing.T) {
+	s, err := Parse(serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(s.Encode()); got != serverConfig {
+		t.Errorf("Encode gave\n%s\nwant\n%s", got, serverConfig)
+	}
+
+	s = &Schema{Name: "x", Doc: "a \"quoted\"\nline", Structs: []*StructType{{
+		Name: "s",
+		Fields: []*Field{
+			{Name: "when", Type: &Type{Kind: Map, Elem: &Type{Kind: List, Elem: &Type{Kind: Rational}}}},
+			{Name: "blob", Type: &Type{Kind: Bytes}, Required: true, Doc: `back\slash`},
+		},
+	}}}
+	back, err := Parse(string(s.Encode()))
+	if err != nil {
+		t.Fatalf("%s: %v", s.Encode(), err)
+	}
+	if back.Doc != s.Doc || back.Structs[0].Fields[1].Doc != `back\slash` ||
+		back.Structs[0].Fields[0].Type.String() != "(map (list rational))" {
+		t.Errorf("%s read back as %+v", s.Encode(), back)
+	}
+	if string(back.Encode()) != string(s.Encode()) {
+		t.Errorf("Encode and Parse changed\n%s\nto\n%s", s.Encode(), back.Encode())
+	}
+}
+
+func TestSkeleton(t *testing.T) {
+	s, err := Parse(serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `(host "")
+(port 8080)
+(tls #f)
+(routes ((path "") (weight 1.0) (headers (key "")) (extra ())))
+`
+	skel := s.Skeleton("")
+	if string(skel) != want {
+		t.Errorf("Skeleton gave\n%s\nwant\n%s", skel, want)
+	}
+	for _, root := range []string{"server", "route"} {
+		skel := s.Skeleton(root)
+		doc, err := sexpr.ParseAll(string(skel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := conforms(s, s.Lookup(root), doc); err != nil {
+			t.Errorf("Skeleton(%s) gave\n%s: %v", root, skel, err)
+		}
+	}
+	if skel := s.Skeleton("client"); skel != nil {
+		t.Errorf("Skeleton of a missing struct gave\n%s", skel)
+	}
+
+	// a struct containing itself is expanded once
+	s, err = Parse(`(schema t (struct node
+	  (field name string)
+	  (field kids (list node))
+	  (field parent node)))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `(name "")
+(kids ())
+(parent)
+`
+	if skel := s.Skeleton(""); string(skel) != want {
+		t.Errorf("Skeleton of a recursive struct gave\n%s\nwant\n%s", skel, want)
+	}
+
+	// long entries are broken over lines
+	s, err = Parse(`(schema w
+	  (struct w (field endpoints (list endpoint)))
+	  (struct endpoint
+	    (field service-name string) (field health-check-path string)
+	    (field retry-backoff-seconds float) (field allowed-origins (list string))))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(s.Skeleton("")), "\n"); n < 2 {
+		t.Errorf("Skeleton wrote a long entry on %d line", n)
+	}
+	for _, line := range strings.Split(string(s.Skeleton("")), "\n") {
+		if len(line) > lineWidth {
+			t.Errorf("Skeleton wrote a %d byte line: %s", len(line), line)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// words kept in upper case in Go names, as golint would have them
+var initialisms = map[string]bool{
+	"api": true, "dns": true, "http": true, "https": true, "id": true,
+	"ip": true, "json": true, "tcp": true, "tls": true, "ttl": true,
+	"udp": true, "uri": true, "url": true, "uuid": true, "xml": true,
+}
+
+// GoName turns a schema name like listen-addr into the exported Go
+// name ListenAddr.
+func GoName(name string) string {
+	var b strings.Builder
+	for _, w := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if initialisms[strings.ToLower(w)] {
+			b.WriteString(strings.ToUpper(w))
+			continue
+		}
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	if b.Len() == 0 || unicode.IsDigit([]rune(b.String())[0]) {
+		return "X" + b.String()
+	}
+	return b.String()
+}
+
+// the Go type for t, as an element or required field
+func goType(t *Type) string {
+	switch t.Kind {
+	case String:
+		return "string"
+	case Int:
+		return "int64"
+	case Float:
+		return "float64"
+	case Bool:
+		return "bool"
+	case Sexpr:
+		return "*sexpr.Sexpr"
+	case Bytes:
+		return "[]byte"
+	case Rational:
+		return "*big.Rat"
+	case Struct:
+		return GoName(t.Struct)
+	case List:
+		return "[]" + goType(t.Elem)
+	case Map:
+		return "map[string]" + goType(t.Elem)
+	}
+	panic("schema: unknown kind " + t.Kind.String())
+}
+
+// whether an optional field of type t is held through a pointer, so
+// that unset can be told apart from the zero value
+func pointerField(f *Field) bool {
+	switch f.Type.Kind {
+	case String, Int, Float, Bool, Struct:
+		return !f.Required
+	}
+	return false
+}
+
+// the Go literal for a field's default (or its type's zero value)
+func goDefault(f *Field) string {
+	if f.Default == nil {
+		switch f.Type.Kind {
+		case String:
+			return `""`
+		case Int, Float:
+			return "0"
+		case Bool:
+			return "false"
+		}
+		return "nil"
+	}
+	v := f.Default.Value()
+	switch f.Type.Kind {
+	case String:
+		return strconv.Quote(unquote(f.Default))
+	case Int:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return strconv.FormatInt(n, 10)
+	case Float:
+		x, _ := strconv.ParseFloat(v, 64)
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case Bool:
+		b, _ := ParseBool(v)
+		return strconv.FormatBool(b)
+	}
+	return "nil"
+}
+
+func comment(b *bytes.Buffer, indent, text string) {
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(b, "%s// %s\n", indent, strings.TrimSpace(line))
+	}
+}
+
+// GoSource generates a Go file declaring a struct type for each struct
+// in the schema, in package pkg.  source names the schema file for the
+// generated-code header.
+//
+// int and float fields are int64 and float64, bytes fields []byte,
+// rational fields *big.Rat and sexpr fields *sexpr.Sexpr.  required
+// fields hold their value directly.  optional string, int, float, bool
+// and struct fields are pointers, nil when the document leaves them out;
+// optional lists, maps and bytes, rational and sexpr fields are simply
+// nil.  every field
+// gets a nil-safe Get method returning its value, or for an unset
+// optional field its default (the zero value if it has none).  fields
+// are tagged `sexpr:"name"`, plus ",omitempty" when optional, with the
+// name used in documents.
+func (s *Schema) GoSource(pkg, source string) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by sexpr-schema from %s; DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	var imports []string
+	if s.uses(Rational) {
+		imports = append(imports, `"math/big"`)
+	}
+	if s.uses(Sexpr) {
+		imports = append(imports, `"github.com/mjsottile/gocode/sexpr"`)
+	}
+	switch len(imports) {
+	case 0:
+	case 1:
+		fmt.Fprintf(&b, "import %s\n\n", imports[0])
+	default:
+		fmt.Fprintf(&b, "import (\n%s\n)\n\n", strings.Join(imports, "\n"))
+	}
+
+	seen := make(map[string]string)
+	for _, st := range s.Structs {
+		name := GoName(st.Name)
+		if prev, ok := seen[name]; ok {
+			return nil, fmt.Errorf("structs %s and %s both become %s in Go", prev, st.Name, name)
+		}
+		seen[name] = st.Name
+
+		fmt.Fprintf(&b, "// %s is struct %s of schema %s.\n", name, st.Name, s.Name)
+		if st.Doc != "" {
+			b.WriteString("//\n")
+			comment(&b, "", st.Doc)
+		}
+		fmt.Fprintf(&b, "type %s struct {\n", name)
+		fields := make(map[string]string)
+		for _, f := range st.Fields {
+			fn := GoName(f.Name)
+			if prev, ok := fields[fn]; ok {
+				return nil, fmt.Errorf("fields %s and %s of struct %s both become %s in Go", prev, f.Name, st.Name, fn)
+			}
+			fields[fn] = f.Name
+			if f.Doc != "" {
+				comment(&b, "\t", f.Doc)
+			}
+			typ := goType(f.Type)
+			if pointerField(f) {
+				typ = "*" + typ
+			}
+			tag := f.Name
+			if !f.Required {
+				tag += ",omitempty"
+			}
+			fmt.Fprintf(&b, "\t%s %s `sexpr:%s`\n", fn, typ, strconv.Quote(tag))
+		}
+		b.WriteString("}\n\n")
+
+		for _, f := range st.Fields {
+			fn := GoName(f.Name)
+			typ := goType(f.Type)
+			ret := typ
+			if f.Type.Kind == Struct {
+				ret = "*" + typ
+			}
+			fmt.Fprintf(&b, "// Get%s returns %s", fn, f.Name)
+			if f.Default != nil {
+				fmt.Fprintf(&b, ", or %s if it is not set", goDefault(f))
+			}
+			b.WriteString(".\n")
+			fmt.Fprintf(&b, "func (x *%s) Get%s() %s {\n", name, fn, ret)
+			switch {
+			case f.Type.Kind == Struct && f.Required:
+				fmt.Fprintf(&b, "\tif x == nil {\n\t\treturn nil\n\t}\n\treturn &x.%s\n", fn)
+			case f.Type.Kind == Struct:
+				fmt.Fprintf(&b, "\tif x == nil {\n\t\treturn nil\n\t}\n\treturn x.%s\n", fn)
+			case pointerField(f):
+				fmt.Fprintf(&b, "\tif x == nil || x.%s == nil {\n\t\treturn %s\n\t}\n\treturn *x.%s\n", fn, goDefault(f), fn)
+			default:
+				fmt.Fprintf(&b, "\tif x == nil {\n\t\treturn %s\n\t}\n\treturn x.%s\n", goDefault(f), fn)
+			}
+			b.WriteString("}\n\n")
+		}
+	}
+	return format.Source(b.Bytes())
+}
+
+// whether any field type in the schema involves kind k
+func (s *Schema) uses(k Kind) bool {
+	var has func(*Type) bool
+	has = func(t *Type) bool {
+		return t.Kind == k || t.Elem != nil && has(t.Elem)
+	}
+	for _, st := range s.Structs {
+		for _, f := range st.Fields {
+			if has(f.Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package schema
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+var (
+	sexprType  = reflect.TypeOf((*sexpr.Sexpr)(nil))
+	bigIntType = reflect.TypeOf(big.Int{})
+	bigRatType = reflect.TypeOf(big.Rat{})
+)
+
+// FromType builds the schema describing documents that decode into
+// values of type t, which must be a struct or a pointer to one.  the
+// schema is named name; its first struct is t itself, followed by the
+// structs t refers to in the order they are found.
+//
+// field names come from `sexpr:"name"` tags, or else from the Go field
+// name written the document way (ListenAddr becomes listen-addr), and
+// fields tagged "-" or unexported are left out.  a field is optional if
+// it is a pointer, slice, map or *sexpr.Sexpr or is tagged omitempty,
+// and required otherwise, which matches the structs GoSource
+// generates.  a `sexprdoc:"..."` tag becomes the field's doc string.
+// defaults live in code rather than in types, so they can't be
+// recovered; add them to the schema by hand if they should be
+// documented.
+func FromType(name string, t reflect.Type) (*Schema, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("schema: %s is not a struct type", t)
+	}
+	r := &reflector{s: &Schema{Name: name}, names: make(map[reflect.Type]string)}
+	if _, err := r.structType(t, ""); err != nil {
+		return nil, err
+	}
+	return r.s, nil
+}
+
+type reflector struct {
+	s     *Schema
+	names map[reflect.Type]string
+}
+
+// DocName turns a Go name like ListenAddr into the name used in
+// documents, listen-addr.  it is sexpr.FieldName, so the names FromType
+// gives fields are the ones sexpr.Marshal writes.
+func DocName(goName string) string { return sexpr.FieldName(goName) }
+
+// add the struct t to the schema (once) and return its schema name.
+// hint names anonymous structs after the field holding them.
+func (r *reflector) structType(t reflect.Type, hint string) (string, error) {
+	if name, ok := r.names[t]; ok {
+		return name, nil
+	}
+	name := DocName(t.Name())
+	if name == "" {
+		name = hint
+	}
+	if name == "" || r.s.Lookup(name) != nil {
+		return "", fmt.Errorf("schema: can't find a unique name for %s", t)
+	}
+	st := &StructType{Name: name}
+	r.names[t] = name
+	r.s.Structs = append(r.s.Structs, st)
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag := sf.Tag.Get("sexpr")
+		if tag == "-" {
+			continue
+		}
+		fname, opts, _ := strings.Cut(tag, ",")
+		if fname == "" {
+			fname = DocName(sf.Name)
+		}
+		f := &Field{Name: fname, Doc: sf.Tag.Get("sexprdoc")}
+		typ, optional, err := r.typ(sf.Type, fname)
+		if err != nil {
+			return "", fmt.Errorf("schema: field %s of %s: %w", sf.Name, t, err)
+		}
+		f.Type = typ
+		f.Required = !optional && !hasOption(opts, "omitempty")
+		for _, g := range st.Fields {
+			if g.Name == fname {
+				return "", fmt.Errorf("schema: %s has two fields named %s", t, fname)
+			}
+		}
+		st.Fields = append(st.Fields, f)
+	}
+	return name, nil
+}
+
+func hasOption(opts, want string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == want {
+			return true
+		}
+	}
+	return false
+}
+
+// the schema type for t, and whether a field of type t can be left out.
+// the types sexpr.Marshal writes as a single atom, []byte and the big
+// numbers, are bytes, int and rational rather than lists and structs.
+func (r *reflector) typ(t reflect.Type, hint string) (*Type, bool, error) {
+	switch {
+	case t == sexprType:
+		return &Type{Kind: Sexpr}, true, nil
+	case t == bigIntType:
+		return &Type{Kind: Int}, false, nil
+	case t == bigRatType:
+		return &Type{Kind: Rational}, false, nil
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return &Type{Kind: Bytes}, true, nil
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		elem, _, err := r.typ(t.Elem(), hint)
+		return elem, true, err
+	case reflect.String:
+		return &Type{Kind: String}, false, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Type{Kind: Int}, false, nil
+	case reflect.Float32, reflect.Float64:
+		return &Type{Kind: Float}, false, nil
+	case reflect.Bool:
+		return &Type{Kind: Bool}, false, nil
+	case reflect.Struct:
+		name, err := r.structType(t, hint)
+		return &Type{Kind: Struct, Struct: name}, false, err
+	case reflect.Slice, reflect.Array:
+		elem, _, err := r.typ(t.Elem(), hint)
+		return &Type{Kind: List, Elem: elem}, t.Kind() == reflect.Slice, err
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, false, fmt.Errorf("map keys must be strings, not %s", t.Key())
+		}
+		elem, _, err := r.typ(t.Elem(), hint)
+		return &Type{Kind: Map, Elem: elem}, true, err
+	}
+	return nil, false, fmt.Errorf("%s has no schema type", t)
+}
@@ -0,0 +1,289 @@
+package schema
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+// the atom kinds a value of each scalar kind may be written as
+var atomKinds = map[Kind][]sexpr.AtomKind{
+	String:   {sexpr.String},
+	Int:      {sexpr.Integer},
+	Float:    {sexpr.Float},
+	Bool:     {sexpr.Boolean},
+	Bytes:    {sexpr.Bytes},
+	Rational: {sexpr.Rational, sexpr.Integer},
+}
+
+// an error if entries aren't a document for struct st of s
+func conforms(s *Schema, st *StructType, entries []*sexpr.Sexpr) error {
+	byName := make(map[string]*Field)
+	for _, f := range st.Fields {
+		byName[f.Name] = f
+	}
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		kids := e.Children()
+		if !e.IsList() || len(kids) == 0 {
+			return fmt.Errorf("%s: not an entry", e.Text())
+		}
+		f := byName[kids[0].Value()]
+		if f == nil {
+			return fmt.Errorf("%s: no field %s in %s", e.Text(), kids[0].Value(), st.Name)
+		}
+		seen[f.Name] = true
+		if err := checkValue(s, f.Type, kids[1:]); err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+	}
+	for _, f := range st.Fields {
+		if f.Required && !seen[f.Name] {
+			return fmt.Errorf("required field %s missing", f.Name)
+		}
+	}
+	return nil
+}
+
+// an error if the elements following a field name aren't a t
+func checkValue(s *Schema, t *Type, elems []*sexpr.Sexpr) error {
+	switch t.Kind {
+	case Struct:
+		return conforms(s, s.Lookup(t.Struct), elems)
+	case List:
+		for _, el := range elems {
+			if err := checkElement(s, t.Elem, el); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Map:
+		for _, el := range elems {
+			kids := el.Children()
+			if !el.IsList() || len(kids) == 0 {
+				return fmt.Errorf("%s: not a (key value) pair", el.Text())
+			}
+			if err := checkValue(s, t.Elem, kids[1:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(elems) != 1 {
+		return fmt.Errorf("%d values for a %s", len(elems), t)
+	}
+	return checkElement(s, t, elems[0])
+}
+
+// an error if el, standing on its own, isn't a t
+func checkElement(s *Schema, t *Type, el *sexpr.Sexpr) error {
+	switch t.Kind {
+	case Sexpr:
+		return nil
+	case Struct, List, Map:
+		if !el.IsList() {
+			return fmt.Errorf("%s: not a %s", el.Text(), t)
+		}
+		return checkValue(s, t, el.Children())
+	}
+	for _, k := range atomKinds[t.Kind] {
+		if el.AtomKind() == k {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is a %s, not a %s", el.Text(), el.AtomKind(), t)
+}
+
+type numbers struct {
+	Key      []byte
+	Keys     [][]byte
+	Count    big.Int
+	MaybeBig *big.Int
+	Share    big.Rat
+	Shares   []*big.Rat
+	Whole    big.Rat
+	Small    int
+	Ratio    float64
+	On       bool
+	Name     string
+}
+
+// FromType describes what Marshal writes, including the types Marshal
+// writes as single atoms
+func TestFromTypeMatchesMarshal(t *testing.T) {
+	s, err := FromType("numbers", reflect.TypeOf(numbers{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Structs) != 1 {
+		t.Errorf("FromType made structs for the atom types:\n%s", s.Encode())
+	}
+	want := map[string]string{
+		"key": "bytes", "keys": "(list bytes)", "count": "int", "maybe-big": "int",
+		"share": "rational", "shares": "(list rational)", "whole": "rational",
+	}
+	for _, f := range s.Structs[0].Fields {
+		if w, ok := want[f.Name]; ok && f.Type.String() != w {
+			t.Errorf("field %s has type %s, want %s", f.Name, f.Type, w)
+		}
+	}
+	v := numbers{
+		Key:      []byte("abc"),
+		Keys:     [][]byte{{1}, {2, 3}},
+		MaybeBig: new(big.Int).Lsh(big.NewInt(1), 100),
+		Share:    *big.NewRat(1, 3),
+		Shares:   []*big.Rat{big.NewRat(2, 3), big.NewRat(4, 1)},
+		Whole:    *big.NewRat(6, 2),
+		Ratio:    0.5,
+		Name:     "x",
+	}
+	v.Count.SetInt64(-7)
+	data, err := sexpr.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := sexpr.ParseAll(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conforms(s, s.Structs[0], doc); err != nil {
+		t.Errorf("%s\ndoesn't fit\n%s: %v", data, s.Encode(), err)
+	}
+	// and the schema survives being written out and read back
+	back, err := Parse(string(s.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(back.Encode()) != string(s.Encode()) {
+		t.Errorf("Encode and Parse changed\n%s", s.Encode())
+	}
+}
+
+func TestGoSourceAtomTypes(t *testing.T) {
+	s, err := Parse(`(schema x (struct x (field key bytes) (field share rational (required))))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := s.GoSource("x", "x.sexpr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`import "math/big"`,
+		"Key   []byte   `sexpr:\"key,omitempty\"`", "Share *big.Rat `sexpr:\"share\"`"} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("no %q in\n%s", want, src)
+		}
+	}
+}
+
+type listener struct {
+	Addr     string            `sexprdoc:"host:port to listen on"`
+	Timeout  float64           `sexpr:"timeout-secs,omitempty"`
+	TLS      *tlsConfig        `sexpr:"tls"`
+	Routes   []route           `sexprdoc:"checked in order"`
+	Env      map[string]string `sexpr:"env"`
+	Backup   *listener
+	Limits   struct{ Max int }
+	Ports    [2]uint16
+	Internal string `sexpr:"-"`
+	secret   string
+}
+
+type tlsConfig struct {
+	CertFile string
+}
+
+type route struct {
+	Path   string
+	Weight float32
+	Extra  *sexpr.Sexpr
+}
+
+func TestFromType(t *testing.T) {
+	s, err := FromType("listener-config", reflect.TypeOf(&listener{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `(schema listener-config
+  (struct listener
+    (field addr string (required) (doc "host:port to listen on"))
+    (field timeout-secs float)
+    (field tls tls-config)
+    (field routes (list route) (doc "checked in order"))
+    (field env (map string))
+    (field backup listener)
+    (field limits limits (required))
+    (field ports (list int) (required)))
+  (struct tls-config
+    (field cert-file string (required)))
+  (struct route
+    (field path string (required))
+    (field weight float (required))
+    (field extra sexpr))
+  (struct limits
+    (field max int (required))))
+`
+	if got := string(s.Encode()); got != want {
+		t.Errorf("FromType gave\n%s\nwant\n%s", got, want)
+	}
+	// what Marshal writes fits the schema
+	v := listener{
+		Addr:   ":443",
+		TLS:    &tlsConfig{CertFile: "c.pem"},
+		Routes: []route{{Path: "/", Weight: 2}, {Path: "/api", Extra: sexpr.NewList(sexpr.NewAtom("x"))}},
+		Env:    map[string]string{"home": "/root"},
+		Backup: &listener{Addr: ":80"},
+	}
+	data, err := sexpr.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := sexpr.ParseAll(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conforms(s, s.Structs[0], doc); err != nil {
+		t.Errorf("%s\ndoesn't fit\n%s: %v", data, s.Encode(), err)
+	}
+}
+
+type twoNames struct {
+	A string `sexpr:"x"`
+	B string `sexpr:"x"`
+}
+
+type (
+	intKeys  struct{ M map[int]string }
+	chanType struct{ C chan int }
+	funcType struct{ F func() }
+)
+
+type sameName struct {
+	Limits struct{ A int }
+	Other  struct{ B int } `sexpr:"limits-too"`
+	More   struct{ C int } `sexpr:"limits"`
+}
+
+func TestFromTypeErrors(t *testing.T) {
+	tests := []struct {
+		v    any
+		want string
+	}{
+		{42, "not a struct type"},
+		{intKeys{}, "map keys must be strings"},
+		{chanType{}, "has no schema type"},
+		{funcType{}, "has no schema type"},
+		{twoNames{}, "two fields named x"},
+		{sameName{}, "can't find a unique name"},
+	}
+	for _, tt := range tests {
+		_, err := FromType("x", reflect.TypeOf(tt.v))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("FromType(%T) = %v, want %q", tt.v, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+/*
+Package schema describes the shape of s-expression configuration
+documents and generates Go types for them, so the binding structs a
+program decodes into are written once, as a schema, instead of by hand
+in every program that reads the config.
+
+A schema is itself an s-expression document:
+
+	(schema server-config
+	  (doc "settings for the frontend server")
+	  (struct server
+	    (doc "one listening server")
+	    (field host string (required) (doc "address to listen on"))
+	    (field port int (default 8080))
+	    (field tls bool)
+	    (field routes (list route)))
+	  (struct route
+	    (field path string (required))
+	    (field weight float (default 1.0))
+	    (field headers (map string))
+	    (field extra sexpr)))
+
+Field types are string, int, float, bool, bytes (a byte string like
+|YWJj|), rational (an exact number like 1/3 or 2), sexpr (any s-expression,
+kept as is), the name of a struct in the schema, (list T) and (map T),
+a map from names to T.  A field is optional unless marked (required); optional
+fields may have a (default VALUE), which for now can only be given for
+string, int, float and bool fields.  Names are written the way they
+appear in documents (lower case, words joined with '-') and turned into
+Go names by the generator.
+
+Documents described by a schema hold one (name value) entry per field.
+For a field whose value is a struct the entries of that struct follow
+the name in place of a single value, for a list its elements do, and for
+a map its (key value) pairs:
+
+	(host "example.org")
+	(port 8443)
+	(routes ((path "/") (weight 2.5)) ((path "/api")))
+
+A list element that is itself a struct is written as a list of its
+entries.  Skeleton writes an example document in this layout.
+
+Schemas can also be made from existing Go types with FromType, and
+written back out with Encode, so the documentation of what a program
+accepts can be generated from the program.
+*/
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mjsottile/gocode/diag"
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+// Kind is the kind of a field type.
+type Kind int
+
+const (
+	String Kind = iota
+	Int
+	Float
+	Bool
+	Sexpr
+	Struct
+	List
+	Map
+	Bytes
+	Rational
+)
+
+var kindNames = [...]string{"string", "int", "float", "bool", "sexpr", "struct", "list", "map", "bytes", "rational"}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Type is the type of a field.
+type Type struct {
+	Kind   Kind
+	Elem   *Type  // element type of a List or Map
+	Struct string // name of the struct, for Struct
+}
+
+func (t *Type) String() string {
+	switch t.Kind {
+	case Struct:
+		return t.Struct
+	case List, Map:
+		return "(" + t.Kind.String() + " " + t.Elem.String() + ")"
+	}
+	return t.Kind.String()
+}
+
+// Field is one named value in a struct.
+type Field struct {
+	Name     string
+	Doc      string
+	Type     *Type
+	Required bool
+
+	// the default value, or nil.  only set for scalar fields.
+	Default *sexpr.Sexpr
+
+	// the (field ...) clause, for error messages
+	src *sexpr.Sexpr
+}
+
+// StructType is a named group of fields.
+type StructType struct {
+	Name   string
+	Doc    string
+	Fields []*Field
+}
+
+// Schema is a parsed schema document.
+type Schema struct {
+	Name    string
+	Doc     string
+	Structs []*StructType
+}
+
+// Lookup returns the struct with the given name, or nil.
+func (s *Schema) Lookup(name string) *StructType {
+	for _, st := range s.Structs {
+		if st.Name == name {
+			return st
+		}
+	}
+	return nil
+}
+
+// ErrSchema is wrapped by the errors Parse reports for documents that
+// parse as s-expressions but aren't valid schemas.
+var ErrSchema = errors.New("invalid schema")
+
+// Parse reads a schema document.  errors are *diag.SourceErrors pointing
+// into src.
+func Parse(src string) (*Schema, error) {
+	forms, err := sexpr.ParseAll(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src}
+	if len(forms) == 0 {
+		return nil, p.errorf(nil, "empty schema document")
+	}
+	if len(forms) > 1 {
+		return nil, p.errorf(forms[1], "only one schema form is allowed per document")
+	}
+	s, err := p.schema(forms[0])
+	if err != nil {
+		return nil, err
+	}
+	return s, p.check(s)
+}
+
+type parser struct {
+	src string
+}
+
+func (p *parser) errorf(at *sexpr.Sexpr, format string, args ...interface{}) error {
+	off := len(p.src)
+	if at != nil {
+		off = at.Pos()
+	}
+	return diag.Errorf(diag.PositionFor("", p.src, off), ErrSchema, format, args...)
+}
+
+// the head symbol of a list and the rest of its elements, or "" if s
+// isn't a list starting with an atom
+func clause(s *sexpr.Sexpr) (string, []*sexpr.Sexpr) {
+	kids := s.Children()
+	if !s.IsList() || len(kids) == 0 || !kids[0].IsAtom() {
+		return "", nil
+	}
+	return kids[0].Value(), kids[1:]
+}
+
+// the name in a clause like (struct NAME ...)
+func (p *parser) name(what string, s *sexpr.Sexpr, args []*sexpr.Sexpr) (string, error) {
+	if len(args) == 0 || !args[0].IsAtom() || strings.HasPrefix(args[0].Value(), `"`) {
+		return "", p.errorf(s, "%s needs a name", what)
+	}
+	return args[0].Value(), nil
+}
+
+// the text of a (doc "...") clause
+func (p *parser) doc(s *sexpr.Sexpr, args []*sexpr.Sexpr) (string, error) {
+	if len(args) != 1 || !args[0].IsAtom() {
+		return "", p.errorf(s, "doc takes a single string")
+	}
+	return unquote(args[0]), nil
+}
+
+// the contents of a string atom, or the text of any other atom
+func unquote(s *sexpr.Sexpr) string {
+	if v, err := s.Str(); err == nil {
+		return v
+	}
+	return s.Value()
+}
+
+func (p *parser) schema(s *sexpr.Sexpr) (*Schema, error) {
+	head, args := clause(s)
+	if head != "schema" {
+		return nil, p.errorf(s, "expected (schema NAME ...)")
+	}
+	name, err := p.name("schema", s, args)
+	if err != nil {
+		return nil, err
+	}
+	sc := &Schema{Name: name}
+	for _, c := range args[1:] {
+		h, a := clause(c)
+		switch h {
+		case "doc":
+			if sc.Doc, err = p.doc(c, a); err != nil {
+				return nil, err
+			}
+		case "struct":
+			st, err := p.structType(c, a)
+			if err != nil {
+				return nil, err
+			}
+			if sc.Lookup(st.Name) != nil {
+				return nil, p.errorf(c, "struct %s is defined twice", st.Name)
+			}
+			sc.Structs = append(sc.Structs, st)
+		default:
+			return nil, p.errorf(c, "expected (struct ...) or (doc ...) in schema")
+		}
+	}
+	return sc, nil
+}
+
+func (p *parser) structType(s *sexpr.Sexpr, args []*sexpr.Sexpr) (*StructType, error) {
+	name, err := p.name("struct", s, args)
+	if err != nil {
+		return nil, err
+	}
+	st := &StructType{Name: name}
+	seen := make(map[string]bool)
+	for _, c := range args[1:] {
+		h, a := clause(c)
+		switch h {
+		case "doc":
+			if st.Doc, err = p.doc(c, a); err != nil {
+				return nil, err
+			}
+		case "field":
+			f, err := p.field(c, a)
+			if err != nil {
+				return nil, err
+			}
+			if seen[f.Name] {
+				return nil, p.errorf(c, "field %s appears twice in struct %s", f.Name, name)
+			}
+			seen[f.Name] = true
+			st.Fields = append(st.Fields, f)
+		default:
+			return nil, p.errorf(c, "expected (field ...) or (doc ...) in struct %s", name)
+		}
+	}
+	return st, nil
+}
+
+func (p *parser) field(s *sexpr.Sexpr, args []*sexpr.Sexpr) (*Field, error) {
+	name, err := p.name("field", s, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < 2 {
+		return nil, p.errorf(s, "field %s needs a type", name)
+	}
+	f := &Field{Name: name, src: s}
+	if f.Type, err = p.typ(args[1]); err != nil {
+		return nil, err
+	}
+	for _, c := range args[2:] {
+		h, a := clause(c)
+		switch h {
+		case "doc":
+			if f.Doc, err = p.doc(c, a); err != nil {
+				return nil, err
+			}
+		case "required":
+			if len(a) != 0 {
+				return nil, p.errorf(c, "required takes no arguments")
+			}
+			f.Required = true
+		case "default":
+			if len(a) != 1 {
+				return nil, p.errorf(c, "default takes a single value")
+			}
+			if err := p.checkDefault(f, a[0]); err != nil {
+				return nil, err
+			}
+			f.Default = a[0]
+		default:
+			return nil, p.errorf(c, "expected (doc ...), (required) or (default ...) in field %s", name)
+		}
+	}
+	if f.Required && f.Default != nil {
+		return nil, p.errorf(s, "field %s is required, so it can't have a default", name)
+	}
+	return f, nil
+}
+
+func (p *parser) typ(s *sexpr.Sexpr) (*Type, error) {
+	if s.IsAtom() {
+		switch v := s.Value(); v {
+		case "string":
+			return &Type{Kind: String}, nil
+		case "int":
+			return &Type{Kind: Int}, nil
+		case "float":
+			return &Type{Kind: Float}, nil
+		case "bool":
+			return &Type{Kind: Bool}, nil
+		case "sexpr":
+			return &Type{Kind: Sexpr}, nil
+		case "bytes":
+			return &Type{Kind: Bytes}, nil
+		case "rational":
+			return &Type{Kind: Rational}, nil
+		default:
+			if strings.HasPrefix(v, `"`) {
+				return nil, p.errorf(s, "expected a type, found string %s", v)
+			}
+			return &Type{Kind: Struct, Struct: v}, nil
+		}
+	}
+	head, args := clause(s)
+	var k Kind
+	switch head {
+	case "list":
+		k = List
+	case "map":
+		k = Map
+	default:
+		return nil, p.errorf(s, "expected a type, (list T) or (map T)")
+	}
+	if len(args) != 1 {
+		return nil, p.errorf(s, "%s takes one element type", head)
+	}
+	elem, err := p.typ(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return &Type{Kind: k, Elem: elem}, nil
+}
+
+func (p *parser) checkDefault(f *Field, v *sexpr.Sexpr) error {
+	if !v.IsAtom() {
+		return p.errorf(v, "default for %s must be an atom", f.Name)
+	}
+	var err error
+	switch f.Type.Kind {
+	case String:
+		return nil
+	case Int:
+		_, err = strconv.ParseInt(v.Value(), 10, 64)
+	case Float:
+		_, err = strconv.ParseFloat(v.Value(), 64)
+	case Bool:
+		_, err = ParseBool(v.Value())
+	default:
+		return p.errorf(v, "field %s of type %s can't have a default", f.Name, f.Type)
+	}
+	if err != nil {
+		return p.errorf(v, "default %s is not a valid %s", v.Value(), f.Type)
+	}
+	return nil
+}
+
+// ParseBool accepts the spellings of true and false a document may use:
+// true/false, #t/#f, yes/no and on/off.
+func ParseBool(v string) (bool, error) {
+	switch v {
+	case "true", "#t", "yes", "on":
+		return true, nil
+	case "false", "#f", "no", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("not a boolean: %q", v)
+}
+
+// check that every struct named by a field type is defined
+func (p *parser) check(s *Schema) error {
+	var visit func(*Type) string
+	visit = func(t *Type) string {
+		switch t.Kind {
+		case Struct:
+			if s.Lookup(t.Struct) == nil {
+				return t.Struct
+			}
+		case List, Map:
+			return visit(t.Elem)
+		}
+		return ""
+	}
+	for _, st := range s.Structs {
+		for _, f := range st.Fields {
+			if missing := visit(f.Type); missing != "" {
+				return p.errorf(f.src, "field %s of struct %s refers to undefined struct %s",
+					f.Name, st.Name, missing)
+			}
+		}
+	}
+	return nil
+}
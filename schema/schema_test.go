@@ -0,0 +1,257 @@
+package schema
+
+import (
+	"errors"
+	"go/ast"
+	"go/importer"
+	goparser "go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/mjsottile/gocode/diag"
+)
+
+// the example from the package comment
+const serverConfig = `(schema server-config
+  (doc "settings for the frontend server")
+  (struct server
+    (doc "one listening server")
+    (field host string (required) (doc "address to listen on"))
+    (field port int (default 8080))
+    (field tls bool)
+    (field routes (list route)))
+  (struct route
+    (field path string (required))
+    (field weight float (default 1.0))
+    (field headers (map string))
+    (field extra sexpr)))
+`
+
+func TestParse(t *testing.T) {
+	s, err := Parse(serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "server-config" || s.Doc != "settings for the frontend server" || len(s.Structs) != 2 {
+		t.Fatalf("Parse gave %+v", s)
+	}
+	server, route := s.Lookup("server"), s.Lookup("route")
+	if server != s.Structs[0] || route != s.Structs[1] || s.Lookup("client") != nil {
+		t.Errorf("Lookup doesn't find the structs")
+	}
+	if server.Doc != "one listening server" || len(server.Fields) != 4 || len(route.Fields) != 4 {
+		t.Fatalf("Parse gave structs %+v and %+v", server, route)
+	}
+	var got []string
+	for _, st := range s.Structs {
+		for _, f := range st.Fields {
+			desc := f.Name + " " + f.Type.String()
+			if f.Required {
+				desc += " required"
+			}
+			if f.Default != nil {
+				desc += " = " + f.Default.Value()
+			}
+			if f.Doc != "" {
+				desc += " // " + f.Doc
+			}
+			got = append(got, desc)
+		}
+	}
+	want := []string{
+		"host string required // address to listen on",
+		"port int = 8080",
+		"tls bool",
+		"routes (list route)",
+		"path string required",
+		"weight float = 1.0",
+		"headers (map string)",
+		"extra sexpr",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("fields are\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if ty := server.Fields[3].Type; ty.Kind != List || ty.Elem.Kind != Struct || ty.Elem.Struct != "route" {
+		t.Errorf("routes has type %+v", ty)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+		msg  string
+	}{
+		{"", 1, "empty schema document"},
+		{"(schema a) (schema b)", 1, "only one schema form"},
+		{"(scheme a)", 1, "expected (schema NAME ...)"},
+		{`(schema "a")`, 1, "schema needs a name"},
+		{"(schema a\n  (field x int))", 2, "expected (struct ...) or (doc ...)"},
+		{"(schema a\n  (struct s)\n  (struct s))", 3, "struct s is defined twice"},
+		{"(schema a (struct s\n  (field x)))", 2, "field x needs a type"},
+		{"(schema a (struct s\n  (field x int)\n  (field x string)))", 3, "field x appears twice"},
+		{"(schema a (struct s\n  (field x \"int\")))", 2, "expected a type, found string"},
+		{"(schema a (struct s\n  (field x (set int))))", 2, "expected a type, (list T) or (map T)"},
+		{"(schema a (struct s\n  (field x (list int string))))", 2, "list takes one element type"},
+		{"(schema a (struct s\n  (field x int (required) (default 1))))", 2, "required, so it can't have a default"},
+		{"(schema a (struct s\n  (field x int\n    (default ten))))", 3, "default ten is not a valid int"},
+		{"(schema a (struct s\n  (field x bool (default maybe))))", 2, "not a valid bool"},
+		{"(schema a (struct s\n  (field x (list int) (default 1))))", 2, "can't have a default"},
+		{"(schema a (struct s\n  (field x int (default (1)))))", 2, "must be an atom"},
+		{"(schema a (struct s\n  (field x int (optional))))", 2, "expected (doc ...), (required) or (default ...)"},
+		{"(schema a (struct s\n  (field x int (required yes))))", 2, "required takes no arguments"},
+		{"(schema a (struct s (doc)))", 1, "doc takes a single string"},
+		{"(schema a\n  (struct s (field r (map t)))\n  (struct t\n    (field u (list (list user)))))", 4, "refers to undefined struct user"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		var se *diag.SourceError
+		if !errors.Is(err, ErrSchema) || !errors.As(err, &se) {
+			t.Errorf("Parse(%q) = %v, not a positioned ErrSchema", tt.src, err)
+			continue
+		}
+		if se.Pos.Line != tt.line || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("Parse(%q) = %v, want %q on line %d", tt.src, err, tt.msg, tt.line)
+		}
+	}
+	// a document that doesn't parse at all isn't a schema error
+	if _, err := Parse("(schema a"); err == nil || errors.Is(err, ErrSchema) {
+		t.Errorf("Parse of unbalanced input = %v", err)
+	}
+}
+
+func TestParseBool(t *testing.T) {
+	for _, v := range []string{"true", "#t", "yes", "on"} {
+		if b, err := ParseBool(v); !b || err != nil {
+			t.Errorf("ParseBool(%q) = %v, %v", v, b, err)
+		}
+	}
+	for _, v := range []string{"false", "#f", "no", "off"} {
+		if b, err := ParseBool(v); b || err != nil {
+			t.Errorf("ParseBool(%q) = %v, %v", v, b, err)
+		}
+	}
+	if _, err := ParseBool("True"); err == nil {
+		t.Errorf("ParseBool(True) succeeded")
+	}
+}
+
+func TestGoName(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"host", "Host"},
+		{"listen-addr", "ListenAddr"},
+		{"tls", "TLS"},
+		{"http-url", "HTTPURL"},
+		{"server_id", "ServerID"},
+		{"max.ttl", "MaxTTL"},
+		{"2fa", "X2fa"},
+		{"-", "X"},
+		{"élan", "Élan"},
+	}
+	for _, tt := range tests {
+		if got := GoName(tt.in); got != tt.want {
+			t.Errorf("GoName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// imports the generated code's dependencies: the standard library as
+// usual, and a stand-in for the sexpr package
+type stubImporter struct{ std types.Importer }
+
+func (im stubImporter) Import(path string) (*types.Package, error) {
+	if path != "github.com/mjsottile/gocode/sexpr" {
+		return im.std.Import(path)
+	}
+	pkg := types.NewPackage(path, "sexpr")
+	obj := types.NewTypeName(token.NoPos, pkg, "Sexpr", nil)
+	types.NewNamed(obj, types.NewStruct(nil, nil), nil)
+	pkg.Scope().Insert(obj)
+	pkg.MarkComplete()
+	return pkg, nil
+}
+
+// the generated code type-checks, and its fields and getters are the
+// ones GoSource documents
+func TestGoSource(t *testing.T) {
+	s, err := Parse(serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := s.GoSource("config", "server.sexpr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	f, err := goparser.ParseFile(fset, "config.go", src, goparser.ParseComments)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, src)
+	}
+	conf := types.Config{Importer: stubImporter{importer.Default()}}
+	pkg, err := conf.Check("config", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, src)
+	}
+
+	fields := map[string]string{
+		"Server.Host":    "string `sexpr:\"host\"`",
+		"Server.Port":    "*int64 `sexpr:\"port,omitempty\"`",
+		"Server.TLS":     "*bool `sexpr:\"tls,omitempty\"`",
+		"Server.Routes":  "[]config.Route `sexpr:\"routes,omitempty\"`",
+		"Route.Path":     "string `sexpr:\"path\"`",
+		"Route.Weight":   "*float64 `sexpr:\"weight,omitempty\"`",
+		"Route.Headers":  "map[string]string `sexpr:\"headers,omitempty\"`",
+		"Route.Extra":    "*github.com/mjsottile/gocode/sexpr.Sexpr `sexpr:\"extra,omitempty\"`",
+		"Server.GetPort": "func() int64",
+		"Server.GetTLS":  "func() bool",
+		"Route.GetExtra": "func() *github.com/mjsottile/gocode/sexpr.Sexpr",
+	}
+	for name, want := range fields {
+		typ, member, _ := strings.Cut(name, ".")
+		named := pkg.Scope().Lookup(typ).Type().(*types.Named)
+		var got string
+		st := named.Underlying().(*types.Struct)
+		for i := 0; i < st.NumFields(); i++ {
+			if st.Field(i).Name() == member {
+				got = st.Field(i).Type().String() + " `" + st.Tag(i) + "`"
+			}
+		}
+		for i := 0; i < named.NumMethods(); i++ {
+			if m := named.Method(i); m.Name() == member {
+				got = m.Type().String()
+			}
+		}
+		if got != want {
+			t.Errorf("%s is %s, want %s", name, got, want)
+		}
+	}
+	for _, want := range []string{
+		"// Code generated by sexpr-schema from server.sexpr; DO NOT EDIT.",
+		"// Server is struct server of schema server-config.\n//\n// one listening server\n",
+		"\t// address to listen on\n\tHost   string",
+		"// GetPort returns port, or 8080 if it is not set.",
+		"return 8080",
+		"return 1\n",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("no %q in\n%s", want, src)
+		}
+	}
+}
+
+func TestGoSourceClashes(t *testing.T) {
+	for _, src := range []string{
+		"(schema a (struct a-b) (struct a_b))",
+		"(schema a (struct s (field x-y int) (field x.y int)))",
+	} {
+		s, err := Parse(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GoSource("a", "a.sexpr"); err == nil || !strings.Contains(err.Error(), "both become") {
+			t.Errorf("GoSource of %s = %v, want a clash", src, err)
+		}
+	}
+}
@@ -0,0 +1,455 @@
+package sexpr
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// AtomKind says what an atom holds.  the parser decides it from the
+// atom's text: double quoted atoms are strings, decimal integers with an
+// optional sign are integers (of any size), decimal numbers with a
+// fraction or an exponent are floats, rationals like 1/3 (with a
+// nonzero denominator) are rationals, atoms like :foo (a colon and at least one more
+// character) are keywords, #t and #f are booleans, nil is nil,
+// Scheme-style character literals like #\a and #\space are characters,
+// SPKI byte strings like |YWJj| (base64) and #616263# (hex) are bytes,
+// and everything else is a symbol.  a string atom's text keeps its quotes
+// and escapes as they were written; Str decodes them.
+type AtomKind uint8
+
+// the kinds.  NotAtom is the kind of a list.  the numbering is part of
+// the binary format, so new kinds go at the end.
+const (
+	Symbol AtomKind = iota
+	NotAtom
+	Integer
+	Float
+	String
+	Keyword
+	Boolean
+	Nil
+	Char
+	Rational
+	Bytes
+)
+
+func (k AtomKind) String() string {
+	switch k {
+	case Symbol:
+		return "symbol"
+	case NotAtom:
+		return "list"
+	case Integer:
+		return "integer"
+	case Float:
+		return "float"
+	case String:
+		return "string"
+	case Keyword:
+		return "keyword"
+	case Boolean:
+		return "boolean"
+	case Nil:
+		return "nil"
+	case Char:
+		return "character"
+	case Rational:
+		return "rational"
+	case Bytes:
+		return "bytes"
+	}
+	return fmt.Sprintf("AtomKind(%d)", k)
+}
+
+// ErrAtomKind is returned (wrapped) by the typed accessors when an
+// element isn't of the kind asked for.
+var ErrAtomKind = errors.New("wrong kind of atom")
+
+// the kind of atom s is, or NotAtom for a list
+func (s *Sexpr) AtomKind() AtomKind {
+	if !s.IsAtom() {
+		return NotAtom
+	}
+	return s.aty
+}
+
+// true if s is a keyword atom, like :foo.  keywords are the usual way to
+// name options, as in (server :port 8080), and are symbols in every
+// other respect.
+func (s *Sexpr) IsKeyword() bool { return s.AtomKind() == Keyword }
+
+// true if s is nil: the atom nil or the empty list ()
+func (s *Sexpr) IsNil() bool {
+	if s.IsList() {
+		return s.list == nil && s.tail == nil
+	}
+	return s.AtomKind() == Nil
+}
+
+// the value of a boolean atom, #t or #f.  nil and () are false too, as
+// in Lisp.
+func (s *Sexpr) Bool() (bool, error) {
+	if s.IsNil() {
+		return false, nil
+	}
+	if err := s.want(Boolean, "a boolean"); err != nil {
+		return false, err
+	}
+	return s.val == "#t", nil
+}
+
+// the value of a character atom: #\a is 'a', #\space is ' ', #\x3bb is
+// 'λ'.  see charNames for the named characters.
+func (s *Sexpr) Rune() (rune, error) {
+	if err := s.want(Char, "a character"); err != nil {
+		return 0, err
+	}
+	r, _ := charValue(s.val)
+	return r, nil
+}
+
+// the names a character literal may use after #\, as in R7RS
+var charNames = map[string]rune{
+	"alarm":     '\a',
+	"backspace": '\b',
+	"delete":    0x7f,
+	"escape":    0x1b,
+	"newline":   '\n',
+	"null":      0,
+	"nul":       0,
+	"return":    '\r',
+	"space":     ' ',
+	"tab":       '\t',
+}
+
+// the character a literal like #\a stands for, and whether it is one:
+// a single character, a name from charNames, or x and a hex code point
+func charValue(v string) (rune, bool) {
+	name, ok := strings.CutPrefix(v, `#\`)
+	if !ok || name == "" {
+		return 0, false
+	}
+	if r, n := utf8.DecodeRuneInString(name); n == len(name) {
+		return r, r != utf8.RuneError || n > 1
+	}
+	if r, ok := charNames[name]; ok {
+		return r, true
+	}
+	if hex, ok := strings.CutPrefix(name, "x"); ok {
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if err == nil && utf8.ValidRune(rune(n)) {
+			return rune(n), true
+		}
+	}
+	return 0, false
+}
+
+// the octets of a byte string atom, |YWJj| or #616263#, or the contents
+// of a string atom as bytes
+func (s *Sexpr) Bytes() ([]byte, error) {
+	if s.AtomKind() == String {
+		text, err := s.Str()
+		return []byte(text), err
+	}
+	if err := s.want(Bytes, "a byte string"); err != nil {
+		return nil, err
+	}
+	b, _ := bytesValue(s.val)
+	return b, nil
+}
+
+// NewBytes builds a byte string atom holding b, written in base64 as
+// |YWJj|, so that Bytes gives b back.
+func NewBytes(b []byte) *Sexpr {
+	return NewAtom("|" + base64.StdEncoding.EncodeToString(b) + "|")
+}
+
+// the octets a byte string like |YWJj| or #616263# stands for, and
+// whether it is one.  base64 may leave out its padding, and hex needs
+// whole bytes.
+func bytesValue(v string) ([]byte, bool) {
+	if len(v) < 2 || v[0] != v[len(v)-1] {
+		return nil, false
+	}
+	body := v[1 : len(v)-1]
+	switch v[0] {
+	case '|':
+		enc := base64.StdEncoding
+		if len(body)%4 != 0 {
+			enc = base64.RawStdEncoding
+		}
+		b, err := enc.Strict().DecodeString(body)
+		return b, err == nil
+	case '#':
+		b, err := hex.DecodeString(body)
+		return b, err == nil
+	}
+	return nil, false
+}
+
+// true if v is written like a byte string, between bars or hashes,
+// whether or not what is between them decodes.  #\# is a character.
+func looksLikeBytes(v string) bool {
+	return len(v) >= 2 && (v[0] == '|' || v[0] == '#') && v[len(v)-1] == v[0] &&
+		!strings.HasPrefix(v, `#\`)
+}
+
+// the value of an integer atom.  integers too big for an int64 give a
+// *strconv.NumError wrapping strconv.ErrRange; BigInt has them.
+func (s *Sexpr) Int() (int64, error) {
+	if err := s.want(Integer, "an integer"); err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(s.val, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// the value of a float atom, or of an integer or rational atom converted
+// to float.  like strconv.ParseFloat, values out of range give ±Inf and
+// an error wrapping strconv.ErrRange; Rat has them exactly.
+func (s *Sexpr) Float64() (float64, error) {
+	switch s.AtomKind() {
+	case Integer:
+	case Rational:
+		r, _ := s.Rat()
+		f, _ := r.Float64()
+		if math.IsInf(f, 0) {
+			return f, &strconv.NumError{Func: "Float64", Num: s.val, Err: strconv.ErrRange}
+		}
+		return f, nil
+	default:
+		if err := s.want(Float, "a number"); err != nil {
+			return 0, err
+		}
+	}
+	return strconv.ParseFloat(s.val, 64)
+}
+
+// the value of an integer atom, however big
+func (s *Sexpr) BigInt() (*big.Int, error) {
+	if err := s.want(Integer, "an integer"); err != nil {
+		return nil, err
+	}
+	n, _ := new(big.Int).SetString(s.val, 10)
+	return n, nil
+}
+
+// the exact value of a number atom: a rational like 1/3, an integer or
+// a float (1.1 is 11/10).  floats with exponents too big for big.Rat,
+// like 1e10000000, give a *strconv.NumError wrapping strconv.ErrRange.
+func (s *Sexpr) Rat() (*big.Rat, error) {
+	switch s.AtomKind() {
+	case Integer, Float:
+		// decimal only, unlike the fractions SetString accepts
+		r, ok := new(big.Rat).SetString(s.val)
+		if !ok {
+			return nil, &strconv.NumError{Func: "Rat", Num: s.val, Err: strconv.ErrRange}
+		}
+		return r, nil
+	case Rational:
+		num, den, _ := strings.Cut(s.val, "/")
+		a, _ := new(big.Int).SetString(num, 10)
+		b, _ := new(big.Int).SetString(den, 10)
+		return new(big.Rat).SetFrac(a, b), nil
+	}
+	return nil, s.want(Rational, "a number")
+}
+
+// the contents of a string atom, without its quotes and with its escape
+// sequences decoded
+func (s *Sexpr) Str() (string, error) {
+	if err := s.want(String, "a string"); err != nil {
+		return "", err
+	}
+	return unescape(s.val[1 : len(s.val)-1])
+}
+
+// NewString builds a string atom holding text, quoting it and escaping
+// what needs it so that Str gives text back.  bytes that aren't valid
+// UTF-8 can't be escaped and become U+FFFD.
+func NewString(text string) *Sexpr {
+	return NewAtom(quoteString(text))
+}
+
+// text in double quotes, with escapes
+func quoteString(text string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range text {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < ' ' || r == 0x7f || r >= 0x80 && !unicode.IsPrint(r) && r != utf8.RuneError:
+			if r > 0xffff {
+				// as a surrogate pair, the way JSON does it
+				r1, r2 := utf16.EncodeRune(r)
+				fmt.Fprintf(&b, `\u%04x\u%04x`, r1, r2)
+			} else {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// decode the escapes in the text between a string's quotes
+func unescape(v string) (string, error) {
+	if !strings.ContainsRune(v, '\\') {
+		return v, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] != '\\' {
+			b.WriteByte(v[i])
+			continue
+		}
+		if i+1 == len(v) {
+			return "", fmt.Errorf("sexpr: %w: trailing \\", ErrBadEscape)
+		}
+		i++
+		switch v[i] {
+		case '"', '\\':
+			b.WriteByte(v[i])
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'u':
+			r, n := hex4(v[i+1:])
+			if n < 0 {
+				return "", fmt.Errorf("sexpr: %w: %q", ErrBadEscape, v[i-1:min(i+5, len(v))])
+			}
+			i += n
+			if utf16.IsSurrogate(r) {
+				// half of a pair; the other half should follow
+				if rest, ok := strings.CutPrefix(v[i+1:], `\u`); ok {
+					if r2, n2 := hex4(rest); n2 > 0 {
+						if d := utf16.DecodeRune(r, r2); d != utf8.RuneError {
+							r = d
+							i += 2 + n2
+						}
+					}
+				}
+			}
+			// a lone surrogate comes out as U+FFFD
+			b.WriteRune(r)
+		default:
+			return "", fmt.Errorf("sexpr: %w: %q", ErrBadEscape, v[i-1:i+1])
+		}
+	}
+	return b.String(), nil
+}
+
+// the rune given by four hex digits at the start of v and their length,
+// or -1 if there aren't four
+func hex4(v string) (rune, int) {
+	if len(v) < 4 {
+		return 0, -1
+	}
+	n, err := strconv.ParseUint(v[:4], 16, 32)
+	if err != nil {
+		return 0, -1
+	}
+	return rune(n), 4
+}
+
+func (s *Sexpr) want(k AtomKind, what string) error {
+	if got := s.AtomKind(); got != k {
+		if got == NotAtom {
+			return fmt.Errorf("sexpr: list is not %s: %w", what, ErrAtomKind)
+		}
+		return fmt.Errorf("sexpr: %s %s is not %s: %w", got, s.val, what, ErrAtomKind)
+	}
+	return nil
+}
+
+// decide the kind of an atom from its text
+func classifyAtom(v string) AtomKind {
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		return String
+	}
+	if len(v) >= 2 && v[0] == ':' {
+		return Keyword
+	}
+	if _, ok := charValue(v); ok {
+		return Char
+	}
+	if _, ok := bytesValue(v); ok {
+		return Bytes
+	}
+	switch v {
+	case "#t", "#f":
+		return Boolean
+	case "nil":
+		return Nil
+	}
+	i := 0
+	if i < len(v) && (v[i] == '+' || v[i] == '-') {
+		i++
+	}
+	digits := func() int {
+		n := 0
+		for i < len(v) && '0' <= v[i] && v[i] <= '9' {
+			i++
+			n++
+		}
+		return n
+	}
+	whole := digits()
+	kind := Integer
+	if whole > 0 && i < len(v) && v[i] == '/' {
+		i++
+		den := v[i:]
+		if digits() == 0 || i != len(v) || strings.Trim(den, "0") == "" {
+			return Symbol
+		}
+		return Rational
+	}
+	frac := 0
+	if i < len(v) && v[i] == '.' {
+		i++
+		frac = digits()
+		kind = Float
+	}
+	if whole+frac == 0 {
+		return Symbol
+	}
+	if i < len(v) && (v[i] == 'e' || v[i] == 'E') {
+		i++
+		if i < len(v) && (v[i] == '+' || v[i] == '-') {
+			i++
+		}
+		if digits() == 0 {
+			return Symbol
+		}
+		kind = Float
+	}
+	if i != len(v) {
+		return Symbol
+	}
+	return kind
+}
@@ -0,0 +1,36 @@
+package sexpr
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestRat(t *testing.T) {
+	tests := []struct {
+		atom, want string
+	}{
+		{"42", "42/1"},
+		{"-1.1", "-11/10"},
+		{"2.5e3", "2500/1"},
+		{"1e-3", "1/1000"},
+		{"2/4", "1/2"},
+		{"+50/100", "1/2"},
+	}
+	for _, tt := range tests {
+		r, err := NewAtom(tt.atom).Rat()
+		if err != nil || r.String() != tt.want {
+			t.Errorf("Rat(%s) = %v, %v, want %s", tt.atom, r, err, tt.want)
+		}
+	}
+	// a float big.Rat can't hold is an error, never a nil *big.Rat
+	for _, atom := range []string{"1e10000000", "-1.5e99999999", "1e-10000000"} {
+		r, err := NewAtom(atom).Rat()
+		if r != nil || !errors.Is(err, strconv.ErrRange) {
+			t.Errorf("Rat(%s) = %v, %v, want a range error", atom, r, err)
+		}
+	}
+	if _, err := NewAtom("abc").Rat(); err == nil {
+		t.Error("Rat(abc) gave no error")
+	}
+}
@@ -0,0 +1,164 @@
+package sexpr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mjsottile/gocode/diag"
+)
+
+// BalanceError gives the details behind an ErrUnexpectedEOF or
+// ErrUnexpectedParen caused by unbalanced parens.  the parser only
+// notices the problem where the input runs out (or where the extra ')'
+// is), which is rarely where it was made, so this also carries a best
+// guess at the real location based on indentation: a line indented no
+// deeper than the line that opened an unclosed list suggests the list
+// should have been closed before that line, and a top-level form
+// followed by an indented line suggests the form was closed too early.
+// it is wrapped in the *diag.SourceError returned by Parse; use
+// errors.As to get at it.
+type BalanceError struct {
+	// ErrUnexpectedEOF (parens missing) or ErrUnexpectedParen (extra)
+	Err error
+
+	// number of ')' still needed at the end of the input
+	Missing int
+
+	// the '(' of the list left open, or of the top-level form that was
+	// closed early.  zero if there is nothing better to point at.
+	Opened diag.Position
+
+	// best guess at where a ')' should be added (missing) or removed
+	// (extra), or zero if the indentation gives no clue
+	Guess diag.Position
+}
+
+func (e *BalanceError) Error() string {
+	var b strings.Builder
+	if e.Err == ErrUnexpectedEOF {
+		fmt.Fprintf(&b, "expected %d more ')' — unmatched '(' opened at line %d", e.Missing, e.Opened.Line)
+		if e.Guess.IsValid() {
+			fmt.Fprintf(&b, ", probably missing at %d:%d", e.Guess.Line, e.Guess.Column)
+		}
+		return b.String()
+	}
+	b.WriteString("unexpected ')' with no matching '('")
+	if e.Guess.IsValid() {
+		fmt.Fprintf(&b, " — the form opened at line %d was probably closed early at %d:%d",
+			e.Opened.Line, e.Guess.Line, e.Guess.Column)
+	}
+	return b.String()
+}
+
+func (e *BalanceError) Unwrap() error { return e.Err }
+
+// analyze the parens of input up to the point where the parser gave up
+// with sentinel err (at byte offset stop).  the returned offset is where
+// the error is best reported.
+func analyzeBalance(name, input string, err error, stop int) (*BalanceError, int) {
+	type paren struct {
+		off, line, indent int
+	}
+	lineStarts := []int{0}
+	for i := 0; i < len(input); i++ {
+		if input[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	// 0-based line of an offset
+	lineOf := func(off int) int {
+		lo, hi := 0, len(lineStarts)-1
+		for lo < hi {
+			mid := (lo + hi + 1) / 2
+			if lineStarts[mid] <= off {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+		return lo
+	}
+	indentOf := func(line int) int {
+		n := 0
+		for i := lineStarts[line]; i < len(input) && (input[i] == ' ' || input[i] == '\t'); i++ {
+			n++
+		}
+		return n
+	}
+	// offset just past the last non-blank character before line
+	endBefore := func(line int) int {
+		off := lineStarts[line]
+		for off > 0 && strings.ContainsRune(" \t\r\n", rune(input[off-1])) {
+			off--
+		}
+		return off
+	}
+
+	var stack []paren
+	var dedent, dedentOpen = -1, paren{}
+	var early, earlyOpen = -1, paren{}
+	var lastTop paren
+	lastTopClose, lastTopLine := -1, -1
+	prevLine := -1
+
+	_, items := lex(context.Background(), name, input)
+	for it := range items {
+		if it.typ == itemEOF || it.typ == itemError || it.typ == itemBadComment || it.pos > stop {
+			break
+		}
+		if it.typ == itemComment {
+			continue
+		}
+		line := lineOf(it.pos)
+		if line != prevLine && it.typ != itemRParen {
+			ind := indentOf(line)
+			if dedent < 0 {
+				for _, p := range stack {
+					if p.line < line && p.indent >= ind {
+						dedent, dedentOpen = endBefore(line), p
+						break
+					}
+				}
+			}
+			if len(stack) == 0 && ind > 0 && lastTopClose >= 0 && lastTopLine < line {
+				early, earlyOpen = lastTopClose, lastTop
+			}
+		}
+		prevLine = line
+		switch it.typ {
+		case itemLParen:
+			stack = append(stack, paren{it.pos, line, indentOf(line)})
+		case itemRParen:
+			if len(stack) == 0 {
+				break
+			}
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				lastTop, lastTopClose, lastTopLine = top, it.pos, line
+			}
+		}
+	}
+	// let the lexer finish so its go-routine exits
+	for range items {
+	}
+
+	pos := func(off int) diag.Position { return diag.PositionFor(name, input, off) }
+	be := &BalanceError{Err: err, Missing: len(stack)}
+	at := stop
+	if err == ErrUnexpectedEOF {
+		switch {
+		case dedent >= 0:
+			be.Opened, be.Guess = pos(dedentOpen.off), pos(dedent)
+			at = dedent
+		case len(stack) > 0:
+			be.Opened = pos(stack[len(stack)-1].off)
+			at = stack[len(stack)-1].off
+		}
+	} else if early >= 0 {
+		be.Opened, be.Guess = pos(earlyOpen.off), pos(early)
+		at = early
+	}
+	return be, at
+}
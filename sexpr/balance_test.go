@@ -0,0 +1,73 @@
+package sexpr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mjsottile/gocode/diag"
+)
+
+func TestBalanceError(t *testing.T) {
+	tests := []struct {
+		in      string
+		err     error
+		missing int
+		opened  int    // line of BalanceError.Opened, 0 for none
+		guess   string // BalanceError.Guess, "" for none
+		at      string // where the error is reported
+	}{
+		// the if is left open, and the next define is where it shows
+		{"(define (f x)\n  (if x\n      (g x)\n      (h x)\n\n(define (g y)\n  y)\n",
+			ErrUnexpectedEOF, 2, 1, "4:12", "4:12"},
+		{"(a\n  (b\n    (c))\n(d)", ErrUnexpectedEOF, 1, 1, "3:9", "3:9"},
+		{"(a\n  (b\n    (c\n  (d)\n(e)", ErrUnexpectedEOF, 3, 2, "3:7", "3:7"},
+		// with nothing to go on, the innermost open list
+		{"(a (b c)", ErrUnexpectedEOF, 1, 1, "", "1:1"},
+		{"(a\n  (b c", ErrUnexpectedEOF, 2, 2, "", "2:3"},
+		// parens in strings and comments don't count
+		{"(a \"str ( \" ; (\n b", ErrUnexpectedEOF, 1, 1, "", "1:1"},
+		{"(a #| ( |# b", ErrUnexpectedEOF, 1, 1, "", "1:1"},
+
+		// an indented line after a top-level form was closed
+		{"(a (b))\n  (c))", ErrUnexpectedParen, 0, 1, "1:7", "1:7"},
+		{"(a\n  b)\n  c)", ErrUnexpectedParen, 0, 1, "2:4", "2:4"},
+		{"(a b))", ErrUnexpectedParen, 0, 0, "", "1:6"},
+		{")", ErrUnexpectedParen, 0, 0, "", "1:1"},
+	}
+	for _, tt := range tests {
+		_, err := ParseAll(tt.in)
+		var be *BalanceError
+		var se *diag.SourceError
+		if !errors.Is(err, tt.err) || !errors.As(err, &be) || !errors.As(err, &se) {
+			t.Errorf("ParseAll(%q) = %v, want a BalanceError for %v", tt.in, err, tt.err)
+			continue
+		}
+		guess := ""
+		if be.Guess.IsValid() {
+			guess = be.Guess.String()
+		}
+		if be.Missing != tt.missing || be.Opened.Line != tt.opened || guess != tt.guess || se.Pos.String() != tt.at {
+			t.Errorf("ParseAll(%q) = %v: missing %d, opened on line %d, guess %q, at %s; want %d, %d, %q, %s",
+				tt.in, err, be.Missing, be.Opened.Line, guess, se.Pos, tt.missing, tt.opened, tt.guess, tt.at)
+		}
+	}
+}
+
+func TestBalanceMessage(t *testing.T) {
+	src := "(a\n  (b\n    (c))\n(d)"
+	_, err := ParseAll(src)
+	want := "3:9: expected 1 more ')' — unmatched '(' opened at line 1, probably missing at 3:9\n" +
+		"    (c))\n        ^"
+	if got := diag.Describe(err, src); got != want {
+		t.Errorf("Describe gave\n%s\nwant\n%s", got, want)
+	}
+
+	_, err = ParseAll("(a b c")
+	if want := "1:1: expected 1 more ')' — unmatched '(' opened at line 1"; err == nil || err.Error() != want {
+		t.Errorf("ParseAll(\"(a b c\") = %v, want %s", err, want)
+	}
+	_, err = ParseAll("(a)\n  b)")
+	if want := "1:3: unexpected ')' with no matching '(' — the form opened at line 1 was probably closed early at 1:3"; err == nil || err.Error() != want {
+		t.Errorf("ParseAll(\"(a)\\n  b)\") = %v, want %s", err, want)
+	}
+}
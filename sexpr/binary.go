@@ -0,0 +1,243 @@
+package sexpr
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/mjsottile/gocode/binfmt"
+)
+
+// binfmt kind and payload version for serialized s-expressions.
+//
+// version 1 payload: a uvarint count of top-level forms, then each form
+// in pre-order.  an atom is tag 0, its AtomKind as a byte, a uvarint
+// length and its text; a list is tag 1 and a uvarint element count
+// followed by the elements.  positions are not stored.
+//
+// version 2 adds positions, so a tree read back can still point into
+// the text it was parsed from: right after its tag each element has a
+// varint giving its start relative to a cursor, then a uvarint length
+// (end minus start).  the cursor starts at 0, moves just past the '('
+// when entering a list and to the end of each element after it.
+//
+// version 3 adds lines and columns: after the length come a varint
+// giving the element's line relative to the line of the element before
+// it in pre-order (or to 0 for the first), and a uvarint column.
+//
+// version 4 adds dotted lists: tag 2, written like a list with its tail
+// following its elements.
+const (
+	BinaryKind    = "sexpr"
+	BinaryVersion = 4
+)
+
+const (
+	binAtom   byte = 0
+	binList   byte = 1
+	binDotted byte = 2
+)
+
+var errBadBinary = errors.New("sexpr: malformed binary payload")
+
+// WriteBinary writes s and the forms following it to w as a binfmt
+// container.
+func WriteBinary(w io.Writer, s *Sexpr) error {
+	var buf []byte
+	n := 0
+	for cur := s; cur != nil; cur = cur.next {
+		n++
+	}
+	buf = binary.AppendUvarint(buf, uint64(n))
+	var c binCursor
+	for cur := s; cur != nil; cur = cur.next {
+		buf = cur.appendBinary(buf, &c)
+	}
+	return binfmt.Write(w, BinaryKind, BinaryVersion, buf)
+}
+
+// what positions are stored relative to
+type binCursor struct {
+	off, line int
+}
+
+func (s *Sexpr) appendBinary(buf []byte, c *binCursor) []byte {
+	tag := binList
+	switch {
+	case s.sty == sexprAtom:
+		tag = binAtom
+	case s.tail != nil:
+		tag = binDotted
+	}
+	buf = append(buf, tag)
+	buf = binary.AppendVarint(buf, int64(s.pos-c.off))
+	buf = binary.AppendUvarint(buf, uint64(max(s.end-s.pos, 0)))
+	buf = binary.AppendVarint(buf, int64(s.line-c.line))
+	buf = binary.AppendUvarint(buf, uint64(max(s.col, 0)))
+	c.off, c.line = s.pos+1, s.line
+	defer func() { c.off = s.end }()
+
+	if s.sty == sexprAtom {
+		buf = append(buf, byte(s.aty))
+		buf = binary.AppendUvarint(buf, uint64(len(s.val)))
+		return append(buf, s.val...)
+	}
+	n := 0
+	for cur := s.list; cur != nil; cur = cur.next {
+		n++
+	}
+	buf = binary.AppendUvarint(buf, uint64(n))
+	for cur := s.list; cur != nil; cur = cur.next {
+		buf = cur.appendBinary(buf, c)
+	}
+	if s.tail != nil {
+		buf = s.tail.appendBinary(buf, c)
+	}
+	return buf
+}
+
+// ReadBinary reads forms written by WriteBinary (by this or any earlier
+// version of the package) from r.
+func ReadBinary(r io.Reader) (*Sexpr, error) {
+	h, payload, err := binfmt.ReadKind(r, BinaryKind, BinaryVersion)
+	if err != nil {
+		return nil, err
+	}
+	d := &binDecoder{buf: payload, version: h.KindVersion}
+	s, err := d.seq()
+	if err != nil {
+		return nil, err
+	}
+	if len(d.buf) != 0 {
+		return nil, errBadBinary
+	}
+	return s, nil
+}
+
+type binDecoder struct {
+	buf     []byte
+	version uint16
+	cursor  binCursor
+}
+
+func (d *binDecoder) uvarint() (int, error) {
+	v, n := binary.Uvarint(d.buf)
+	// every element takes at least one byte, so no count or length can
+	// exceed what is left
+	if n <= 0 || v > uint64(len(d.buf)) {
+		return 0, errBadBinary
+	}
+	d.buf = d.buf[n:]
+	return int(v), nil
+}
+
+// a length or column.  these measure the source text, not the payload,
+// so unlike counts they aren't bounded by what is left of it.
+func (d *binDecoder) position() (int, error) {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 || v > math.MaxInt {
+		return 0, errBadBinary
+	}
+	d.buf = d.buf[n:]
+	return int(v), nil
+}
+
+func (d *binDecoder) varint() (int, error) {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		return 0, errBadBinary
+	}
+	d.buf = d.buf[n:]
+	return int(v), nil
+}
+
+// a count followed by that many elements, linked into a chain
+func (d *binDecoder) seq() (*Sexpr, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	var head, prev *Sexpr
+	for i := 0; i < n; i++ {
+		s, err := d.elem()
+		if err != nil {
+			return nil, err
+		}
+		if prev == nil {
+			head = s
+		} else {
+			prev.next = s
+		}
+		prev = s
+	}
+	return head, nil
+}
+
+func (d *binDecoder) elem() (*Sexpr, error) {
+	if len(d.buf) == 0 {
+		return nil, errBadBinary
+	}
+	tag := d.buf[0]
+	d.buf = d.buf[1:]
+	var pos, end, line, col int
+	if d.version >= 2 {
+		gap, err := d.varint()
+		if err != nil {
+			return nil, err
+		}
+		length, err := d.position()
+		if err != nil {
+			return nil, err
+		}
+		pos = d.cursor.off + gap
+		end = pos + length
+		d.cursor.off = pos + 1
+		defer func() { d.cursor.off = end }()
+	}
+	if d.version >= 3 {
+		dl, err := d.varint()
+		if err != nil {
+			return nil, err
+		}
+		if col, err = d.position(); err != nil {
+			return nil, err
+		}
+		line = d.cursor.line + dl
+		d.cursor.line = line
+	}
+	switch tag {
+	case binAtom:
+		if len(d.buf) == 0 {
+			return nil, errBadBinary
+		}
+		// the stored kind is only informative: payloads from before
+		// atoms had kinds store 0 (Symbol) for all of them, so the kind
+		// is worked out from the text again
+		d.buf = d.buf[1:]
+		n, err := d.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		val := string(d.buf[:n])
+		s := &Sexpr{aty: classifyAtom(val), sty: sexprAtom, val: val, pos: pos, end: end, line: line, col: col}
+		d.buf = d.buf[n:]
+		return s, nil
+	case binList, binDotted:
+		list, err := d.seq()
+		if err != nil {
+			return nil, err
+		}
+		s := &Sexpr{aty: NotAtom, sty: sexprList, list: list, pos: pos, end: end, line: line, col: col}
+		if tag == binDotted {
+			if d.version < 4 || list == nil {
+				return nil, errBadBinary
+			}
+			if s.tail, err = d.elem(); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	}
+	return nil, errBadBinary
+}
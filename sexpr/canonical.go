@@ -0,0 +1,222 @@
+package sexpr
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+   canonical form
+
+   EncodeCanonical and ParseCanonical come with a round-trip contract that
+   the plain Parse/Text pair does not promise:
+
+     1. for any input x that parses, EncodeCanonical(ParseCanonical(x)) is
+        a fixed point: parsing and encoding it again yields the same bytes.
+     2. for any forms t produced by ParseCanonical, ParseCanonical of
+        EncodeCanonical(t) is EqualForms to t.
+
+   the canonical text of a sequence of forms is each form followed by a
+   newline.  a list is its elements separated by single spaces inside
+   parens, with a dotted list's tail after " . "; an atom is written in
+   its canonical spelling (see canonicalAtom), so "\u0061" is "a", +007
+   is 7, 1.00 and 10e-1 are 1.0, 2/4 is 1/2 and #\x41 is #\A.
+   whitespace and layout in the original input are not preserved.
+*/
+
+// EncodeCanonical renders s and the forms following it in canonical form.
+func EncodeCanonical(s *Sexpr) []byte {
+	var buf bytes.Buffer
+	for cur := s; cur != nil; cur = cur.next {
+		cur.writeCanonical(&buf)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func (s *Sexpr) writeCanonical(buf *bytes.Buffer) {
+	if s.sty == sexprAtom {
+		buf.WriteString(canonicalAtom(s))
+		return
+	}
+	buf.WriteByte('(')
+	for cur := s.list; cur != nil; cur = cur.next {
+		cur.writeCanonical(buf)
+		if cur.next != nil {
+			buf.WriteByte(' ')
+		}
+	}
+	if s.tail != nil {
+		buf.WriteString(" . ")
+		s.tail.writeCanonical(buf)
+	}
+	buf.WriteByte(')')
+}
+
+// the canonical spelling of an atom: one spelling for each value of
+// each kind, which reads back as an atom of the same kind and value.
+//
+//   - strings are quoted by NewString, escaping only what must be.  a
+//     string holding bytes that aren't UTF-8 can't be written any other
+//     way without losing them, so it keeps its text.
+//   - integers lose a + sign and leading zeros, and -0 is 0.
+//   - floats are their exact decimal value, with no trailing zeros:
+//     plain with at least one digit after the point when that takes
+//     at most 21 digits before it or 6 zeros after it, and otherwise
+//     in exponent form, 1.5e-7.  precision beyond a float64 is kept.
+//   - rationals are in lowest terms, 1/2, with the denominator even
+//     when it is 1.
+//   - characters are #\ and the character when it is graphic, their
+//     name when they have one, and #\x and hex otherwise.
+//   - byte strings are in padded base64, |YWJj|.
+//
+// symbols, keywords, booleans and nil have only one spelling.
+func canonicalAtom(s *Sexpr) string {
+	switch s.aty {
+	case String:
+		if text, err := s.Str(); err == nil && utf8.ValidString(text) {
+			return quoteString(text)
+		}
+	case Integer:
+		n, _ := s.BigInt()
+		return n.String()
+	case Float:
+		if f, ok := canonicalFloat(s.val); ok {
+			return f
+		}
+	case Rational:
+		r, _ := s.Rat()
+		return r.String()
+	case Char:
+		r, _ := s.Rune()
+		return charLiteral(r)
+	case Bytes:
+		b, _ := s.Bytes()
+		return "|" + base64.StdEncoding.EncodeToString(b) + "|"
+	}
+	return s.val
+}
+
+// the canonical spelling of the float atom v, or false if its exponent
+// is too big to work with
+func canonicalFloat(v string) (string, bool) {
+	sign := ""
+	switch v[0] {
+	case '-':
+		sign = "-"
+		fallthrough
+	case '+':
+		v = v[1:]
+	}
+	exp := 0
+	if i := strings.IndexAny(v, "eE"); i >= 0 {
+		n, err := strconv.Atoi(v[i+1:])
+		if err != nil || n > 1<<40 || n < -1<<40 {
+			return "", false
+		}
+		v, exp = v[:i], n
+	}
+	// the value is digits × 10^exp
+	whole, frac, _ := strings.Cut(v, ".")
+	digits := strings.TrimLeft(whole+frac, "0")
+	exp -= len(frac)
+	trimmed := strings.TrimRight(digits, "0")
+	exp += len(digits) - len(trimmed)
+	digits = trimmed
+	if digits == "" {
+		return sign + "0.0", true
+	}
+	// where the point goes, counting from the start of digits
+	point := len(digits) + exp
+	switch {
+	case 0 < point && point <= 21:
+		if point >= len(digits) {
+			return sign + digits + strings.Repeat("0", point-len(digits)) + ".0", true
+		}
+		return sign + digits[:point] + "." + digits[point:], true
+	case -6 < point && point <= 0:
+		return sign + "0." + strings.Repeat("0", -point) + digits, true
+	}
+	mant := digits[:1] + "." + digits[1:]
+	if len(digits) == 1 {
+		mant += "0"
+	}
+	return sign + mant + "e" + strconv.Itoa(point-1), true
+}
+
+// the canonical literal for the character r
+func charLiteral(r rune) string {
+	if unicode.IsGraphic(r) && !unicode.IsSpace(r) {
+		return `#\` + string(r)
+	}
+	for name, c := range charNames {
+		// nul is the other name for null
+		if c == r && name != "nul" {
+			return `#\` + name
+		}
+	}
+	return fmt.Sprintf(`#\x%x`, r)
+}
+
+// ParseCanonical parses data for use with EncodeCanonical; see the
+// contract above.  it is ParseAll, returning the forms as a sequence
+// linked through Next, with every atom given its canonical
+// spelling, so Value gives that rather than the text in data.
+func ParseCanonical(data []byte) (*Sexpr, error) {
+	s, err := parseForms(context.Background(), string(data))
+	if err != nil {
+		return nil, err
+	}
+	canonicalize(s)
+	return s, nil
+}
+
+// give every atom in s and the elements following it its canonical
+// spelling
+func canonicalize(s *Sexpr) {
+	for cur := s; cur != nil; cur = cur.next {
+		if cur.sty == sexprAtom {
+			cur.val = internAtom(canonicalAtom(cur))
+			continue
+		}
+		canonicalize(cur.list)
+		if cur.tail != nil {
+			canonicalize(cur.tail)
+		}
+	}
+}
+
+// Equal reports whether the elements a and b (not the elements following
+// them) have the same structure and atoms.  positions are ignored, and
+// atoms are compared by kind and canonical spelling, so "a" and
+// "\u0061" are equal, as are 1.0 and 1.00, but 1 and 1.0 are not.
+func Equal(a, b *Sexpr) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.sty != b.sty || a.aty != b.aty {
+		return false
+	}
+	if a.sty == sexprAtom {
+		return a.val == b.val || canonicalAtom(a) == canonicalAtom(b)
+	}
+	return EqualForms(a.list, b.list) && Equal(a.tail, b.tail)
+}
+
+// EqualForms reports whether the sequences starting at a and b have equal
+// elements, pairwise.
+func EqualForms(a, b *Sexpr) bool {
+	for a != nil && b != nil {
+		if !Equal(a, b) {
+			return false
+		}
+		a, b = a.next, b.next
+	}
+	return a == nil && b == nil
+}
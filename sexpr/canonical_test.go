@@ -0,0 +1,188 @@
+package sexpr
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+func TestCanonicalAtom(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"foo", "foo"},
+		{":key", ":key"},
+		{`"a"`, `"a"`},
+		{`"\u0061"`, `"a"`},
+		{`"\u00e9"`, `"é"`},
+		{`"tab\there"`, `"tab\there"`},
+		{`"\ud83d\ude00"`, `"😀"`},
+		{"+7", "7"},
+		{"007", "7"},
+		{"-0", "0"},
+		{"123456789012345678901234567890", "123456789012345678901234567890"},
+		{"1.0", "1.0"},
+		{"1.00", "1.0"},
+		{"10e-1", "1.0"},
+		{"+.5", "0.5"},
+		{"5.", "5.0"},
+		{"-0.0", "-0.0"},
+		{"0e10", "0.0"},
+		{"1.5e3", "1500.0"},
+		{"1e20", "100000000000000000000.0"},
+		{"1e21", "1.0e21"},
+		{"0.000001", "0.000001"},
+		{"1e-7", "1.0e-7"},
+		{"12.5E-9", "1.25e-8"},
+		{"0.1000000000000000000000001", "0.1000000000000000000000001"},
+		{"2/4", "1/2"},
+		{"-3/6", "-1/2"},
+		{"+4/2", "2/1"},
+		{"0/5", "0/1"},
+		{`#\a`, `#\a`},
+		{`#\x41`, `#\A`},
+		{`#\space`, `#\space`},
+		{`#\x20`, `#\space`},
+		{`#\nul`, `#\null`},
+		{`#\x7`, `#\alarm`},
+		{`#\x85`, `#\x85`},
+		{`#\(`, `#\(`},
+		{"#616263#", "|YWJj|"},
+		{"|YWI|", "|YWI=|"},
+		{"##", "||"},
+		{"#t", "#t"},
+		{"nil", "nil"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.in)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.in, err)
+		}
+		if got := canonicalAtom(s); got != tt.want {
+			t.Errorf("canonicalAtom(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+		if c, err := Parse(tt.want); err != nil || c.AtomKind() != s.AtomKind() {
+			t.Errorf("canonical %s of %s doesn't read back as a %s", tt.want, tt.in, s.AtomKind())
+		}
+	}
+}
+
+// spellings of the same atom, which must encode, compare and hash alike
+var sameAtoms = [][]string{
+	{`"a"`, `"\u0061"`},
+	{`"é\n"`, `"\u00e9\n"`, `"é\u000a"`},
+	{"1.0", "1.00", "10e-1", "+1.0", "0.1e1", "1E0"},
+	{"42", "+42", "0042"},
+	{"1/2", "2/4", "+50/100"},
+	{`#\A`, `#\x41`},
+	{`#\space`, `#\ `, `#\x20`},
+	{"|YWJj|", "#616263#", "#616263#"},
+}
+
+func TestCanonicalSpellings(t *testing.T) {
+	for _, class := range sameAtoms {
+		var want []byte
+		var first *Sexpr
+		for _, spelling := range class {
+			s, err := Parse("(x " + spelling + ")")
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", spelling, err)
+			}
+			enc := EncodeCanonical(s)
+			if first == nil {
+				want, first = enc, s
+				continue
+			}
+			if !bytes.Equal(enc, want) {
+				t.Errorf("%s encodes as %q, %s as %q", class[0], want, spelling, enc)
+			}
+			if !Equal(s, first) {
+				t.Errorf("%s and %s aren't Equal", class[0], spelling)
+			}
+			if s.Hash() != first.Hash() {
+				t.Errorf("%s and %s hash differently", class[0], spelling)
+			}
+		}
+	}
+	for _, pair := range [][2]string{{"1", "1.0"}, {"1/1", "1"}, {`"a"`, "a"}, {"|YQ==|", `"a"`}} {
+		a, _ := Parse(pair[0])
+		b, _ := Parse(pair[1])
+		if Equal(a, b) || a.Hash() == b.Hash() {
+			t.Errorf("%s and %s should differ", pair[0], pair[1])
+		}
+	}
+}
+
+// the text of s and the forms following it, as read
+func docText(s *Sexpr) string {
+	var b strings.Builder
+	for cur := s; cur != nil; cur = cur.Next() {
+		b.WriteString(cur.Text())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// a random document mixing random forms with atoms spelled any way they
+// may be, canonical or not
+func randomSpelling(r *rand.Rand, size int) string {
+	var pieces []string
+	for n := 1 + r.Intn(8); n > 0; n-- {
+		if r.Intn(2) == 0 {
+			pieces = append(pieces, docText(Random(r, size)))
+			continue
+		}
+		class := sameAtoms[r.Intn(len(sameAtoms))]
+		pieces = append(pieces, class[r.Intn(len(class))])
+	}
+	// wrap runs of pieces in lists
+	for len(pieces) > 1 && r.Intn(3) > 0 {
+		i := r.Intn(len(pieces))
+		j := i + 1 + r.Intn(len(pieces)-i)
+		list := "(" + strings.Join(pieces[i:j], " ") + " )"
+		pieces = append(pieces[:i], append([]string{list}, pieces[j:]...)...)
+	}
+	return strings.Join(pieces, " ") + " "
+}
+
+// the contract in canonical.go
+func TestCanonicalRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	cfg := &quick.Config{MaxCount: 2000, Rand: r}
+	fixedPoint := func(seed int64) bool {
+		x := randomSpelling(rand.New(rand.NewSource(seed)), 40)
+		t1, err := ParseCanonical([]byte(x))
+		if err != nil {
+			t.Logf("ParseCanonical(%q): %v", x, err)
+			return false
+		}
+		enc := EncodeCanonical(t1)
+		t2, err := ParseCanonical(enc)
+		if err != nil {
+			t.Logf("ParseCanonical(%q): %v", enc, err)
+			return false
+		}
+		if again := EncodeCanonical(t2); !bytes.Equal(again, enc) {
+			t.Logf("%q encodes as %q, then %q", x, enc, again)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(fixedPoint, cfg); err != nil {
+		t.Error("encode(parse(x)) isn't a fixed point:", err)
+	}
+	structural := func(s *Sexpr) bool {
+		t1, err := ParseCanonical([]byte(docText(s)))
+		if err != nil {
+			return false
+		}
+		t2, err := ParseCanonical(EncodeCanonical(t1))
+		return err == nil && EqualForms(t1, t2) && EqualForms(s, t2) &&
+			t1.Text() == t2.Text()
+	}
+	if err := quick.Check(structural, cfg); err != nil {
+		t.Error("parse(encode(t)) isn't t:", err)
+	}
+}
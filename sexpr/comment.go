@@ -0,0 +1,39 @@
+package sexpr
+
+import (
+	"context"
+	"time"
+
+	"github.com/mjsottile/gocode/diag"
+)
+
+// Comment is a comment in parsed input: a ; comment, running to the end
+// of its line, or a #| |# block comment, which may nest.  Parse skips
+// comments; ParseComments hands them back alongside the tree.
+type Comment struct {
+	Text string // the whole comment, from the ; or #| on
+	Pos  diag.Position
+}
+
+// End is the byte offset just past the comment.
+func (c Comment) End() int { return c.Pos.Offset + len(c.Text) }
+
+// ParseComments is ParseAll, returning the forms as a sequence linked
+// through Next, and also the comments in the input in the order they
+// appear.
+func ParseComments(input string) (*Sexpr, []Comment, error) {
+	start := time.Now()
+	ctx := context.Background()
+	_, items := lex(ctx, "", input)
+	p := &parser{input: input, items: items, ctx: ctx, keepComments: true}
+	s, err := p.parse()
+	if err != nil {
+		for range items {
+			p.tokens++
+		}
+		recordParse(p.tokens, nil, err, start)
+		return nil, nil, err
+	}
+	recordParse(p.tokens, s, nil, start)
+	return s, p.comments, nil
+}
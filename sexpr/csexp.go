@@ -0,0 +1,201 @@
+package sexpr
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mjsottile/gocode/diag"
+)
+
+/*
+   Rivest canonical s-expressions
+
+   the canonical encoding of Rivest's S-expressions draft, as used by
+   SPKI: every atom is an octet string written as its length in decimal,
+   a colon and the octets, and lists are parens around their elements,
+   with nothing in between:
+
+	(server (host "example.org") (port 8080))
+	(6:server(4:host11:example.org)(4:port4:8080))
+
+   there is exactly one encoding of each tree, so it is what to hash or
+   sign.  in Rivest's model a token, a quoted string and any other
+   spelling of the same octets are the same atom, so a string's octets
+   are its contents, without the quotes, a byte string's are the bytes
+   it holds, and every other atom's are its text: "abc", |YWJj| and abc
+   encode the same.  decoding gives back an atom of the kind its octets
+   read as, a string if they aren't valid atom text, and a byte string
+   if they aren't UTF-8.
+*/
+
+// ErrCsexp is wrapped by the errors ParseCsexp returns for data that
+// isn't a canonical s-expression, and by those EncodeCsexp returns for
+// trees that can't be written as one.
+var ErrCsexp = errors.New("sexpr: bad canonical s-expression")
+
+// EncodeCsexp writes s and every element following it in Rivest's
+// canonical encoding, one after the other.  dotted lists have no
+// encoding and give an error.
+func EncodeCsexp(s *Sexpr) ([]byte, error) {
+	var buf bytes.Buffer
+	for cur := s; cur != nil; cur = cur.next {
+		if err := cur.writeCsexp(&buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *Sexpr) writeCsexp(buf *bytes.Buffer) error {
+	if s.IsAtom() {
+		octets, err := s.octets()
+		if err != nil {
+			return err
+		}
+		buf.WriteString(strconv.Itoa(len(octets)))
+		buf.WriteByte(':')
+		buf.WriteString(octets)
+		return nil
+	}
+	if s.tail != nil {
+		return diag.Errorf(s.Position(), ErrCsexp, "dotted list has no canonical encoding")
+	}
+	buf.WriteByte('(')
+	for cur := s.list; cur != nil; cur = cur.next {
+		if err := cur.writeCsexp(buf); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(')')
+	return nil
+}
+
+// the octets of an atom, in Rivest's sense: a string's contents, a byte
+// string's bytes, or the text of any other atom
+func (s *Sexpr) octets() (string, error) {
+	if s.aty == Bytes {
+		b, _ := s.Bytes()
+		return string(b), nil
+	}
+	if s.aty != String {
+		return s.val, nil
+	}
+	text, err := s.Str()
+	if err != nil {
+		return "", diag.Errorf(s.Position(), err, "%v", err)
+	}
+	return text, nil
+}
+
+// ParseCsexp reads data in Rivest's canonical encoding and returns the
+// elements in it, in order, linked through Next like the forms ParseAll
+// returns.  the canonical encoding has no whitespace, display hints or
+// leading zeros in lengths, and data with any of them is refused.
+// positions of elements are their byte offsets in data.  errors are
+// *diag.SourceErrors wrapping ErrCsexp, ErrUnexpectedParen or
+// ErrUnexpectedEOF.
+func ParseCsexp(data []byte) (*Sexpr, error) {
+	var forms []*Sexpr
+	for off := 0; off < len(data); {
+		s, n, err := parseCsexp(data, off)
+		if err != nil {
+			return nil, err
+		}
+		forms = append(forms, s)
+		off = n
+	}
+	return NewForms(forms...), nil
+}
+
+// parse the element at data[off:], returning it and the offset after it
+func parseCsexp(data []byte, off int) (*Sexpr, int, error) {
+	fail := func(at int, err error, format string, args ...any) error {
+		return diag.Errorf(diag.Position{Offset: at}, err, format, args...)
+	}
+	start := off
+	switch c := data[off]; {
+	case c == ')':
+		return nil, 0, fail(off, ErrUnexpectedParen, "unexpected )")
+	case c == '(':
+		var elems []*Sexpr
+		off++
+		for {
+			if off == len(data) {
+				return nil, 0, fail(start, ErrUnexpectedEOF, "list not closed")
+			}
+			if data[off] == ')' {
+				break
+			}
+			el, n, err := parseCsexp(data, off)
+			if err != nil {
+				return nil, 0, err
+			}
+			elems = append(elems, el)
+			off = n
+		}
+		s := NewList(elems...)
+		s.pos, s.end = start, off+1
+		return s, off + 1, nil
+	case c < '0' || c > '9':
+		if c == '[' {
+			return nil, 0, fail(off, ErrCsexp, "display hints aren't supported")
+		}
+		return nil, 0, fail(off, ErrCsexp, "expected a length or a paren, not %q", c)
+	}
+	for off < len(data) && '0' <= data[off] && data[off] <= '9' {
+		off++
+	}
+	digits := string(data[start:off])
+	if len(digits) > 1 && digits[0] == '0' {
+		return nil, 0, fail(start, ErrCsexp, "length %s has a leading zero", digits)
+	}
+	if off == len(data) || data[off] != ':' {
+		return nil, 0, fail(off, ErrCsexp, "expected : after length %s", digits)
+	}
+	n, err := strconv.Atoi(digits)
+	off++
+	if err != nil || n > len(data)-off {
+		return nil, 0, fail(start, ErrUnexpectedEOF, "octet string of length %s runs past the end", digits)
+	}
+	s := csexpAtom(string(data[off : off+n]))
+	s.pos, s.end = start, off+n
+	return s, off + n, nil
+}
+
+// the atom for an octet string: the atom it reads as, a string, or a
+// byte string if it isn't text
+func csexpAtom(octets string) *Sexpr {
+	if !utf8.ValidString(octets) {
+		return NewBytes([]byte(octets))
+	}
+	// text spelled like a byte string is a string, or it would decode to
+	// other octets
+	if kind := classifyAtom(octets); kind != String && kind != Bytes && isBareAtom(octets, kind) {
+		return NewAtom(octets)
+	}
+	return NewString(octets)
+}
+
+// true if text, which isn't a string and classifies as kind, on its own
+// reads as a single atom with that text: it doesn't start with a quote
+// or #|, past a leading #\ and the character after it there is nothing
+// that would end the atom, and it isn't a malformed character or byte
+// string.  this is how lexAtom and parse read it, without running them.
+func isBareAtom(text string, kind AtomKind) bool {
+	if text == "" || text == "." || strings.HasPrefix(text, "#|") ||
+		strings.IndexByte("'`,", text[0]) >= 0 {
+		return false
+	}
+	if strings.HasPrefix(text, `#\`) && kind != Char || looksLikeBytes(text) && kind != Bytes {
+		return false
+	}
+	rest := text
+	if name, ok := strings.CutPrefix(text, `#\`); ok {
+		_, n := utf8.DecodeRuneInString(name)
+		rest = name[n:]
+	}
+	return !strings.ContainsAny(rest, "();\" \t\r\n")
+}
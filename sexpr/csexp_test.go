@@ -0,0 +1,79 @@
+package sexpr
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"testing/quick"
+)
+
+func TestCsexpAtom(t *testing.T) {
+	tests := []struct {
+		octets, want string
+	}{
+		{"abc", "abc"},
+		{"42", "42"},
+		{":key", ":key"},
+		{`#\(`, `#\(`},
+		{`#\space`, `#\space`},
+		{"#t", "#t"},
+		{"a'b", "a'b"},
+		{"a#|b", "a#|b"},
+		{"", `""`},
+		{".", `"."`},
+		{"a b", `"a b"`},
+		{"a;b", `"a;b"`},
+		{"(a)", `"(a)"`},
+		{`a"b`, `"a\"b"`},
+		{"'a", `"'a"`},
+		{",@a", `",@a"`},
+		{"#|a", `"#|a"`},
+		{`#\`, `"#\\"`},
+		{`#\nope`, `"#\\nope"`},
+		{"|x|", `"|x|"`},
+		{"|YWJj|", `"|YWJj|"`},
+		{`"a"`, `"\"a\""`},
+		{"\xff\x00", "|/wA=|"},
+	}
+	for _, tt := range tests {
+		got := csexpAtom(tt.octets)
+		if got.val != tt.want {
+			t.Errorf("csexpAtom(%q) = %s, want %s", tt.octets, got.val, tt.want)
+		}
+		if octets, err := got.octets(); err != nil || octets != tt.octets {
+			t.Errorf("csexpAtom(%q) has octets %q, %v", tt.octets, octets, err)
+		}
+	}
+}
+
+// decoding a canonical s-expression gives a tree that encodes the same
+// and whose text reads back
+func TestCsexpRoundTrip(t *testing.T) {
+	cfg := &quick.Config{MaxCount: 2000, Rand: rand.New(rand.NewSource(6))}
+	prop := func(s *Sexpr) bool {
+		enc, err := EncodeCsexp(s)
+		if err != nil {
+			// dotted lists have no encoding
+			return true
+		}
+		dec, err := ParseCsexp(enc)
+		if err != nil {
+			t.Logf("ParseCsexp(%q): %v", enc, err)
+			return false
+		}
+		again, err := EncodeCsexp(dec)
+		if err != nil || !bytes.Equal(again, enc) {
+			t.Logf("%q decodes to %s, which encodes as %q, %v", enc, docText(dec), again, err)
+			return false
+		}
+		back, err := ParseAll(docText(dec))
+		if err != nil || !EqualForms(NewForms(back...), dec) {
+			t.Logf("%s doesn't read back: %v", docText(dec), err)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(prop, cfg); err != nil {
+		t.Error(err)
+	}
+}
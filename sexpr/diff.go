@@ -0,0 +1,335 @@
+package sexpr
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ChangeKind says what a Change does.
+type ChangeKind int
+
+const (
+	ChangeInsert ChangeKind = iota
+	ChangeDelete
+	ChangeReplace
+)
+
+var changeNames = [...]string{"insert", "delete", "replace"}
+
+func (k ChangeKind) String() string {
+	if int(k) < len(changeNames) {
+		return changeNames[k]
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change is one step of an edit script produced by Diff.  Path locates
+// an element: the first index picks a top-level form and each following
+// one an element of the list picked so far.  a delete or replace removes
+// the element at Path (which should be Equal to Old); an insert puts New
+// at Path, shifting the element there and those after it right; a
+// replace puts New where Old was.  Old and New are detached from their
+// trees, so they have no elements following them.
+type Change struct {
+	Kind ChangeKind
+	Path []int
+	Old  *Sexpr
+	New  *Sexpr
+}
+
+// Diff computes an edit script turning the forms starting at a into
+// those starting at b.  within each list the elements are aligned with a
+// longest common subsequence; unaligned lists on both sides are diffed
+// recursively rather than replaced wholesale.
+//
+// the changes are ordered so they can be applied one after another:
+// each touches only positions at or after those of the changes that
+// follow it, which also means every Path is valid in a as given.
+func Diff(a, b *Sexpr) []Change {
+	var out []Change
+	diffSeq(chainSlice(a), chainSlice(b), nil, &out)
+	return out
+}
+
+// one step in the alignment of two element sequences
+type diffStep struct {
+	kind ChangeKind // insert, delete, replace; descend uses replace with sub set
+	at   int        // index in the old sequence the step applies at
+	old  *Sexpr
+	new  *Sexpr
+	sub  bool // both lists: diff their contents instead of replacing
+}
+
+func diffSeq(a, b []*Sexpr, prefix []int, out *[]Change) {
+	// keys make the LCS comparisons cheap string compares
+	ka, kb := make([]string, len(a)), make([]string, len(b))
+	for i, s := range a {
+		ka[i] = s.diffKey()
+	}
+	for j, s := range b {
+		kb[j] = s.diffKey()
+	}
+	var steps []diffStep
+	// turn a gap of unmatched elements a[i0:i1], b[j0:j1] into steps
+	gap := func(i0, i1, j0, j1 int) {
+		k := 0
+		for ; i0+k < i1 && j0+k < j1; k++ {
+			o, n := a[i0+k], b[j0+k]
+			steps = append(steps, diffStep{kind: ChangeReplace, at: i0 + k, old: o, new: n,
+				sub: o.sty == sexprList && n.sty == sexprList && Equal(o.tail, n.tail)})
+		}
+		for i := i0 + k; i < i1; i++ {
+			steps = append(steps, diffStep{kind: ChangeDelete, at: i, old: a[i]})
+		}
+		for j := j0 + k; j < j1; j++ {
+			steps = append(steps, diffStep{kind: ChangeInsert, at: i1, new: b[j]})
+		}
+	}
+	gi, gj := 0, 0
+	for _, m := range commonSubsequence(ka, kb) {
+		gap(gi, m[0], gj, m[1])
+		gi, gj = m[0]+1, m[1]+1
+	}
+	gap(gi, len(a), gj, len(b))
+
+	// emit back to front so earlier positions stay valid
+	for k := len(steps) - 1; k >= 0; k-- {
+		st := steps[k]
+		path := append(append([]int(nil), prefix...), st.at)
+		if st.sub {
+			diffSeq(chainSlice(st.old.list), chainSlice(st.new.list), path, out)
+			continue
+		}
+		*out = append(*out, Change{Kind: st.kind, Path: path,
+			Old: detach(st.old), New: detach(st.new)})
+	}
+}
+
+// the pairs of indices (i, j) with a[i] == b[j] of a longest common
+// subsequence of a and b, in order.  this is Myers' O(ND) algorithm in
+// its linear space form, so two long sequences that differ in a few
+// places cost little more than reading them.
+func commonSubsequence(a, b []string) [][2]int {
+	var pairs [][2]int
+	var compare func(a0, a1, b0, b1 int)
+	compare = func(a0, a1, b0, b1 int) {
+		for a0 < a1 && b0 < b1 && a[a0] == b[b0] {
+			pairs = append(pairs, [2]int{a0, b0})
+			a0, b0 = a0+1, b0+1
+		}
+		suffix := 0
+		for a1 > a0 && b1 > b0 && a[a1-1] == b[b1-1] {
+			a1, b1 = a1-1, b1-1
+			suffix++
+		}
+		if a0 < a1 && b0 < b1 {
+			x, y, u, v := middleSnake(a[a0:a1], b[b0:b1])
+			if u-x > 0 || x+y > 0 && u+v < a1-a0+b1-b0 {
+				compare(a0, a0+x, b0, b0+y)
+				for k := 0; k < u-x; k++ {
+					pairs = append(pairs, [2]int{a0 + x + k, b0 + y + k})
+				}
+				compare(a0+u, a1, b0+v, b1)
+			}
+		}
+		for k := 0; k < suffix; k++ {
+			pairs = append(pairs, [2]int{a1 + k, b1 + k})
+		}
+	}
+	compare(0, len(a), 0, len(b))
+	return pairs
+}
+
+// the middle snake of a shortest edit script from a to b: a run of
+// matching elements from (x, y) to (u, v) that such a script passes
+// through about halfway, found by searching from both ends at once.
+// the reverse search works on the sequences read backwards, so its
+// diagonal k is the forward one delta-k.
+func middleSnake(a, b []string) (x, y, u, v int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta&1 != 0
+	limit := (n + m + 1) / 2
+	off := limit + 1
+	fwd := make([]int, 2*limit+3)
+	rev := make([]int, 2*limit+3)
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && fwd[off+k-1] < fwd[off+k+1] {
+				x = fwd[off+k+1]
+			} else {
+				x = fwd[off+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			fwd[off+k] = x
+			if odd && k >= delta-(d-1) && k <= delta+(d-1) && x+rev[off+delta-k] >= n {
+				return x0, y0, x, y
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && rev[off+k-1] < rev[off+k+1] {
+				x = rev[off+k+1]
+			} else {
+				x = rev[off+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x, y = x+1, y+1
+			}
+			rev[off+k] = x
+			if !odd && k >= delta-d && k <= delta+d && x+fwd[off+delta-k] >= n {
+				return n - x, m - y, n - x0, m - y0
+			}
+		}
+	}
+	// not reached: the searches always meet by then
+	return 0, 0, 0, 0
+}
+
+// the elements of a chain as a slice
+func chainSlice(s *Sexpr) []*Sexpr {
+	var out []*Sexpr
+	for cur := s; cur != nil; cur = cur.next {
+		out = append(out, cur)
+	}
+	return out
+}
+
+// a copy of s without the elements following it.  the contents of a
+// list are shared.
+func detach(s *Sexpr) *Sexpr {
+	if s == nil {
+		return nil
+	}
+	n := *s
+	n.next = nil
+	return &n
+}
+
+// a string equal for two elements exactly when they are Equal
+func (s *Sexpr) diffKey() string {
+	h := s.Hash()
+	return string(h[:])
+}
+
+// String renders the change in the edit-script syntax used by
+// EncodeChanges.
+func (c Change) String() string {
+	var buf bytes.Buffer
+	c.write(&buf)
+	return buf.String()
+}
+
+func (c Change) write(buf *bytes.Buffer) {
+	buf.WriteByte('(')
+	buf.WriteString(c.Kind.String())
+	buf.WriteString(" (")
+	for i, p := range c.Path {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(strconv.Itoa(p))
+	}
+	buf.WriteByte(')')
+	if c.Old != nil {
+		buf.WriteByte(' ')
+		c.Old.writeCanonical(buf)
+	}
+	if c.New != nil {
+		buf.WriteByte(' ')
+		c.New.writeCanonical(buf)
+	}
+	buf.WriteByte(')')
+}
+
+// EncodeChanges renders an edit script as s-expressions, one change per
+// line:
+//
+//	(insert (PATH...) NEW)
+//	(delete (PATH...) OLD)
+//	(replace (PATH...) OLD NEW)
+func EncodeChanges(cs []Change) []byte {
+	var buf bytes.Buffer
+	for _, c := range cs {
+		c.write(&buf)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// ParseChanges reads an edit script written by EncodeChanges.
+func ParseChanges(data []byte) ([]Change, error) {
+	forms, err := ParseAll(string(data))
+	if err != nil {
+		return nil, err
+	}
+	var cs []Change
+	for _, f := range forms {
+		c, err := parseChange(f)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+func parseChange(f *Sexpr) (Change, error) {
+	var c Change
+	parts := chainSlice(f.list)
+	if f.sty != sexprList || len(parts) < 3 || parts[0].sty != sexprAtom {
+		return c, fmt.Errorf("sexpr: malformed change %s", elementText(f))
+	}
+	want := 3
+	switch parts[0].val {
+	case "insert":
+		c.Kind = ChangeInsert
+	case "delete":
+		c.Kind = ChangeDelete
+	case "replace":
+		c.Kind, want = ChangeReplace, 4
+	default:
+		return c, fmt.Errorf("sexpr: unknown change kind %q", parts[0].val)
+	}
+	if len(parts) != want || parts[1].sty != sexprList {
+		return c, fmt.Errorf("sexpr: malformed %s change", parts[0].val)
+	}
+	for _, p := range chainSlice(parts[1].list) {
+		n, err := strconv.Atoi(p.val)
+		if p.sty != sexprAtom || err != nil || n < 0 {
+			return c, fmt.Errorf("sexpr: bad path element %q in %s change", p.val, parts[0].val)
+		}
+		c.Path = append(c.Path, n)
+	}
+	if len(c.Path) == 0 {
+		return c, fmt.Errorf("sexpr: empty path in %s change", parts[0].val)
+	}
+	switch c.Kind {
+	case ChangeInsert:
+		c.New = detach(parts[2])
+	case ChangeDelete:
+		c.Old = detach(parts[2])
+	case ChangeReplace:
+		c.Old, c.New = detach(parts[2]), detach(parts[3])
+	}
+	return c, nil
+}
+
+// PathString formats a path the way the command-line tools accept them,
+// as dot-separated indices.
+func PathString(path []int) string {
+	s := make([]string, len(path))
+	for i, p := range path {
+		s[i] = strconv.Itoa(p)
+	}
+	return strings.Join(s, ".")
+}
@@ -0,0 +1,88 @@
+package sexpr
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// the length of a longest common subsequence, the slow way
+func lcsLength(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := len(a) - 1; i >= 0; i-- {
+		cur := make([]int, len(b)+1)
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				cur[j] = prev[j+1] + 1
+			} else {
+				cur[j] = max(prev[j], cur[j+1])
+			}
+		}
+		prev = cur
+	}
+	return prev[0]
+}
+
+func TestCommonSubsequence(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	letters := func() []string {
+		s := make([]string, r.Intn(30))
+		for i := range s {
+			s[i] = string(rune('a' + r.Intn(4)))
+		}
+		return s
+	}
+	for n := 0; n < 5000; n++ {
+		a, b := letters(), letters()
+		pairs := commonSubsequence(a, b)
+		if want := lcsLength(a, b); len(pairs) != want {
+			t.Fatalf("%q, %q: %d pairs, want %d", a, b, len(pairs), want)
+		}
+		for k, p := range pairs {
+			if a[p[0]] != b[p[1]] || k > 0 && (p[0] <= pairs[k-1][0] || p[1] <= pairs[k-1][1]) {
+				t.Fatalf("%q, %q: bad pairs %v", a, b, pairs)
+			}
+		}
+	}
+}
+
+// applying Diff(a, b) to a gives b
+func TestDiffPatch(t *testing.T) {
+	cfg := &quick.Config{MaxCount: 1000, Rand: rand.New(rand.NewSource(2))}
+	prop := func(a, b *Sexpr) bool {
+		got, err := Patch(a, Diff(a, b))
+		return err == nil && EqualForms(got, b)
+	}
+	if err := quick.Check(prop, cfg); err != nil {
+		t.Error(err)
+	}
+}
+
+// a long document with one change is diffed in time and space
+// proportional to its length, not its length squared
+func TestDiffLong(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&b, "(item %d)\n", i)
+	}
+	old := b.String()
+	a, err := ParseAll(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ParseAll(strings.Replace(old, "(item 50000)", "(item fifty-thousand)", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	cs := Diff(a[0], c[0])
+	if len(cs) != 1 || PathString(cs[0].Path) != "50000.1" {
+		t.Errorf("Diff gave %v", cs)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Diff took %v", d)
+	}
+}
@@ -0,0 +1,108 @@
+package sexpr
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// FormatOptions controls how Format lays out an element.  the zero value
+// gives the defaults noted on each field.
+type FormatOptions struct {
+	// spaces of indentation for the elements of a list that is broken
+	// over several lines, relative to its opening paren.  0 means 2.
+	Indent int
+
+	// the column lines should stay within.  a list that fits in what is
+	// left of its line is written on it as it is; one that doesn't is
+	// broken.  atoms are never broken, so a long one can overrun.  0
+	// means 80.
+	Width int
+
+	// how many elements of a broken list stay on the line of its opening
+	// paren: 0 means 1, the head, as in (define x followed by the body
+	// on the lines below; a negative value keeps none, so even the head
+	// starts on a line of its own.
+	Head int
+
+	// how many atoms can share a line among the elements of a broken
+	// list, which lets long runs of numbers or symbols be packed instead
+	// of taking a line each.  lists always start a new line.  0 means 1.
+	MaxAtoms int
+}
+
+func (o FormatOptions) withDefaults() FormatOptions {
+	if o.Indent <= 0 {
+		o.Indent = 2
+	}
+	if o.Width <= 0 {
+		o.Width = 80
+	}
+	switch {
+	case o.Head == 0:
+		o.Head = 1
+	case o.Head < 0:
+		o.Head = 0
+	}
+	if o.MaxAtoms <= 0 {
+		o.MaxAtoms = 1
+	}
+	return o
+}
+
+// Format renders s (not the elements following it) over as many lines
+// as opts call for.  like Text, parsing the result gives back an Equal
+// element.
+func Format(s *Sexpr, opts FormatOptions) string {
+	f := formatter{opts: opts.withDefaults()}
+	f.write(s, 0)
+	return f.b.String()
+}
+
+type formatter struct {
+	opts FormatOptions
+	b    strings.Builder
+}
+
+// write s starting at column col, returning the column after it
+func (f *formatter) write(s *Sexpr, col int) int {
+	flat := s.Text()
+	n := utf8.RuneCountInString(flat)
+	if s.IsAtom() || col+n <= f.opts.Width {
+		f.b.WriteString(flat)
+		return col + n
+	}
+	kids := s.Children()
+	if s.tail != nil {
+		// laid out like two more elements; the dot is an atom as far as
+		// packing goes
+		kids = append(kids, &Sexpr{sty: sexprAtom, val: "."}, s.tail)
+	}
+	inner := col + f.opts.Indent
+	f.b.WriteByte('(')
+	cur := col + 1
+	atoms := 0 // atoms on the current line of elements
+	for i, c := range kids {
+		switch {
+		case i == 0 && f.opts.Head > 0:
+		case i < f.opts.Head:
+			f.b.WriteByte(' ')
+			cur++
+		case c.IsAtom() && atoms > 0 && atoms < f.opts.MaxAtoms &&
+			cur+1+utf8.RuneCountInString(c.val) <= f.opts.Width:
+			f.b.WriteByte(' ')
+			cur++
+		default:
+			f.b.WriteByte('\n')
+			f.b.WriteString(strings.Repeat(" ", inner))
+			cur, atoms = inner, 0
+		}
+		cur = f.write(c, cur)
+		if c.IsAtom() && i >= f.opts.Head {
+			atoms++
+		} else {
+			atoms = 0
+		}
+	}
+	f.b.WriteByte(')')
+	return cur + 1
+}
@@ -0,0 +1,71 @@
+package sexpr
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// Hash is a content hash of an element: SHA-256 over its structure and
+// atoms, built bottom-up from the hashes of its elements like a Merkle
+// tree.  two elements have the same Hash exactly when they are Equal
+// (barring a SHA-256 collision), wherever they appear and whatever
+// their positions.
+type Hash [sha256.Size]byte
+
+func (h Hash) String() string { return hex.EncodeToString(h[:]) }
+
+// the first byte hashed for each kind of element, so an atom and a list
+// can never hash alike.  a dotted list hashes its tail after its
+// elements and has a byte of its own, so it can't be taken for the
+// proper list with the tail as its last element.
+const (
+	hashAtom byte = iota
+	hashList
+	hashDotted
+)
+
+// Hash returns the content hash of s (not of the elements following
+// it).  it is computed once and cached on each node, so after the first
+// call comparing two subtrees for equality is a comparison of hashes,
+// and rehashing a tree in which only a few nodes were replaced only
+// hashes the new nodes and their ancestors.  the cache is filled in
+// without locking, so a tree shared between goroutines should be hashed
+// (by calling Hash on its top-level forms) before it is shared.
+func (s *Sexpr) Hash() Hash {
+	if s.hash != nil {
+		return *s.hash
+	}
+	d := sha256.New()
+	var buf [binary.MaxVarintLen64 + 2]byte
+	if s.sty == sexprAtom {
+		// an atom's kind follows from its text, so it isn't hashed.  the
+		// byte it took before atoms had kinds is still there, always 0,
+		// so hashes (and the castore blobs named by them) stay the same
+		// for atoms already in their canonical spelling.  other
+		// spellings hash as that one does, as Equal compares them.
+		val := canonicalAtom(s)
+		buf[0], buf[1] = hashAtom, 0
+		n := binary.PutUvarint(buf[2:], uint64(len(val)))
+		d.Write(buf[:2+n])
+		d.Write([]byte(val))
+	} else {
+		buf[0] = hashList
+		if s.tail != nil {
+			buf[0] = hashDotted
+		}
+		d.Write(buf[:1])
+		for cur := s.list; cur != nil; cur = cur.next {
+			h := cur.Hash()
+			d.Write(h[:])
+		}
+		if s.tail != nil {
+			h := s.tail.Hash()
+			d.Write(h[:])
+		}
+	}
+	var h Hash
+	d.Sum(h[:0])
+	s.hash = &h
+	return h
+}
@@ -0,0 +1,117 @@
+package sexpr
+
+import (
+	"hash/maphash"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// InternTable maps atom text to a single shared copy of it, so that the
+// same symbol parsed from many documents is stored once, and atoms
+// don't keep the whole input they were sliced from alive.  it is safe
+// for concurrent use: the table is split into shards by a hash of the
+// text, each with its own lock, so parses running in parallel rarely
+// wait on each other.
+type InternTable struct {
+	seed     maphash.Seed
+	perShard int // 0 for no limit
+	shards   [internShards]internShard
+
+	hits, misses, dropped, bytes atomic.Int64
+}
+
+const internShards = 64
+
+type internShard struct {
+	mu sync.RWMutex
+	m  map[string]string
+}
+
+// InternStats counts what an InternTable has been asked to do.
+type InternStats struct {
+	Entries int   // distinct strings held
+	Bytes   int64 // their total length
+	Hits    int64 // lookups that found a shared copy
+	Misses  int64 // lookups that added one
+	Dropped int64 // lookups that couldn't add one because the table was full
+}
+
+// NewInternTable returns an empty table holding at most about
+// maxEntries strings, or any number if maxEntries <= 0.  the cap is
+// enforced per shard, so a table can fill up a little before reaching
+// it.  once full the table stops growing: strings already in it are
+// still shared, new ones are returned as they are.
+func NewInternTable(maxEntries int) *InternTable {
+	t := &InternTable{seed: maphash.MakeSeed()}
+	if maxEntries > 0 {
+		t.perShard = max(maxEntries/internShards, 1)
+	}
+	for i := range t.shards {
+		t.shards[i].m = make(map[string]string)
+	}
+	return t
+}
+
+// Intern returns the table's copy of s, adding one if there isn't one
+// yet.
+func (t *InternTable) Intern(s string) string {
+	sh := &t.shards[maphash.String(t.seed, s)%internShards]
+	sh.mu.RLock()
+	v, ok := sh.m[s]
+	sh.mu.RUnlock()
+	if ok {
+		t.hits.Add(1)
+		return v
+	}
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if v, ok := sh.m[s]; ok {
+		t.hits.Add(1)
+		return v
+	}
+	if t.perShard > 0 && len(sh.m) >= t.perShard {
+		t.dropped.Add(1)
+		return s
+	}
+	// copy, so the table doesn't pin the input s was sliced from
+	v = strings.Clone(s)
+	sh.m[v] = v
+	t.misses.Add(1)
+	t.bytes.Add(int64(len(v)))
+	return v
+}
+
+// Stats returns the table's size and counts so far.
+func (t *InternTable) Stats() InternStats {
+	st := InternStats{
+		Bytes:   t.bytes.Load(),
+		Hits:    t.hits.Load(),
+		Misses:  t.misses.Load(),
+		Dropped: t.dropped.Load(),
+	}
+	for i := range t.shards {
+		sh := &t.shards[i]
+		sh.mu.RLock()
+		st.Entries += len(sh.m)
+		sh.mu.RUnlock()
+	}
+	return st
+}
+
+var internTable atomic.Pointer[InternTable]
+
+// SetInternTable makes every parse from now on intern its atoms in t,
+// so a server parsing many documents at once shares one pool between
+// them.  passing nil turns interning off, which is the default.
+func SetInternTable(t *InternTable) {
+	internTable.Store(t)
+}
+
+// the text the parser stores for an atom lexed as v
+func internAtom(v string) string {
+	if t := internTable.Load(); t != nil {
+		return t.Intern(v)
+	}
+	return v
+}
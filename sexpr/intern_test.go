@@ -0,0 +1,107 @@
+package sexpr
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+func sameString(a, b string) bool {
+	return a == b && unsafe.StringData(a) == unsafe.StringData(b)
+}
+
+func TestIntern(t *testing.T) {
+	tab := NewInternTable(0)
+	input := "(define define)"
+	a := tab.Intern(input[1:7])
+	if a != "define" || unsafe.StringData(a) == unsafe.StringData(input[1:]) {
+		t.Errorf("Intern kept the input it was sliced from")
+	}
+	if b := tab.Intern(input[8:14]); !sameString(a, b) {
+		t.Errorf("the same text interned twice gave two copies")
+	}
+	tab.Intern("lambda")
+	st := tab.Stats()
+	if st != (InternStats{Entries: 2, Bytes: 12, Hits: 1, Misses: 2}) {
+		t.Errorf("Stats() = %+v", st)
+	}
+}
+
+func TestInternCap(t *testing.T) {
+	tab := NewInternTable(internShards)
+	first := tab.Intern("first")
+	for i := 0; i < 10*internShards; i++ {
+		tab.Intern(fmt.Sprint("s", i))
+	}
+	st := tab.Stats()
+	if st.Entries > internShards || st.Dropped == 0 || st.Entries+int(st.Dropped) != 10*internShards+1 {
+		t.Errorf("with room for %d, Stats() = %+v", internShards, st)
+	}
+	// what's in is still shared, what isn't comes back as it was
+	if again := tab.Intern(strings.Clone("first")); !sameString(again, first) {
+		t.Errorf("a string in a full table wasn't shared")
+	}
+	s := strings.Clone("not in the table")
+	if got := tab.Intern(s); !sameString(got, s) || tab.Stats().Entries != st.Entries {
+		t.Errorf("a full table copied or kept a new string")
+	}
+}
+
+// goroutines interning the same strings all get the same copies
+func TestInternConcurrent(t *testing.T) {
+	tab := NewInternTable(0)
+	const n = 100
+	got := make([][]string, 8)
+	var wg sync.WaitGroup
+	for g := range got {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				got[g] = append(got[g], tab.Intern(fmt.Sprint("sym", (i*7+g)%n)))
+			}
+		}(g)
+	}
+	wg.Wait()
+	canon := make(map[string]string)
+	for _, strs := range got {
+		for _, s := range strs {
+			if c, ok := canon[s]; ok && !sameString(c, s) {
+				t.Fatalf("two copies of %s", s)
+			}
+			canon[s] = s
+		}
+	}
+	if st := tab.Stats(); st.Entries != n || st.Misses != n || st.Hits != int64(len(got)*n-n) {
+		t.Errorf("Stats() = %+v", st)
+	}
+}
+
+// with a table set, parses share their atoms
+func TestSetInternTable(t *testing.T) {
+	tab := NewInternTable(0)
+	SetInternTable(tab)
+	t.Cleanup(func() { SetInternTable(nil) })
+	a, err := Parse(`(config (name "x") 1.50)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Parse(`(name (config) "x" 1.5)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ak, bk := a.Children(), b.Children()
+	if !sameString(ak[0].Value(), bk[1].Children()[0].Value()) ||
+		!sameString(ak[1].Children()[0].Value(), bk[0].Value()) ||
+		!sameString(ak[1].Children()[1].Value(), bk[2].Value()) {
+		t.Errorf("atoms of %s and %s weren't shared", a.Text(), b.Text())
+	}
+
+	SetInternTable(nil)
+	c, _ := Parse(`(config)`)
+	if sameString(c.Children()[0].Value(), ak[0].Value()) {
+		t.Errorf("atoms were interned with the table unset")
+	}
+}
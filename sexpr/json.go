@@ -0,0 +1,65 @@
+package sexpr
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// MarshalJSON encodes a single s-expression element (not the elements
+// following it) as JSON: lists become arrays and atoms become strings
+// holding their text exactly as it appeared in the input.  a dotted
+// list's array ends with "." and its tail.
+func (s *Sexpr) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := s.appendJSON(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *Sexpr) appendJSON(buf *bytes.Buffer) error {
+	if s.sty == sexprAtom {
+		b, err := json.Marshal(s.val)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		return nil
+	}
+	buf.WriteByte('[')
+	for cur := s.list; cur != nil; cur = cur.next {
+		if err := cur.appendJSON(buf); err != nil {
+			return err
+		}
+		if cur.next != nil {
+			buf.WriteByte(',')
+		}
+	}
+	if s.tail != nil {
+		buf.WriteString(`,"."`)
+		buf.WriteByte(',')
+		if err := s.tail.appendJSON(buf); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+// FormsJSON encodes s and every element following it as a JSON array,
+// one entry per element.  for the first of the forms ParseAll returns
+// this is one entry per top-level form.
+func FormsJSON(s *Sexpr) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for cur := s; cur != nil; cur = cur.next {
+		if err := cur.appendJSON(&buf); err != nil {
+			return nil, err
+		}
+		if cur.next != nil {
+			buf.WriteByte(',')
+		}
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
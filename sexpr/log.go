@@ -0,0 +1,47 @@
+package sexpr
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// LevelTrace is below slog.LevelDebug and is used for the per-token
+// lexer trace, which is far too chatty for ordinary debugging.
+const LevelTrace = slog.LevelDebug - 4
+
+// the logger used by the lexer and parser.  it discards everything
+// until SetLogger is called.
+var logger atomic.Pointer[slog.Logger]
+
+func init() {
+	logger.Store(slog.New(discardHandler{}))
+}
+
+// SetLogger installs the logger the package reports lexer and parser
+// activity to.  lexer tokens are logged at LevelTrace, parser decisions
+// and parse errors at slog.LevelDebug.  passing nil turns logging off.
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = slog.New(discardHandler{})
+	}
+	logger.Store(l)
+}
+
+// log at the given level, skipping all the argument work when nobody is
+// listening.  ctx is handed through to the handler.
+func logAt(ctx context.Context, level slog.Level, msg string, args ...any) {
+	l := logger.Load()
+	if !l.Enabled(ctx, level) {
+		return
+	}
+	l.Log(ctx, level, msg, args...)
+}
+
+// handler that is never enabled
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (d discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return d }
+func (d discardHandler) WithGroup(string) slog.Handler           { return d }
@@ -0,0 +1,707 @@
+package sexpr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mjsottile/gocode/diag"
+)
+
+/*
+   struct marshaling
+
+   Marshal and Unmarshal use the document layout described in the schema
+   package, so a schema made with schema.FromType describes what Marshal
+   writes, and the structs schema.GoSource generates can be filled in by
+   Unmarshal.  a struct is a sequence of (name value) entries, one per
+   field.  for a field holding a struct the entries of that struct follow
+   the name in place of a single value, for a slice or array its
+   elements do, and for a map its (key value) entries:
+
+	(host "example.org")
+	(port 8443)
+	(tls #t)
+	(routes ((path "/") (weight 2.5)) ((path "/api")))
+	(limits (burst 10) (rate 2.5))
+
+   an element of a list that is itself a struct or map is written as a
+   list of its entries, and a slice or array element as a list of its
+   elements.  a []byte is the exception: it is a single byte string
+   atom, |YWJj|, wherever it appears.
+*/
+
+// ErrUnmarshal is wrapped by the errors Unmarshal returns when the data
+// doesn't fit the Go value.  they are *diag.SourceErrors pointing at the
+// element that doesn't fit.
+var ErrUnmarshal = errors.New("sexpr: cannot unmarshal")
+
+var (
+	sexprPtrType = reflect.TypeOf((*Sexpr)(nil))
+	bigIntType   = reflect.TypeOf(big.Int{})
+	bigRatType   = reflect.TypeOf(big.Rat{})
+)
+
+// FieldName turns a Go name like ListenAddr into the name used for it in
+// documents, listen-addr.  runs of capitals are kept together, so APIURL
+// becomes apiurl and HTTPServer http-server.  Marshal and Unmarshal use
+// it for struct fields without a name in their tag.
+func FieldName(goName string) string {
+	r := []rune(goName)
+	var b strings.Builder
+	for i, c := range r {
+		if unicode.IsUpper(c) && i > 0 {
+			prevLower := unicode.IsLower(r[i-1]) || unicode.IsDigit(r[i-1])
+			nextLower := i+1 < len(r) && unicode.IsLower(r[i+1])
+			if prevLower || unicode.IsUpper(r[i-1]) && nextLower {
+				b.WriteByte('-')
+			}
+		}
+		if c == '_' {
+			b.WriteByte('-')
+			continue
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
+
+// a struct field as Marshal and Unmarshal see it
+type field struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// the fields of struct type t, in order.  names come from `sexpr:"name"`
+// tags, or FieldName of the Go name; fields tagged "-" and unexported
+// ones are left out.
+func fields(t reflect.Type) []field {
+	var fs []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("sexpr")
+		if !sf.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = FieldName(sf.Name)
+		}
+		f := field{name: name, index: i}
+		for _, o := range strings.Split(opts, ",") {
+			f.omitEmpty = f.omitEmpty || o == "omitempty"
+		}
+		fs = append(fs, f)
+	}
+	return fs
+}
+
+// Marshal returns v in s-expression syntax.  a struct, or a map with
+// string keys, is written as its entries, one top-level form each, in
+// the layout above; anything else is written as a single element.
+// fields tagged omitempty are left out when they hold a zero value, as
+// are nil pointers and interfaces, which have nothing to write.
+//
+// strings become string atoms, numbers integer or float atoms (floats
+// always with a fraction or exponent), booleans #t and #f, *big.Int and
+// *big.Rat values integers and rationals, and *Sexpr values are written
+// as they are.  a nil pointer that is an element of a list is written as
+// nil.  channels, functions, complex numbers and non-finite floats can't
+// be written and give an error.
+func Marshal(v any) ([]byte, error) {
+	forms, err := marshalForms(v)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	for i, f := range forms {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(Format(f, FormatOptions{}))
+	}
+	return []byte(b.String()), nil
+}
+
+// the top-level forms Marshal writes for v
+func marshalForms(v any) ([]*Sexpr, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return []*Sexpr{NewAtom("nil")}, nil
+		}
+		if rv.Type() == sexprPtrType {
+			break
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return []*Sexpr{NewAtom("nil")}, nil
+	}
+	if hasEntries(rv.Type()) {
+		return encodeEntries(rv)
+	}
+	e, err := encodeElem(rv)
+	if err != nil {
+		return nil, err
+	}
+	return []*Sexpr{e}, nil
+}
+
+// v as a single element, the way it would be written in a list
+func marshalElem(v any) (*Sexpr, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return NewAtom("nil"), nil
+	}
+	return encodeElem(rv)
+}
+
+// true for the types written as a sequence of entries
+func hasEntries(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct:
+		return t != bigIntType && t != bigRatType
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String
+	}
+	return false
+}
+
+// the entries of a struct or map
+func encodeEntries(v reflect.Value) ([]*Sexpr, error) {
+	var out []*Sexpr
+	if v.Kind() == reflect.Map {
+		keys := v.MapKeys()
+		// sorted, so the output is the same every time
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			e, err := encodeEntry(keyAtom(k.String()), v.MapIndex(k))
+			if err != nil {
+				return nil, err
+			}
+			if e != nil {
+				out = append(out, e)
+			}
+		}
+		return out, nil
+	}
+	for _, f := range fields(v.Type()) {
+		fv := v.Field(f.index)
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		e, err := encodeEntry(NewAtom(f.name), fv)
+		if err != nil {
+			return nil, fmt.Errorf("sexpr: field %s of %s: %w", f.name, v.Type(), err)
+		}
+		if e != nil {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// a map key as an atom: a symbol if it reads back as one, else a string
+func keyAtom(k string) *Sexpr {
+	if k != "" && k != "." && classifyAtom(k) == Symbol &&
+		!strings.ContainsAny(k, " \t\r\n()\";\\") && !strings.ContainsRune("#'`,", rune(k[0])) {
+		return NewAtom(k)
+	}
+	return NewString(k)
+}
+
+// the entry (name ...) for v, or nil if v is a nil pointer or interface
+// and so is left out
+func encodeEntry(name *Sexpr, v reflect.Value) (*Sexpr, error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type() == sexprPtrType {
+			break
+		}
+		v = v.Elem()
+	}
+	var args []*Sexpr
+	var err error
+	switch {
+	case hasEntries(v.Type()):
+		args, err = encodeEntries(v)
+	case isByteSlice(v.Type()):
+		args = []*Sexpr{NewBytes(v.Bytes())}
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		args, err = encodeElems(v)
+	default:
+		var e *Sexpr
+		e, err = encodeElem(v)
+		args = []*Sexpr{e}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewList(append([]*Sexpr{name}, args...)...), nil
+}
+
+// the elements of a slice or array
+func encodeElems(v reflect.Value) ([]*Sexpr, error) {
+	out := make([]*Sexpr, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		e, err := encodeElem(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// v as a single element
+func encodeElem(v reflect.Value) (*Sexpr, error) {
+	if v.Type() == sexprPtrType {
+		if v.IsNil() {
+			return NewAtom("nil"), nil
+		}
+		return deepCopy(detach(v.Interface().(*Sexpr))), nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return NewAtom("nil"), nil
+		}
+		return encodeElem(v.Elem())
+	case reflect.String:
+		return NewString(v.String()), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return NewAtom("#t"), nil
+		}
+		return NewAtom("#f"), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewAtom(strconv.FormatInt(v.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return NewAtom(strconv.FormatUint(v.Uint(), 10)), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, fmt.Errorf("sexpr: cannot marshal %v", f)
+		}
+		text := strconv.FormatFloat(f, 'g', -1, v.Type().Bits())
+		if !strings.ContainsAny(text, ".e") {
+			text += ".0"
+		}
+		return NewAtom(text), nil
+	case reflect.Slice, reflect.Array:
+		if isByteSlice(v.Type()) {
+			return NewBytes(v.Bytes()), nil
+		}
+		elems, err := encodeElems(v)
+		if err != nil {
+			return nil, err
+		}
+		return NewList(elems...), nil
+	case reflect.Struct:
+		switch v.Type() {
+		case bigIntType:
+			n := v.Interface().(big.Int)
+			return NewAtom(n.String()), nil
+		case bigRatType:
+			r := v.Interface().(big.Rat)
+			if r.IsInt() {
+				return NewAtom(r.Num().String()), nil
+			}
+			return NewAtom(r.String()), nil
+		}
+		fallthrough
+	case reflect.Map:
+		if !hasEntries(v.Type()) {
+			break
+		}
+		entries, err := encodeEntries(v)
+		if err != nil {
+			return nil, err
+		}
+		return NewList(entries...), nil
+	}
+	return nil, fmt.Errorf("sexpr: cannot marshal %s", v.Type())
+}
+
+// true for []byte and other slices of bytes, which are byte strings
+// rather than lists
+func isByteSlice(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
+
+// Unmarshal parses data and stores the result in the value v points to.
+// a struct or a map with string keys is filled in from a sequence of
+// entries in the layout Marshal writes: either the top-level forms of
+// data, or the elements of its only form if that is a list of lists.
+// entries for names the struct has no field for are ignored, and an
+// entry given twice sets its field twice, the last one winning.  other
+// values are read from data's only form.
+//
+// strings take the contents of string atoms and the text of any other
+// atom; booleans take #t, #f, nil and (), and the words true, false,
+// yes, no, on and off; numbers take integer and float atoms that fit,
+// and *big.Int and *big.Rat values number atoms of any size.  a []byte
+// takes a byte string, the contents of a string, or a list of numbers.
+// a nil atom leaves a pointer, slice, map or interface nil.  an
+// interface{} gets the natural Go value of what it is given: int64 (or
+// *big.Int if it doesn't fit), float64, *big.Rat, string, bool, rune,
+// []byte, nil, or for a list a []any.  *Sexpr values get the element itself.
+//
+// syntax errors are those of ParseAll; data that doesn't fit v gives a
+// *diag.SourceError wrapping ErrUnmarshal.
+func Unmarshal(data []byte, v any) error {
+	forms, err := parseForms(context.Background(), string(data))
+	if err != nil {
+		return err
+	}
+	return unmarshalForms(forms, string(data), v)
+}
+
+// fill in v from forms, parsed from input
+func unmarshalForms(forms *Sexpr, input string, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("sexpr: Unmarshal needs a non-nil pointer, not %T", v)
+	}
+	d := &decoder{input: input}
+	t := rv.Elem().Type()
+	for t.Kind() == reflect.Pointer && t != sexprPtrType {
+		t = t.Elem()
+	}
+	if hasEntries(t) {
+		target := rv.Elem()
+		for target.Kind() == reflect.Pointer {
+			if target.IsNil() {
+				target.Set(reflect.New(target.Type().Elem()))
+			}
+			target = target.Elem()
+		}
+		entries := chainSlice(forms)
+		if len(entries) == 1 && entries[0].IsList() && entries[0].tail == nil {
+			kids := entries[0].Children()
+			lists := true
+			for _, k := range kids {
+				lists = lists && k.IsList()
+			}
+			if lists {
+				entries = kids
+			}
+		}
+		return d.entries(target, entries)
+	}
+	if forms == nil {
+		return d.errorf(nil, "nothing to unmarshal into %s", t)
+	}
+	if forms.next != nil {
+		return d.errorf(forms.next, "more than one form to unmarshal into %s", t)
+	}
+	// pointers are left to elem, so that nil can leave them nil
+	return d.elem(rv.Elem(), forms)
+}
+
+type decoder struct {
+	input string
+}
+
+// an ErrUnmarshal at the element at (or the end of the input if at is
+// nil)
+func (d *decoder) errorf(at *Sexpr, format string, args ...any) error {
+	pos := diag.PositionFor("", d.input, len(d.input))
+	if at != nil {
+		pos = at.Position()
+	}
+	return diag.Errorf(pos, ErrUnmarshal, format, args...)
+}
+
+// fill in the struct or map v from a sequence of entries
+func (d *decoder) entries(v reflect.Value, entries []*Sexpr) error {
+	var byName map[string]field
+	if v.Kind() == reflect.Struct {
+		byName = make(map[string]field)
+		for _, f := range fields(v.Type()) {
+			byName[f.name] = f
+		}
+	} else if v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+	for _, e := range entries {
+		kids := e.Children()
+		if len(kids) == 0 || !kids[0].IsAtom() || e.tail != nil {
+			return d.errorf(e, "expected a (name value) entry for %s", v.Type())
+		}
+		name := kids[0].val
+		if s, err := kids[0].Str(); err == nil {
+			name = s
+		}
+		if v.Kind() == reflect.Map {
+			ev := reflect.New(v.Type().Elem()).Elem()
+			if err := d.value(ev, e, kids[1:]); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(name).Convert(v.Type().Key()), ev)
+			continue
+		}
+		f, ok := byName[name]
+		if !ok {
+			continue
+		}
+		fv := v.Field(f.index)
+		// an entry given again replaces the one before
+		fv.SetZero()
+		if err := d.value(fv, e, kids[1:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fill in v from the elements after the name of the entry e
+func (d *decoder) value(v reflect.Value, e *Sexpr, args []*Sexpr) error {
+	if v.Type() != sexprPtrType {
+		switch {
+		case v.Kind() == reflect.Pointer:
+			if len(args) == 1 && args[0].IsAtom() && args[0].aty == Nil {
+				return nil
+			}
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			return d.value(v.Elem(), e, args)
+		case hasEntries(v.Type()):
+			return d.entries(v, args)
+		case isByteSlice(v.Type()) && len(args) == 1 && args[0].IsAtom():
+			return d.elem(v, args[0])
+		case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+			return d.elems(v, e, args)
+		case v.Kind() == reflect.Interface && v.NumMethod() == 0 && len(args) != 1:
+			return d.elem(v, &Sexpr{aty: NotAtom, sty: sexprList, list: NewForms(detachAll(args)...),
+				pos: e.pos, end: e.end, line: e.line, col: e.col})
+		}
+	}
+	if len(args) != 1 {
+		return d.errorf(e, "expected one value for %s", e.Children()[0].val)
+	}
+	return d.elem(v, args[0])
+}
+
+// shallow copies of elems, unlinked
+func detachAll(elems []*Sexpr) []*Sexpr {
+	out := make([]*Sexpr, len(elems))
+	for i, el := range elems {
+		out[i] = detach(el)
+	}
+	return out
+}
+
+// fill in the slice or array v from elems
+func (d *decoder) elems(v reflect.Value, at *Sexpr, elems []*Sexpr) error {
+	if v.Kind() == reflect.Array {
+		if len(elems) > v.Len() {
+			return d.errorf(at, "%d elements for %s", len(elems), v.Type())
+		}
+		for i, el := range elems {
+			if err := d.elem(v.Index(i), el); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	s := reflect.MakeSlice(v.Type(), len(elems), len(elems))
+	for i, el := range elems {
+		if err := d.elem(s.Index(i), el); err != nil {
+			return err
+		}
+	}
+	v.Set(s)
+	return nil
+}
+
+// fill in v from the single element el
+func (d *decoder) elem(v reflect.Value, el *Sexpr) error {
+	t := v.Type()
+	if t == sexprPtrType {
+		v.Set(reflect.ValueOf(deepCopy(detach(el))))
+		return nil
+	}
+	isNil := el.IsAtom() && el.aty == Nil
+	switch t.Kind() {
+	case reflect.Pointer:
+		if isNil {
+			v.SetZero()
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return d.elem(v.Elem(), el)
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			break
+		}
+		x, err := d.natural(el)
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			v.SetZero()
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	case reflect.Slice, reflect.Map:
+		if isNil {
+			v.SetZero()
+			return nil
+		}
+	}
+	switch {
+	case t == bigIntType:
+		n, err := el.BigInt()
+		if err != nil {
+			return d.errorf(el, "cannot unmarshal %s into %s", el.AtomKind(), t)
+		}
+		v.Set(reflect.ValueOf(*n))
+		return nil
+	case t == bigRatType:
+		r, err := el.Rat()
+		if err != nil || r == nil {
+			return d.errorf(el, "cannot unmarshal %s %s into %s", el.AtomKind(), el.val, t)
+		}
+		v.Set(reflect.ValueOf(*r))
+		return nil
+	case hasEntries(t):
+		if !el.IsList() || el.tail != nil {
+			return d.errorf(el, "cannot unmarshal %s into %s", el.AtomKind(), t)
+		}
+		return d.entries(v, el.Children())
+	case isByteSlice(t) && el.IsAtom():
+		b, err := el.Bytes()
+		if err != nil {
+			return d.errorf(el, "cannot unmarshal %s %s into %s", el.aty, el.val, t)
+		}
+		v.SetBytes(b)
+		return nil
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		if !el.IsList() || el.tail != nil {
+			return d.errorf(el, "cannot unmarshal %s into %s", el.AtomKind(), t)
+		}
+		return d.elems(v, el, el.Children())
+	}
+	if !el.IsAtom() {
+		return d.errorf(el, "cannot unmarshal list into %s", t)
+	}
+	return d.scalar(v, el)
+}
+
+// fill in the string, boolean or number v from the atom el
+func (d *decoder) scalar(v reflect.Value, el *Sexpr) error {
+	t := v.Type()
+	bad := func() error {
+		return d.errorf(el, "cannot unmarshal %s %s into %s", el.aty, el.val, t)
+	}
+	switch t.Kind() {
+	case reflect.String:
+		s, err := el.Str()
+		if err != nil {
+			s = el.val
+		}
+		v.SetString(s)
+		return nil
+	case reflect.Bool:
+		b, err := el.Bool()
+		if err != nil {
+			switch el.val {
+			case "true", "yes", "on":
+				b = true
+			case "false", "no", "off":
+			default:
+				return bad()
+			}
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := el.Int()
+		if err != nil || v.OverflowInt(n) {
+			return bad()
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if el.aty != Integer {
+			return bad()
+		}
+		n, err := strconv.ParseUint(strings.TrimPrefix(el.val, "+"), 10, 64)
+		if err != nil || v.OverflowUint(n) {
+			return bad()
+		}
+		v.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := el.Float64()
+		if err != nil || v.OverflowFloat(f) {
+			return bad()
+		}
+		v.SetFloat(f)
+		return nil
+	}
+	return d.errorf(el, "cannot unmarshal into %s", t)
+}
+
+// the Go value an interface{} gets for el
+func (d *decoder) natural(el *Sexpr) (any, error) {
+	if el.IsList() {
+		if el.tail != nil {
+			return nil, d.errorf(el, "cannot unmarshal dotted list into interface{}")
+		}
+		out := []any{}
+		for _, k := range el.Children() {
+			x, err := d.natural(k)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, x)
+		}
+		return out, nil
+	}
+	var x any
+	var err error
+	switch el.aty {
+	case Integer:
+		if n, err := el.Int(); err == nil {
+			return n, nil
+		}
+		x, err = el.BigInt()
+	case Float:
+		x, err = el.Float64()
+	case Rational:
+		x, err = el.Rat()
+	case String:
+		x, err = el.Str()
+	case Boolean:
+		x, err = el.Bool()
+	case Nil:
+		return nil, nil
+	case Char:
+		x, err = el.Rune()
+	case Bytes:
+		x, err = el.Bytes()
+	default:
+		return el.val, nil
+	}
+	if err != nil {
+		return nil, d.errorf(el, "cannot unmarshal %s %s into interface{}: %v", el.aty, el.val, err)
+	}
+	return x, nil
+}
@@ -0,0 +1,168 @@
+package sexpr
+
+import (
+	"errors"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/mjsottile/gocode/diag"
+)
+
+type route struct {
+	Path    string
+	Weight  float64
+	Methods []string
+}
+
+type config struct {
+	Host     string
+	Port     uint16
+	TLS      bool
+	Retries  int8
+	Timeout  int64
+	Ratio    float32
+	Initial  rune
+	Key      []byte
+	Tags     []string
+	Matrix   [][]int
+	Pair     [2]string
+	Limits   map[string]int
+	Routes   []route
+	Default  route
+	Fallback *route
+	Note     *string
+	Internal int    `sexpr:"-"`
+	Renamed  string `sexpr:"other-name"`
+	Optional string `sexpr:",omitempty"`
+}
+
+// Unmarshal gives back what Marshal was given.  nil and empty slices
+// and maps look the same written out, so the property compares them as
+// equal.
+func TestMarshalRoundTrip(t *testing.T) {
+	cfg := &quick.Config{MaxCount: 1000, Rand: rand.New(rand.NewSource(9))}
+	prop := func(c config) bool {
+		c.Internal = 0
+		data, err := Marshal(c)
+		if err != nil {
+			t.Logf("Marshal(%+v): %v", c, err)
+			return false
+		}
+		var got config
+		if err := Unmarshal(data, &got); err != nil {
+			t.Logf("Unmarshal(%s): %v", data, err)
+			return false
+		}
+		if !reflect.DeepEqual(normalize(got), normalize(c)) {
+			t.Logf("%s\nunmarshals to %+v, want %+v", data, got, c)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(prop, cfg); err != nil {
+		t.Error(err)
+	}
+}
+
+// v with empty slices and maps made nil, recursively
+func normalize(v any) any {
+	rv := reflect.ValueOf(&v).Elem().Elem()
+	if !rv.IsValid() {
+		return v
+	}
+	out := reflect.New(rv.Type()).Elem()
+	out.Set(rv)
+	normalizeValue(out)
+	return out.Interface()
+}
+
+func normalizeValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		if v.Len() == 0 {
+			v.SetZero()
+			return
+		}
+		if v.Kind() == reflect.Slice {
+			for i := 0; i < v.Len(); i++ {
+				normalizeValue(v.Index(i))
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			normalizeValue(v.Index(i))
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			normalizeValue(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				normalizeValue(v.Field(i))
+			}
+		}
+	}
+}
+
+func TestMarshalLayout(t *testing.T) {
+	type limits struct {
+		Burst int
+		Rate  float64
+	}
+	v := struct {
+		Host   string
+		Port   int
+		TLS    bool
+		Routes []route
+		Limits limits
+	}{"example.org", 8443, true, []route{{Path: "/", Weight: 2.5}}, limits{10, 2.5}}
+	data, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `(host "example.org")
+(port 8443)
+(tls #t)
+(routes ((path "/") (weight 2.5) (methods)))
+(limits (burst 10) (rate 2.5))`
+	if string(data) != want {
+		t.Errorf("Marshal gave\n%s\nwant\n%s", data, want)
+	}
+}
+
+// numbers that read fine but don't fit the Go value are errors pointing
+// at them, never panics or bare strconv errors
+func TestUnmarshalOutOfRange(t *testing.T) {
+	var rat big.Rat
+	var x any
+	var s struct {
+		R *big.Rat
+		V big.Rat
+		X any
+		F float64
+	}
+	tests := []struct {
+		data string
+		v    any
+	}{
+		{"1e10000000", &rat},
+		{"1e10000000", &x},
+		{"1e400", &x},
+		{"(r 1e99999999)", &s},
+		{"(v -1e10000000)", &s},
+		{"(x 1e400)", &s},
+		{"(x (1 2 -1e400))", &s},
+		{"(f 1e400)", &s},
+	}
+	for _, tt := range tests {
+		err := Unmarshal([]byte(tt.data), tt.v)
+		var se *diag.SourceError
+		if !errors.Is(err, ErrUnmarshal) || !errors.As(err, &se) {
+			t.Errorf("Unmarshal(%s) = %v, want a *diag.SourceError wrapping ErrUnmarshal", tt.data, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package sexpr
+
+import (
+	"expvar"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives counts and timings from the parser.  implementations
+// must be safe for concurrent use, since parses may run in parallel.
+type Metrics interface {
+	// one call per Parse (or ParseContext), successful or not, with the
+	// number of lexer tokens consumed, the number of top-level forms
+	// produced and how long it took
+	Parsed(tokens, forms int, elapsed time.Duration)
+
+	// one call per Parse that returned an error
+	ParseError(err error)
+}
+
+var metrics atomic.Pointer[Metrics]
+
+// SetMetrics installs m to receive parser metrics.  passing nil turns
+// metrics off, which is the default.
+func SetMetrics(m Metrics) {
+	if m == nil {
+		metrics.Store(nil)
+		return
+	}
+	metrics.Store(&m)
+}
+
+// report a finished parse to the installed Metrics, if any
+func recordParse(tokens int, s *Sexpr, err error, start time.Time) {
+	mp := metrics.Load()
+	if mp == nil {
+		return
+	}
+	m := *mp
+	forms := 0
+	for cur := s; cur != nil; cur = cur.next {
+		forms++
+	}
+	m.Parsed(tokens, forms, time.Since(start))
+	if err != nil {
+		m.ParseError(err)
+	}
+}
+
+// ExpvarMetrics is a Metrics that publishes running totals through the
+// expvar package, so they show up under /debug/vars for programs serving
+// expvar's handler.  the published map holds
+//
+//	parses        number of parses
+//	parse_errors  number of parses that failed
+//	tokens_lexed  lexer tokens consumed
+//	forms_parsed  top-level forms produced
+//	parse_ns      total time spent parsing, in nanoseconds
+type ExpvarMetrics struct {
+	vars *expvar.Map
+}
+
+// NewExpvarMetrics publishes a new map under name.  like expvar.Publish,
+// it panics if name is already in use.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	return &ExpvarMetrics{vars: expvar.NewMap(name)}
+}
+
+func (e *ExpvarMetrics) Parsed(tokens, forms int, elapsed time.Duration) {
+	e.vars.Add("parses", 1)
+	e.vars.Add("tokens_lexed", int64(tokens))
+	e.vars.Add("forms_parsed", int64(forms))
+	e.vars.Add("parse_ns", int64(elapsed))
+}
+
+func (e *ExpvarMetrics) ParseError(err error) {
+	e.vars.Add("parse_errors", 1)
+}
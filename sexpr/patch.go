@@ -0,0 +1,375 @@
+package sexpr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrConflict is wrapped by the *PatchError returned when a change
+// doesn't fit the document it is applied to.
+var ErrConflict = errors.New("patch conflict")
+
+// PatchError reports the change that stopped Patch.
+type PatchError struct {
+	Index  int // position of the change in the script
+	Change Change
+	Reason string
+}
+
+func (e *PatchError) Error() string {
+	return fmt.Sprintf("sexpr: change %d (%s at %s): %s", e.Index,
+		e.Change.Kind, PathString(e.Change.Path), e.Reason)
+}
+
+func (e *PatchError) Unwrap() error { return ErrConflict }
+
+// Patch applies an edit script, as produced by Diff, to the forms
+// starting at s and returns the result.  s itself is left alone.  each
+// change is checked before it is made: the element it deletes or
+// replaces must be Equal to its Old, and an insert must land inside an
+// existing list (or at most one past its end), so a script applied to a
+// document other than the one it was made from fails with a *PatchError
+// instead of quietly doing something else.
+//
+// positions in the result are those of wherever each node came from and
+// don't describe any one source.
+func Patch(s *Sexpr, cs []Change) (*Sexpr, error) {
+	root := &Sexpr{aty: NotAtom, sty: sexprList, list: deepCopy(s)}
+	for i, c := range cs {
+		if err := root.apply(c); err != "" {
+			return nil, &PatchError{Index: i, Change: c, Reason: err}
+		}
+	}
+	return root.list, nil
+}
+
+// apply makes one change to the contents of the list r, returning why
+// it couldn't if it couldn't
+func (r *Sexpr) apply(c Change) string {
+	if len(c.Path) == 0 {
+		return "empty path"
+	}
+	parent := r
+	for depth, idx := range c.Path[:len(c.Path)-1] {
+		el := nth(parent.list, idx)
+		if el == nil {
+			return fmt.Sprintf("no element at %s", PathString(c.Path[:depth+1]))
+		}
+		if el.sty != sexprList {
+			return fmt.Sprintf("element at %s is not a list", PathString(c.Path[:depth+1]))
+		}
+		// its contents are about to change
+		el.hash = nil
+		parent = el
+	}
+	idx := c.Path[len(c.Path)-1]
+	link := &parent.list
+	for k := 0; k < idx; k++ {
+		if *link == nil {
+			return "index past the end of the list"
+		}
+		link = &(*link).next
+	}
+	switch c.Kind {
+	case ChangeInsert:
+		if c.New == nil {
+			return "nothing to insert"
+		}
+		n := deepCopy(c.New)
+		n.next = *link
+		*link = n
+	case ChangeDelete, ChangeReplace:
+		if *link == nil {
+			return "no element to " + c.Kind.String()
+		}
+		if !Equal(*link, c.Old) {
+			return fmt.Sprintf("found %s, expected %s", elementText(*link), elementText(c.Old))
+		}
+		if c.Kind == ChangeDelete {
+			if parent.tail != nil && parent.list.next == nil {
+				return "can't delete the only element before a dot"
+			}
+			*link = (*link).next
+			break
+		}
+		if c.New == nil {
+			return "no replacement"
+		}
+		n := deepCopy(c.New)
+		n.next = (*link).next
+		*link = n
+	default:
+		return "unknown change kind"
+	}
+	return ""
+}
+
+// the canonical text of the element s alone
+func elementText(s *Sexpr) string {
+	if s == nil {
+		return "nothing"
+	}
+	var buf bytes.Buffer
+	s.writeCanonical(&buf)
+	return buf.String()
+}
+
+// the i'th element of a chain, or nil
+func nth(s *Sexpr, i int) *Sexpr {
+	for ; s != nil && i > 0; i-- {
+		s = s.next
+	}
+	return s
+}
+
+// a copy of s, the elements following it and everything below them
+func deepCopy(s *Sexpr) *Sexpr {
+	var head *Sexpr
+	link := &head
+	for cur := s; cur != nil; cur = cur.next {
+		n := *cur
+		n.list = deepCopy(cur.list)
+		n.tail = deepCopy(cur.tail)
+		n.next = nil
+		*link = &n
+		link = &n.next
+	}
+	return head
+}
+
+// Conflict is a pair of changes, one from each side of a Merge, that
+// can't both be made.
+type Conflict struct {
+	Ours, Theirs Change
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("ours %s, theirs %s", c.Ours, c.Theirs)
+}
+
+// Merge does a three-way merge: it combines the changes turning base
+// into ours with those turning base into theirs and returns a single
+// edit script to Patch base with.  changes made identically on both
+// sides are kept once.  two changes conflict when they delete or
+// replace the same element in different ways, when one deletes or
+// replaces an element the other changes something inside of, or when
+// both insert different things at the same place.  so do deletes on
+// the two sides that together would leave nothing before the dot of a
+// dotted list.  conflicting changes are left out of the script and
+// returned instead.
+func Merge(base, ours, theirs *Sexpr) ([]Change, []Conflict) {
+	a, b := Diff(base, ours), Diff(base, theirs)
+	dropA, dropB := make([]bool, len(a)), make([]bool, len(b))
+	var conflicts []Conflict
+
+	// runs of inserts at the same place are compared as a whole
+	insA, insB := insertRuns(a), insertRuns(b)
+	for key, ra := range insA {
+		rb, ok := insB[key]
+		if !ok {
+			continue
+		}
+		same := len(ra) == len(rb)
+		for k := 0; same && k < len(ra); k++ {
+			same = Equal(a[ra[k]].New, b[rb[k]].New)
+		}
+		if !same {
+			conflicts = append(conflicts, Conflict{a[ra[0]], b[rb[0]]})
+			for _, i := range ra {
+				dropA[i] = true
+			}
+		}
+		for _, j := range rb {
+			dropB[j] = true
+		}
+	}
+
+	for i, ca := range a {
+		if ca.Kind == ChangeInsert {
+			continue
+		}
+		for j, cb := range b {
+			if cb.Kind == ChangeInsert {
+				if hasPrefix(cb.Path, ca.Path) && len(cb.Path) > len(ca.Path) {
+					conflicts = append(conflicts, Conflict{ca, cb})
+					dropA[i], dropB[j] = true, true
+				}
+				continue
+			}
+			switch {
+			case equalPath(ca.Path, cb.Path):
+				if ca.Kind == cb.Kind && Equal(ca.New, cb.New) {
+					dropB[j] = true
+				} else {
+					conflicts = append(conflicts, Conflict{ca, cb})
+					dropA[i], dropB[j] = true, true
+				}
+			case hasPrefix(ca.Path, cb.Path) || hasPrefix(cb.Path, ca.Path):
+				conflicts = append(conflicts, Conflict{ca, cb})
+				dropA[i], dropB[j] = true, true
+			}
+		}
+	}
+	// an insert on our side inside something they delete or replace
+	for i, ca := range a {
+		if ca.Kind != ChangeInsert {
+			continue
+		}
+		for j, cb := range b {
+			if cb.Kind != ChangeInsert && hasPrefix(ca.Path, cb.Path) && len(ca.Path) > len(cb.Path) {
+				conflicts = append(conflicts, Conflict{ca, cb})
+				dropA[i], dropB[j] = true, true
+			}
+		}
+	}
+
+	var merged []sided
+	for i, c := range a {
+		if !dropA[i] {
+			merged = append(merged, sided{c, true})
+		}
+	}
+	for j, c := range b {
+		if !dropB[j] {
+			merged = append(merged, sided{c, false})
+		}
+	}
+	// every path refers to base, so order the changes the way Diff
+	// does: later positions first, the inside of an element before the
+	// element itself, and at the same place deletes and replaces before
+	// inserts.  the sort is stable so runs of inserts keep their order.
+	sort.SliceStable(merged, func(i, j int) bool {
+		p, q := merged[i].Path, merged[j].Path
+		for k := 0; k < len(p) && k < len(q); k++ {
+			if p[k] != q[k] {
+				return p[k] > q[k]
+			}
+		}
+		if len(p) != len(q) {
+			return len(p) > len(q)
+		}
+		return merged[i].Kind != ChangeInsert && merged[j].Kind == ChangeInsert
+	})
+	// each side leaves something before the dot of a dotted list, but
+	// their deletes together may not
+	for {
+		i, j := emptiedDot(base, merged)
+		if i < 0 {
+			break
+		}
+		if merged[i].ours {
+			conflicts = append(conflicts, Conflict{merged[i].Change, merged[j].Change})
+		} else {
+			conflicts = append(conflicts, Conflict{merged[j].Change, merged[i].Change})
+		}
+		i, j = min(i, j), max(i, j)
+		merged = append(merged[:i], append(merged[i+1:j], merged[j+1:]...)...)
+	}
+	out := make([]Change, len(merged))
+	for i, m := range merged {
+		out[i] = m.Change
+	}
+	return out, conflicts
+}
+
+// a change in a Merge, and which side it came from
+type sided struct {
+	Change
+	ours bool
+}
+
+// the first delete in merged that would leave nothing before the dot of
+// a dotted list in base, applying the changes in order, and a delete
+// from the other side in the same list that came before it; or -1, -1
+// if there is no such pair
+func emptiedDot(base *Sexpr, merged []sided) (int, int) {
+	counts := make(map[string]int)
+	var visit func(el *Sexpr, path []int)
+	visit = func(el *Sexpr, path []int) {
+		if el.sty != sexprList {
+			return
+		}
+		kids := chainSlice(el.list)
+		if el.tail != nil {
+			counts[PathString(path)] = len(kids)
+		}
+		for i, k := range kids {
+			visit(k, append(path, i))
+		}
+	}
+	for i, f := range chainSlice(base) {
+		visit(f, []int{i})
+	}
+	if len(counts) == 0 {
+		return -1, -1
+	}
+	// the last delete each side made in each list
+	type last struct{ ours, theirs int }
+	deletes := make(map[string]*last)
+	for k, m := range merged {
+		if m.Kind == ChangeReplace || len(m.Path) < 2 {
+			continue
+		}
+		list := PathString(m.Path[:len(m.Path)-1])
+		n, ok := counts[list]
+		if !ok {
+			continue
+		}
+		if m.Kind == ChangeInsert {
+			counts[list] = n + 1
+			continue
+		}
+		d := deletes[list]
+		if d == nil {
+			d = &last{-1, -1}
+			deletes[list] = d
+		}
+		if m.ours {
+			d.ours = k
+		} else {
+			d.theirs = k
+		}
+		if counts[list] = n - 1; n-1 > 0 {
+			continue
+		}
+		other := d.theirs
+		if !m.ours {
+			other = d.ours
+		}
+		if other >= 0 {
+			return k, other
+		}
+	}
+	return -1, -1
+}
+
+// the indices of the inserts in cs, grouped by path
+func insertRuns(cs []Change) map[string][]int {
+	runs := make(map[string][]int)
+	for i, c := range cs {
+		if c.Kind == ChangeInsert {
+			k := PathString(c.Path)
+			runs[k] = append(runs[k], i)
+		}
+	}
+	return runs
+}
+
+func equalPath(p, q []int) bool {
+	return len(p) == len(q) && hasPrefix(p, q)
+}
+
+// whether q is a prefix of p
+func hasPrefix(p, q []int) bool {
+	if len(q) > len(p) {
+		return false
+	}
+	for i := range q {
+		if p[i] != q[i] {
+			return false
+		}
+	}
+	return true
+}
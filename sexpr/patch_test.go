@@ -0,0 +1,62 @@
+package sexpr
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestMergeDottedConflict(t *testing.T) {
+	parse := func(src string) *Sexpr {
+		forms, err := ParseAll(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return forms[0]
+	}
+	base, ours, theirs := parse("(f x . t)"), parse("(x . t)"), parse("(f . t)")
+	cs, conflicts := Merge(base, ours, theirs)
+	if len(conflicts) != 1 {
+		t.Fatalf("Merge gave conflicts %v", conflicts)
+	}
+	if _, err := Patch(base, cs); err != nil {
+		t.Error(err)
+	}
+	// with something left before the dot the deletes merge cleanly
+	base, ours, theirs = parse("(f x y . t)"), parse("(x y . t)"), parse("(f y . t)")
+	cs, conflicts = Merge(base, ours, theirs)
+	if len(conflicts) != 0 {
+		t.Fatalf("Merge gave conflicts %v", conflicts)
+	}
+	got, err := Patch(base, cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := parse("(y . t)"); !EqualForms(got, want) {
+		t.Errorf("got %s, want %s", got.Text(), want.Text())
+	}
+}
+
+// a few steps of Shrink, which mostly deletes things
+func mutate(r *rand.Rand, s *Sexpr) *Sexpr {
+	for n := r.Intn(4); n > 0; n-- {
+		cands := Shrink(s)
+		if len(cands) == 0 {
+			break
+		}
+		s = cands[r.Intn(len(cands))]
+	}
+	return s
+}
+
+// the script Merge returns always applies to base
+func TestMergeApplies(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 3000; i++ {
+		base := Random(r, 1+r.Intn(30))
+		ours, theirs := mutate(r, base), mutate(r, base)
+		cs, _ := Merge(base, ours, theirs)
+		if _, err := Patch(base, cs); err != nil {
+			t.Fatalf("merging %s and %s into %s: %v", docText(ours), docText(theirs), docText(base), err)
+		}
+	}
+}
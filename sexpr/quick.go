@@ -0,0 +1,232 @@
+package sexpr
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+/*
+   property testing
+
+   *Sexpr implements testing/quick.Generator, so quick.Check can feed
+   random documents to properties taking *Sexpr arguments:
+
+     quick.Check(func(s *sexpr.Sexpr) bool {
+         return sexpr.EqualForms(s, roundTrip(s))
+     }, nil)
+
+   Shrink and Minimize cut a failing document down to something small
+   enough to read.  quick doesn't shrink on its own, so run Minimize on
+   the input it reports (or use Shrink from another framework's shrink
+   hook).
+*/
+
+// Generate returns a random document as a reflect.Value holding a
+// *Sexpr, for testing/quick; see Random.
+func (*Sexpr) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(Random(r, size))
+}
+
+// Random returns a random document of one or more top-level forms with
+// at most size nodes (and at least one).  the document is parsed from
+// text, so positions are real and it round-trips through
+// EncodeCanonical.  atoms are of every kind, in the various spellings
+// the reader takes; some lists are dotted and some elements are quoted
+// with ', `, , or ,@.  small documents are more likely than big ones.
+func Random(r *rand.Rand, size int) *Sexpr {
+	if size < 1 {
+		size = 1
+	}
+	budget := 1 + r.Intn(size)
+	var b strings.Builder
+	for first := true; first || budget > 0 && r.Intn(3) == 0; first = false {
+		if !first {
+			b.WriteByte('\n')
+		}
+		randomElement(r, &b, &budget, 0)
+	}
+	s, err := parseForms(context.Background(), b.String())
+	if err != nil {
+		panic("sexpr: Random generated unparsable text: " + err.Error())
+	}
+	return s
+}
+
+// write a random element using at most *budget nodes (but always one)
+func randomElement(r *rand.Rand, b *strings.Builder, budget *int, depth int) {
+	*budget--
+	if *budget > 0 && r.Intn(8) == 0 {
+		// the quote form is a list of two, so it costs a node
+		b.WriteString(quotePrefixes[r.Intn(len(quotePrefixes))])
+		randomElement(r, b, budget, depth+1)
+		return
+	}
+	if *budget <= 0 || r.Intn(3+depth) > 1 {
+		b.WriteString(randomAtom(r))
+		return
+	}
+	b.WriteByte('(')
+	elems := 0
+	for n := r.Intn(5); n > 0 && *budget > 0; n-- {
+		randomElement(r, b, budget, depth+1)
+		elems++
+		if n > 1 && *budget > 0 {
+			b.WriteByte(' ')
+		}
+	}
+	if elems > 0 && *budget > 0 && r.Intn(4) == 0 {
+		b.WriteString(" . ")
+		randomElement(r, b, budget, depth+1)
+	}
+	b.WriteByte(')')
+}
+
+const symbolChars = "abcdefghijklmnopqrstuvwxyz-+*?!<=>"
+
+var quotePrefixes = []string{"'", "`", ",", ",@"}
+
+// what random strings are made of, escapes included
+var stringPieces = []string{" ", "(", ")", "a", "b", "c", ";", "#", `\"`, `\\`, `\n`, `\u00e9`}
+
+// character literals, including ones a naive tokenizer would split
+var randomChars = []string{`#\a`, `#\Z`, `#\λ`, `#\(`, `#\)`, `#\;`, `#\"`, `#\|`, `#\'`,
+	`#\space`, `#\newline`, `#\tab`, `#\nul`, `#\x41`, `#\x3bb`}
+
+func randomAtom(r *rand.Rand) string {
+	switch r.Intn(12) {
+	case 0:
+		return strconv.Itoa(r.Intn(201) - 100)
+	case 1:
+		var b strings.Builder
+		b.WriteByte('"')
+		for n := r.Intn(6); n > 0; n-- {
+			b.WriteString(stringPieces[r.Intn(len(stringPieces))])
+		}
+		b.WriteByte('"')
+		return b.String()
+	case 2:
+		f := strconv.Itoa(r.Intn(201)-100) + "." + strconv.Itoa(r.Intn(1000))
+		if r.Intn(3) == 0 {
+			f += "e" + strconv.Itoa(r.Intn(61)-30)
+		}
+		return f
+	case 3:
+		return strconv.Itoa(r.Intn(201)-100) + "/" + strconv.Itoa(1+r.Intn(50))
+	case 4:
+		return ":" + randomSymbol(r)
+	case 5:
+		return []string{"#t", "#f"}[r.Intn(2)]
+	case 6:
+		return "nil"
+	case 7:
+		return randomChars[r.Intn(len(randomChars))]
+	case 8:
+		octets := make([]byte, r.Intn(6))
+		r.Read(octets)
+		if r.Intn(2) == 0 {
+			return "#" + hex.EncodeToString(octets) + "#"
+		}
+		return "|" + base64.StdEncoding.EncodeToString(octets) + "|"
+	}
+	return randomSymbol(r)
+}
+
+func randomSymbol(r *rand.Rand) string {
+	n := 1 + r.Intn(6)
+	buf := make([]byte, n)
+	buf[0] = symbolChars[r.Intn(26)]
+	for i := 1; i < n; i++ {
+		buf[i] = symbolChars[r.Intn(len(symbolChars))]
+	}
+	return string(buf)
+}
+
+// Shrink returns documents that are simpler than s, the most drastic
+// simplifications first: each list replaced by one of its elements or
+// by its dotted tail, each element or dotted tail removed, each atom
+// replaced by a, and each dotted tail shrunk in place.  a document is
+// never shrunk to nothing.  the candidates are freshly parsed, so
+// their positions describe their own canonical text.
+func Shrink(s *Sexpr) []*Sexpr {
+	var hoist, drop, simplify []Change
+	forms := chainSlice(s)
+	var visit func(el *Sexpr, path []int)
+	visit = func(el *Sexpr, path []int) {
+		p := append([]int(nil), path...)
+		if len(p) > 1 || len(forms) > 1 {
+			drop = append(drop, Change{Kind: ChangeDelete, Path: p, Old: detach(el)})
+		}
+		if el.sty == sexprAtom {
+			if el.val != "a" {
+				simplify = append(simplify, Change{Kind: ChangeReplace, Path: p,
+					Old: detach(el), New: &Sexpr{sty: sexprAtom, val: "a"}})
+			}
+			return
+		}
+		for i, c := range chainSlice(el.list) {
+			hoist = append(hoist, Change{Kind: ChangeReplace, Path: p,
+				Old: detach(el), New: detach(c)})
+			visit(c, append(p, i))
+		}
+		if el.tail == nil {
+			return
+		}
+		// paths can't reach past the dot, so the tail is shrunk by
+		// replacing the whole list
+		replace := func(group *[]Change, n *Sexpr) {
+			*group = append(*group, Change{Kind: ChangeReplace, Path: p, Old: detach(el), New: n})
+		}
+		replace(&hoist, detach(el.tail))
+		replace(&drop, withTail(el, nil))
+		for _, t := range Shrink(detach(el.tail)) {
+			replace(&simplify, withTail(el, t))
+		}
+	}
+	for i, f := range forms {
+		visit(f, []int{i})
+	}
+
+	var out []*Sexpr
+	for _, group := range [][]Change{hoist, drop, simplify} {
+		for _, c := range group {
+			t, err := Patch(s, []Change{c})
+			if err != nil {
+				continue
+			}
+			if t, err = parseForms(context.Background(), string(EncodeCanonical(t))); err == nil {
+				out = append(out, t)
+			}
+		}
+	}
+	return out
+}
+
+// a copy of the dotted list el with tail t, or a proper list if t is nil
+func withTail(el, t *Sexpr) *Sexpr {
+	n := detach(el)
+	n.tail, n.hash = t, nil
+	return n
+}
+
+// Minimize shrinks s for as long as fails keeps returning true for the
+// smaller document, and returns the smallest failing document found.
+// fails should be true for s itself.
+func Minimize(s *Sexpr, fails func(*Sexpr) bool) *Sexpr {
+	for {
+		smaller := false
+		for _, c := range Shrink(s) {
+			if fails(c) {
+				s, smaller = c, true
+				break
+			}
+		}
+		if !smaller {
+			return s
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package sexpr
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// Random produces every kind of atom, and quote forms
+func TestRandomKinds(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	seen := make(map[string]bool)
+	var visit func(s *Sexpr)
+	visit = func(s *Sexpr) {
+		if s.IsAtom() {
+			seen[s.AtomKind().String()] = true
+			return
+		}
+		kids := s.Children()
+		if len(kids) > 0 && kids[0].IsAtom() {
+			switch kids[0].val {
+			case "quote", "quasiquote", "unquote", "unquote-splicing":
+				seen[kids[0].val] = true
+			}
+		}
+		if s.tail != nil {
+			seen["dotted"] = true
+			visit(s.tail)
+		}
+		for _, k := range kids {
+			visit(k)
+		}
+	}
+	for i := 0; i < 2000; i++ {
+		for s := Random(r, 20); s != nil; s = s.Next() {
+			visit(s)
+		}
+	}
+	for _, want := range []string{"symbol", "string", "integer", "float", "rational",
+		"keyword", "boolean", "nil", "character", "bytes",
+		"quote", "quasiquote", "unquote", "unquote-splicing", "dotted"} {
+		if !seen[want] {
+			t.Errorf("no %s in 2000 random documents", want)
+		}
+	}
+}
+
+func TestShrinkTail(t *testing.T) {
+	s, err := Parse("(a b . (c d . e))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]bool)
+	for _, c := range Shrink(s) {
+		got[docText(c)] = true
+	}
+	for _, want := range []string{"(c d . e)", "(a b)", "(a b . e)", "(a b . (c . e))", "(a b . (c d))", "(a b . (c d . a))"} {
+		if !got[want+"\n"] {
+			t.Errorf("no %s among the shrinks of %s", want, s.Text())
+		}
+	}
+}
+
+// Minimize gets down to the element a property fails on, even when it
+// sits behind a dot
+func TestMinimize(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	fails := func(s *Sexpr) bool { return strings.Contains(docText(s), `#\(`) }
+	for i := 0; i < 200; i++ {
+		s := Random(r, 40)
+		if !fails(s) {
+			continue
+		}
+		if got := docText(Minimize(s, fails)); got != "#\\(\n" {
+			t.Errorf("Minimize(%s) = %s", docText(s), got)
+		}
+	}
+}
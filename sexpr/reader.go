@@ -0,0 +1,50 @@
+package sexpr
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"time"
+)
+
+// ParseReader is ParseAll for input read from r, lexing it as it
+// arrives instead of reading it all into memory first, so only the tree
+// (and the text of the token being lexed) is held.  the forms come back
+// as a sequence linked through Next, the same as ParseAll would give
+// for the whole input, apart from errors about unbalanced parens: those
+// can't look back over the input to guess where the mistake was, so
+// they point at the innermost list left open,
+// or at the extra ')'.  an error reading from r is returned as it is.
+func ParseReader(r io.Reader) (*Sexpr, error) {
+	return ParseReaderContext(context.Background(), r)
+}
+
+// ParseReaderContext is ParseReader with a context, as ParseContext.
+func ParseReaderContext(ctx context.Context, r io.Reader) (*Sexpr, error) {
+	start := time.Now()
+	l := &lexer{
+		r:     bufio.NewReader(r),
+		items: make(chan item),
+		ctx:   ctx,
+		line:  1,
+		col:   1,
+	}
+	go l.run()
+	p := &parser{stream: true, items: l.items, ctx: ctx}
+	s, err := p.parse()
+	if err != nil {
+		for range l.items {
+			p.tokens++
+		}
+	}
+	// the lexer sets err before sending its last item, so it can be
+	// looked at once the parser has that item, or the channel is closed
+	if l.err != nil && ctx.Err() == nil {
+		s, err = nil, l.err
+	}
+	if err != nil {
+		s = nil
+	}
+	recordParse(p.tokens, s, err, start)
+	return s, err
+}
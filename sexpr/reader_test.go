@@ -0,0 +1,75 @@
+package sexpr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// a long run of siblings must not cost stack: the parser loops over
+// them and only recurses, if at all, for nesting
+func TestParseReaderFlat(t *testing.T) {
+	in := strings.Repeat("a ", 1500000)
+	s, err := ParseReader(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for ; s != nil; s = s.Next() {
+		n++
+	}
+	if n != 1500000 {
+		t.Errorf("got %d forms, want 1500000", n)
+	}
+	s, err = Parse("(" + in + ")")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(s.Children()); got != 1500000 {
+		t.Errorf("got %d elements, want 1500000", got)
+	}
+}
+
+// reading from an io.Reader gives the same trees, positions and errors
+// as parsing a string, however the reader splits up the input.  errors
+// about unbalanced parens are the exception: without the whole input to
+// look over, ParseReader doesn't guess where the mistake was.
+func TestParseReaderMatchesParse(t *testing.T) {
+	r := rand.New(rand.NewSource(8))
+	for i := 0; i < 3000; i++ {
+		input := randomText(r)
+		if r.Intn(2) == 0 {
+			// and a stray piece, which often breaks it
+			at := r.Intn(len(input) + 1)
+			input = input[:at] + editPieces[r.Intn(len(editPieces))] + input[at:]
+		}
+		want, werr := parseForms(context.Background(), input)
+		got, err := ParseReader(strings.NewReader(input))
+		sameRead(t, input, got, err, want, werr)
+		got, err = ParseReader(iotest.OneByteReader(strings.NewReader(input)))
+		sameRead(t, input, got, err, want, werr)
+	}
+}
+
+func sameRead(t *testing.T, input string, got *Sexpr, err error, want *Sexpr, werr error) {
+	t.Helper()
+	var be, wbe *BalanceError
+	if errors.As(err, &be) && errors.As(werr, &wbe) {
+		if be.Err != wbe.Err || be.Missing != wbe.Missing {
+			t.Fatalf("ParseReader(%q): error %v, want %v", input, err, werr)
+		}
+		return
+	}
+	if fmt.Sprint(err) != fmt.Sprint(werr) {
+		t.Fatalf("ParseReader(%q): error %v, want %v", input, err, werr)
+	}
+	if err == nil {
+		if d := sameParse(got, want); d != "" {
+			t.Fatalf("ParseReader(%q): %s", input, d)
+		}
+	}
+}
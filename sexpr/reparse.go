@@ -0,0 +1,287 @@
+package sexpr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Edit describes a change to some input: Len bytes starting at byte
+// Offset were replaced by Text.
+type Edit struct {
+	Offset int
+	Len    int
+	Text   string
+}
+
+// Apply returns input with the edit made to it.
+func (e Edit) Apply(input string) string {
+	return input[:e.Offset] + e.Text + input[e.Offset+e.Len:]
+}
+
+// returned internally when the edited region doesn't parse on its own
+// and we have to widen the search
+var errWiden = errors.New("sexpr: edited region does not parse on its own")
+
+// Reparse parses the result of applying e to input, given old, the
+// result of parsing input.  only the elements touched by the edit are
+// lexed and parsed again: the search descends into the innermost list
+// that strictly contains the edit and reparses the affected elements of
+// that list.  untouched subtrees before the edit are shared with old;
+// those after it are shared too if the edit doesn't move them (it
+// replaces text with text of the same length and shape), and otherwise
+// copied with their offsets, lines and columns adjusted, which is far
+// cheaper than lexing them again.  old is not modified.
+//
+// if the affected region doesn't parse cleanly by itself (say the edit
+// unbalanced the parens or opened a string), Reparse falls back to
+// parsing the whole new input, so the result and any error are always
+// the same as ParseAll would give.  the new input is returned alongside.
+func Reparse(old *Sexpr, input string, e Edit) (*Sexpr, string, error) {
+	if e.Offset < 0 || e.Len < 0 || e.Offset+e.Len > len(input) {
+		return nil, "", fmt.Errorf("sexpr: edit at %d of length %d is outside input of length %d",
+			e.Offset, e.Len, len(input))
+	}
+	r := &reparser{
+		off:    e.Offset,
+		oldEnd: e.Offset + e.Len,
+		delta:  len(e.Text) - e.Len,
+		moved:  !sameShape(input[e.Offset:e.Offset+e.Len], e.Text),
+		text:   e.Apply(input),
+	}
+	if s, err := r.seq(old, 0, len(input)); err == nil {
+		return s, r.text, nil
+	}
+	s, err := parseForms(context.Background(), r.text)
+	return s, r.text, err
+}
+
+// state for one Reparse.  off and oldEnd bound the replaced bytes in
+// the old input; delta is the change in length and moved is set if
+// anything after the edit changes position; text is the new input and
+// lines its line index, built when first needed.
+type reparser struct {
+	off, oldEnd int
+	delta       int
+	moved       bool
+	text        string
+	lines       *lineIndex
+}
+
+func (r *reparser) index() *lineIndex {
+	if r.lines == nil {
+		r.lines = newLineIndex(r.text)
+	}
+	return r.lines
+}
+
+// true if b could replace a without moving anything after it: the same
+// length, the same number of lines and the same number of runes on each
+func sameShape(a, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	al, bl := strings.Split(a, "\n"), strings.Split(b, "\n")
+	if len(al) != len(bl) {
+		return false
+	}
+	for i := range al {
+		if utf8.RuneCountInString(al[i]) != utf8.RuneCountInString(bl[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// lineIndex finds the line and column of byte offsets in some text
+type lineIndex struct {
+	text   string
+	starts []int // offset of the start of each line
+}
+
+func newLineIndex(text string) *lineIndex {
+	x := &lineIndex{text: text, starts: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			x.starts = append(x.starts, i+1)
+		}
+	}
+	return x
+}
+
+// 1-based line and column (in runes) of off.  columns are counted as
+// the lexer counts them, one per byte that can start a rune, so they
+// agree with it on invalid UTF-8 too.
+func (x *lineIndex) at(off int) (line, col int) {
+	line = sort.SearchInts(x.starts, off+1)
+	col = 1
+	for i := x.starts[line-1]; i < off; i++ {
+		if utf8.RuneStart(x.text[i]) {
+			col++
+		}
+	}
+	return line, col
+}
+
+// rebuild the sequence of elements starting at first, which must contain
+// the edit (or be the top level).  from and to bound the text the
+// sequence occupies in the old input.
+func (r *reparser) seq(first *Sexpr, from, to int) (*Sexpr, error) {
+	var elems []*Sexpr
+	for cur := first; cur != nil; cur = cur.next {
+		elems = append(elems, cur)
+	}
+
+	// if the edit is strictly between the parens of one list, only that
+	// list's contents need looking at.  lists read from quote shorthand
+	// have no parens of their own, so they don't count, and neither do
+	// dotted lists, which are simply reparsed whole.
+	for i, el := range elems {
+		if el.sty == sexprList && el.tail == nil && el.pos < r.off && r.oldEnd < el.end-1 && r.text[el.pos] == '(' {
+			kids, err := r.seq(el.list, el.pos+1, el.end-1)
+			if err != nil {
+				break
+			}
+			n := *el
+			n.list = kids
+			n.hash = nil
+			n.end = el.end + r.delta
+			return r.splice(elems[:i], []*Sexpr{&n}, elems[i+1:]), nil
+		}
+	}
+
+	// otherwise reparse every element touching the edit, along with the
+	// edit itself and the gaps up to the untouched elements either side.
+	// the gaps take in any comments, which the edit may have opened,
+	// closed or moved, and the region starts and ends on token
+	// boundaries since neighbouring elements are separated by whitespace
+	// or delimiters.
+	start, stop := -1, -1
+	for i, el := range elems {
+		if el.end >= r.off && el.pos <= r.oldEnd {
+			if start < 0 {
+				start = i
+			}
+			stop = i + 1
+		}
+	}
+	if start < 0 {
+		// edit falls between elements; find where new ones would go
+		start = 0
+		for start < len(elems) && elems[start].end < r.off {
+			start++
+		}
+		stop = start
+	}
+	lo, hi := from, to
+	if start > 0 {
+		lo = elems[start-1].end
+	}
+	if stop < len(elems) {
+		hi = elems[stop].pos
+	}
+
+	// and the region mustn't run into the untouched elements either side:
+	// the edit may have taken away what separated them
+	if r.joins(lo) || r.joins(hi+r.delta) {
+		return nil, errWiden
+	}
+	region := r.text[lo : hi+r.delta]
+	forms, comments, err := ParseComments(region)
+	if err != nil {
+		return nil, errWiden
+	}
+	// a line comment running to the end of the region would have gone
+	// on to swallow what follows it
+	if n := len(comments); n > 0 && comments[n-1].End() == len(region) &&
+		comments[n-1].Text[0] == ';' && hi+r.delta < len(r.text) {
+		return nil, errWiden
+	}
+	var mid []*Sexpr
+	for cur := forms; cur != nil; cur = cur.next {
+		cur.shift(lo, r.index())
+		mid = append(mid, cur)
+	}
+	return r.splice(elems[:start], mid, elems[stop:]), nil
+}
+
+// true if the bytes either side of offset off in the new text might lex
+// as one token.  a backslash just before off could be the start of a
+// character literal, which takes the next character whatever it is, so
+// the bytes either side of that don't separate anything.
+func (r *reparser) joins(off int) bool {
+	if off == 0 || off == len(r.text) {
+		return false
+	}
+	if r.text[off-1] == '\\' || off > 1 && r.text[off-2] == '\\' {
+		return true
+	}
+	a, b := r.text[off-1], r.text[off]
+	return !isDelim(a) && !isDelim(b) && b != ';'
+}
+
+// link prefix, mid and suffix into one new chain.  prefix elements are
+// shallow copies so their next pointers can change without touching the
+// old tree; suffix elements are moved by the edit's change in length.
+func (r *reparser) splice(prefix, mid, suffix []*Sexpr) *Sexpr {
+	nodes := make([]*Sexpr, 0, len(prefix)+len(mid))
+	for _, p := range prefix {
+		n := *p
+		nodes = append(nodes, &n)
+	}
+	nodes = append(nodes, mid...)
+	var tail *Sexpr
+	if len(suffix) > 0 {
+		tail = suffix[0]
+		if r.moved {
+			tail = shifted(tail, r.delta, r.index())
+		}
+	}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		nodes[i].next = tail
+		tail = nodes[i]
+	}
+	return tail
+}
+
+// move s and everything under it by delta bytes, in place, taking
+// lines and columns from x.  only used on freshly parsed nodes.
+func (s *Sexpr) shift(delta int, x *lineIndex) {
+	s.pos += delta
+	s.end += delta
+	s.line, s.col = x.at(s.pos)
+	for cur := s.list; cur != nil; cur = cur.next {
+		cur.shift(delta, x)
+	}
+	if s.tail != nil {
+		s.tail.shift(delta, x)
+	}
+}
+
+// a copy of the chain starting at s moved by delta bytes, with lines
+// and columns from x
+func shifted(s *Sexpr, delta int, x *lineIndex) *Sexpr {
+	if s == nil {
+		return nil
+	}
+	var head, prev *Sexpr
+	for cur := s; cur != nil; cur = cur.next {
+		n := *cur
+		n.pos += delta
+		n.end += delta
+		n.line, n.col = x.at(n.pos)
+		n.list = shifted(cur.list, delta, x)
+		n.tail = shifted(cur.tail, delta, x)
+		n.next = nil
+		if prev == nil {
+			head = &n
+		} else {
+			prev.next = &n
+		}
+		prev = &n
+	}
+	return head
+}
@@ -0,0 +1,98 @@
+package sexpr
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// "" if a and the elements following it are the same trees as b and
+// those following it, down to the spelling and position of every node,
+// or else where they first differ
+func sameParse(a, b *Sexpr) string {
+	for ; a != nil && b != nil; a, b = a.next, b.next {
+		if a.sty != b.sty || a.aty != b.aty || a.val != b.val ||
+			a.pos != b.pos || a.end != b.end || a.line != b.line || a.col != b.col {
+			return fmt.Sprintf("%q at %d:%d [%d,%d) vs %q at %d:%d [%d,%d)",
+				a.Text(), a.line, a.col, a.pos, a.end, b.Text(), b.line, b.col, b.pos, b.end)
+		}
+		if d := sameParse(a.list, b.list); d != "" {
+			return d
+		}
+		if (a.tail == nil) != (b.tail == nil) {
+			return fmt.Sprintf("%q and %q differ in dottedness", a.Text(), b.Text())
+		}
+		if a.tail != nil {
+			if d := sameParse(a.tail, b.tail); d != "" {
+				return d
+			}
+		}
+	}
+	if a != nil || b != nil {
+		return "different numbers of elements"
+	}
+	return ""
+}
+
+// what edits insert: whole atoms and lists, and pieces that unbalance
+// parens, open strings and comments or glue atoms together
+var editPieces = []string{"", " ", "\n", "x", "42", "(", ")", "()", "(a b)", `"`, `"s"`,
+	";", "; c\n", "#|", "|#", "#;", "'", ",@", ".", " . ", `#\(`, `#\`, "λ"}
+
+// the document text for a random test input: Random's, with comments
+// and odd whitespace thrown in
+func randomText(r *rand.Rand) string {
+	text := []byte(docText(Random(r, 30)))
+	for n := r.Intn(4); n > 0; n-- {
+		at := r.Intn(len(text) + 1)
+		piece := []string{" ", "\n\t", "; note\n", "#| block |#", "#;x "}[r.Intn(5)]
+		if at > 0 && text[at-1] == '\\' {
+			continue
+		}
+		text = append(text[:at], append([]byte(piece), text[at:]...)...)
+	}
+	return string(text)
+}
+
+// Reparse gives exactly what parsing the edited input from scratch does
+func TestReparse(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	for i := 0; i < 5000; i++ {
+		input := randomText(r)
+		old, err := parseForms(context.Background(), input)
+		if err != nil {
+			continue
+		}
+		off := r.Intn(len(input) + 1)
+		e := Edit{Offset: off, Len: r.Intn(len(input) - off + 1), Text: editPieces[r.Intn(len(editPieces))]}
+		if r.Intn(3) == 0 {
+			e.Len = 0
+		}
+		got, text, err := Reparse(old, input, e)
+		want, werr := parseForms(context.Background(), e.Apply(input))
+		if text != e.Apply(input) {
+			t.Fatalf("Reparse(%q, %+v) gave text %q", input, e, text)
+		}
+		if fmt.Sprint(err) != fmt.Sprint(werr) {
+			t.Fatalf("Reparse(%q, %+v): error %v, want %v", input, e, err, werr)
+		}
+		if err != nil {
+			continue
+		}
+		if d := sameParse(got, want); d != "" {
+			t.Fatalf("Reparse(%q, %+v): %s", input, e, d)
+		}
+		if d := sameParse(old, mustParse(t, input)); d != "" {
+			t.Fatalf("Reparse(%q, %+v) changed the old tree: %s", input, e, d)
+		}
+	}
+}
+
+func mustParse(t *testing.T, input string) *Sexpr {
+	s, err := parseForms(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
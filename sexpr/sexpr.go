@@ -1,18 +1,56 @@
 /*
-    Package sexpr implements a library for simplified
-    LISP-style symbolic expressions.
+Package sexpr implements a library for simplified
+LISP-style symbolic expressions.
 
-    based on Rob Pike's 2011 lexical scanning in go talk.
+based on Rob Pike's 2011 lexical scanning in go talk.
 
-    matt@galois.com // sept. 2011
+the package is meant to be imported by other programs, not copied into
+them:
+
+	import "github.com/mjsottile/gocode/sexpr"
+
+	s, err := sexpr.Parse(`(server (host "example.org") (port 8080))`)
+	if err != nil {
+		// a *diag.SourceError, with the position of the problem
+	}
+	for _, e := range s.Children()[1:] {
+		fmt.Println(e.Children()[0].Value()) // host, then port
+	}
+
+Parse is for input holding exactly one form, and ParseAll for any
+number of top-level forms, which it returns in order, each linked to
+the next through Next.  an element is an atom (IsAtom, Value, and by
+its AtomKind Int, BigInt, Rat, Float64, Str, Bool, Rune or Bytes) or a
+list (IsList, Children, and Tail for the element after the dot of a
+dotted list like (a . b)), and knows the byte range of the input it
+came from (Pos, End).  NewAtom, NewString, NewBytes, NewList,
+NewDotted and NewForms build trees in code, and Equal, Hash, Diff and Patch compare and change them.
+Marshal and Unmarshal convert between Go values and documents of
+(name value) entries, using `sexpr:"name"` struct tags, and Encoder
+and Decoder do the same for a stream of values, one form each.
+MarshalJSON, ToXML and FromXML bridge to JSON and XML, and EncodeCsexp
+and ParseCsexp to Rivest's canonical encoding.  the
+command-line tools under cmd/ and the packages beside this one are all
+written against this exported API only.
+
+matt@galois.com // sept. 2011
 */
-package main
+package sexpr
 
 import (
-  "utf8"
-  "fmt"
-  "strings"
-  "os"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mjsottile/gocode/diag"
+	"github.com/mjsottile/gocode/viz"
 )
 
 /*
@@ -20,423 +58,1011 @@ import (
 */
 
 // lexer item type
-type itemType  int
-
-// s-expression atom type
-type atomType  int
+type itemType int
 
 // s-expression element type
 type sexprType int
 
-// s-expression lexer item
+// s-expression lexer item.  pos is the byte offset of the item in the
+// input, line and col its 1-based line and column (in runes).
 type item struct {
-    typ itemType
-    val string
+	typ  itemType
+	val  string
+	pos  int
+	line int
+	col  int
 }
 
 // s-expression structure item
-type sexpr struct {
-    aty atomType
-    sty sexprType
-    next *sexpr
-    list *sexpr
-    val  string
+type Sexpr struct {
+	aty  AtomKind
+	sty  sexprType
+	next *Sexpr
+	list *Sexpr
+	tail *Sexpr // the element after the dot of a dotted list, as in (a . b)
+	val  string
+	pos  int // byte offset of the first character in the input
+	end  int // byte offset just past the last character
+	line int // 1-based line and column (in runes) of pos, 0 if unknown
+	col  int
+
+	// content hash, filled in by Hash.  code building a node by copying
+	// another and changing what is under it must clear this.
+	hash *Hash
 }
 
-// lexer context
+// lexer context.  the lexer stops early, setting stopped, if ctx is
+// cancelled while it is waiting for the parser to take an item.
+//
+// the input is either all of input, or read from r a byte at a time
+// (see ParseReader), keeping only the text of the current item in tok.
+// err is set if reading from r fails.
 type lexer struct {
-    name  string
-    input string
-    start int
-    pos   int
-    width int
-    items chan item
+	name    string
+	input   string
+	r       *bufio.Reader
+	tok     []byte
+	err     error
+	start   int
+	pos     int
+	width   int
+	line    int // line and column of start
+	col     int
+	nest    int // depth of block comments
+	items   chan item
+	ctx     context.Context
+	stopped bool
 }
 
 // state function, concept borrowed from pike talk
 type stateFn func(*lexer) stateFn
 
+// parser context: the channel of items coming out of the lexer, plus
+// the input and the parens that are currently open so errors can say
+// where things went wrong.  stream is set when the input is being read
+// from a reader and so isn't available.
+type parser struct {
+	name      string
+	input     string
+	stream    bool
+	items     chan item
+	open      []item
+	lastClose int
+	tokens    int
+	ctx       context.Context
+
+	// set while nothing has been read since a '(' or quote prefix, so a
+	// dot there has no element before it
+	atHead bool
+
+	// comments seen, if keepComments is set
+	keepComments bool
+	comments     []Comment
+}
+
 /*
    constants
 */
 
 // lexer item types
 const (
-    itemError itemType = iota
-    itemRParen
-    itemLParen
-    itemEOF
-    itemAtom
+	itemError itemType = iota
+	itemRParen
+	itemLParen
+	itemEOF
+	itemAtom
+	itemComment
+	itemBadComment // unterminated block comment
+	itemQuote      // ' ` , or ,@
+	itemBadEscape  // malformed escape in a string
 )
 
 // s-expression element types : atoms or lists
 const (
-    sexprAtom sexprType = iota
-    sexprList
+	sexprAtom sexprType = iota
+	sexprList
 )
 
-// s-expression atom types.  currently only one useful type, but later we
-// can expand to explicltly distinguish double and single quoted atoms
-const (
-    atomBasic atomType = iota
-    atomInvalid
+// eof
+const eof rune = -1
+
+// errors reported by the parser.  these are wrapped in a
+// *diag.SourceError carrying the position, so test for them with
+// errors.Is.
+var (
+	ErrUnexpectedEOF       = errors.New("unexpected end of input")
+	ErrUnexpectedParen     = errors.New("unexpected ')'")
+	ErrUnterminatedString  = errors.New("unterminated string")
+	ErrUnterminatedComment = errors.New("unterminated block comment")
+	ErrNothingQuoted       = errors.New("nothing after quote")
+	ErrBadEscape           = errors.New("bad escape sequence in string")
+	ErrBadDot              = errors.New("misplaced dot")
+	ErrBadChar             = errors.New("bad character literal")
+	ErrBadBytes            = errors.New("bad byte string")
+	ErrTrailingInput       = errors.New("extra input after form")
 )
 
-// eof
-const eof = -1
+// SyntaxError is the detail behind every error Parse returns for bad
+// input.  it sits between the *diag.SourceError and the Err values
+// above (or a *BalanceError), so errors.As finds it and errors.Is
+// still sees through it.
+type SyntaxError struct {
+	// byte offset where the parser stopped: the offending token, or the
+	// end of the input.  for unbalanced parens the SourceError points at
+	// the best guess of where the mistake was instead, which may be
+	// elsewhere.
+	Offset int
+
+	// the text of the offending token: ")" for an extra paren, the
+	// string from its opening quote on for an unterminated one (just the
+	// quote when parsing from a reader), "" at the end of the input
+	Token string
+
+	// the cause
+	Err error
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("syntax error at %q", e.Token)
+	}
+	return e.Err.Error()
+}
+
+func (e *SyntaxError) Unwrap() error { return e.Err }
 
 /*
    functions
 */
 
-// given an s-expression and a channel, emit a sequence of characters
-// representing the unparsed s-expression
-func unparse (s *sexpr, ch chan byte) {
-    _unparse(s,ch)
-    close(ch)
-}
-
-// helper for unparse - this one recurses, so we don't necessarily know
-// where we are in the overall structure - so it can't close the channel.
-// the unparse function that calls this DOES know, so that is the one that
-// gets called.
-func _unparse (s *sexpr, ch chan byte) {
-    if (s == nil) {
-        return
-    }
-    cur := s
-    for cur != nil {
-        switch cur.sty {
-        case sexprList:
-            ch <- '('
-            _unparse(cur.list, ch)
-            ch <- ')'
-        case sexprAtom:
-            for i := range cur.val {
-                ch <- cur.val[i]
-            }
-        default:
-            panic("Impossible happened.")
-        }
-        if (cur.next != nil) {
-            ch <- ' '
-        }
-        cur = cur.next
-    }
+// dump an s-expression to a graphviz dot represenation to look at
+func ToDotFile(s *Sexpr, filename string) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	err = viz.WriteDOT(file, "sexp", ToGraph(s))
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
 
-// dump an s-expression to a graphviz dot represenation to look at
-func sexprToDotFile (s *sexpr, filename string) {
-    file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC,0644)
-    if err != nil {
-        panic("Error opening file")
-    } else {
-        fmt.Fprintf(file,"digraph sexp {\n")
-        _sexprToDotFile(s,file,1);
-        fmt.Fprintf(file,"}\n")
-    }
-}
-
-// helper used by sexprToDotFile that does the actual IO, and threads a
-// counter through so that we can uniquely name the s-expression elements
-// in the graphviz output
-func _sexprToDotFile(s *sexpr, file *os.File, id int) int {
-    fmt.Fprintf(file,"  sx%d [shape=record,label=\"", id)
-    switch s.sty {
-    case sexprAtom:
-        safeVal := fmt.Sprintf("%q",s.val)
-        fmt.Fprintf(file,"<type> ATOM value=%s ", safeVal[1:len(safeVal)-1])
-        break
-    case sexprList:
-        fmt.Fprintf(file,"<type> LIST")
-        break
-    default:
-        panic("Noooooo!")
-    }
-    
-    fmt.Fprintf(file,"| <list> list | <next> next\"];\n")
-    if (s.sty == sexprAtom) {
-        if (s.next != nil) {
-            next_id := _sexprToDotFile(s.next, file, id+1)
-            fmt.Fprintf(file,"  sx%d:next -> sx%d:type;\n", id, id+1)
-            return next_id+1;
-        }
-        return id+1;
-    } else {
-        if (s.list != nil) {
-            list_id := _sexprToDotFile(s.list, file, id+1)
-            fmt.Fprintf(file,"  sx%d:list -> sx%d:type;\n", id, id+1)
-            if (s.next != nil) {
-                next_id := _sexprToDotFile(s.next, file, list_id)
-                fmt.Fprintf(file,"  sx%d:next -> sx%d:type;\n", id, list_id)
-                return next_id+1;
-            }
-        } else {
-            if (s.next != nil) {
-                next_id := _sexprToDotFile(s.next, file, id+1)
-                fmt.Fprintf(file,"  sx%d:next -> sx%d:type;\n", id, id+1)
-                return next_id+1;
-            }
-        }
-        return id+1;
-    }
-    return id;
+// build a graph of the s-expression structure suitable for any of the
+// writers in the viz package.  every element becomes a node, with edges
+// labeled "list", "tail" and "next" following the structure pointers.
+func ToGraph(s *Sexpr) viz.Graph {
+	g := &viz.Digraph{}
+	if s != nil {
+		_toGraph(s, g, 1)
+	}
+	return g
+}
+
+// helper used by ToGraph that threads a counter through so that we can
+// uniquely name the s-expression elements in the graph.  returns the
+// next unused id.
+func _toGraph(s *Sexpr, g *viz.Digraph, id int) int {
+	name := fmt.Sprintf("sx%d", id)
+	if s.sty == sexprAtom {
+		g.AddNode(name, "ATOM value="+s.val)
+	} else {
+		g.AddNode(name, "LIST")
+	}
+
+	next := id + 1
+	if s.sty == sexprList && s.list != nil {
+		g.AddEdge(name, fmt.Sprintf("sx%d", next), "list")
+		next = _toGraph(s.list, g, next)
+	}
+	if s.tail != nil {
+		g.AddEdge(name, fmt.Sprintf("sx%d", next), "tail")
+		next = _toGraph(s.tail, g, next)
+	}
+	if s.next != nil {
+		g.AddEdge(name, fmt.Sprintf("sx%d", next), "next")
+		next = _toGraph(s.next, g, next)
+	}
+	return next
+}
+
+// true if s is an atom
+func (s *Sexpr) IsAtom() bool { return s != nil && s.sty == sexprAtom }
+
+// true if s is a list (possibly empty)
+func (s *Sexpr) IsList() bool { return s != nil && s.sty == sexprList }
+
+// the text of an atom as it appeared in the input, including the quotes
+// for double quoted atoms.  lists have no value and return "".
+func (s *Sexpr) Value() string {
+	if !s.IsAtom() {
+		return ""
+	}
+	return s.val
+}
+
+// the element following s in the list (or sequence of top-level forms)
+// that contains it, or nil at the end
+func (s *Sexpr) Next() *Sexpr {
+	if s == nil {
+		return nil
+	}
+	return s.next
+}
+
+// byte offset in the parsed input of the first character of s: the
+// opening paren of a list or the start of an atom
+func (s *Sexpr) Pos() int { return s.pos }
+
+// the position of s in the parsed input: its byte offset (as Pos) and
+// line and column.  elements that didn't come from parsing text have no
+// line, so the position's IsValid is false.
+func (s *Sexpr) Position() diag.Position {
+	return diag.Position{Offset: s.pos, Line: s.line, Column: s.col}
+}
+
+// byte offset in the parsed input just past the last character of s, so
+// input[s.Pos():s.End()] is the text s was parsed from
+func (s *Sexpr) End() int { return s.end }
+
+// the elements of a list, in order.  atoms have no children.  this lets
+// s-expressions be used with the traversal functions in the tree package.
+// the element after the dot of a dotted list is not one of them; see
+// Tail.
+func (s *Sexpr) Children() []*Sexpr {
+	var kids []*Sexpr
+	if s == nil || s.sty != sexprList {
+		return kids
+	}
+	for cur := s.list; cur != nil; cur = cur.next {
+		kids = append(kids, cur)
+	}
+	return kids
+}
+
+// the element after the dot of a dotted list like (a b . c), or nil for
+// a proper list or an atom
+func (s *Sexpr) Tail() *Sexpr {
+	if s == nil || s.sty != sexprList {
+		return nil
+	}
+	return s.tail
+}
+
+// build an atom from its text as it would appear in the input, including
+// the quotes of a double quoted atom.  its kind is worked out from the
+// text, as the parser does.  built elements have no position.
+func NewAtom(text string) *Sexpr {
+	return &Sexpr{sty: sexprAtom, aty: classifyAtom(text), val: text}
+}
+
+// build a list of the given elements, linking them together.  each
+// element must be standing alone, not already part of another list.
+func NewList(elems ...*Sexpr) *Sexpr {
+	return &Sexpr{aty: NotAtom, sty: sexprList, list: NewForms(elems...)}
+}
+
+// build a dotted list of the given elements followed by a dot and tail,
+// as in (a b . c).  like NewList, the elements and tail must be standing
+// alone.  a nil tail gives a proper list, and with no elements there is
+// nothing to put before the dot, so tail itself is returned: (. c) would
+// be c.
+func NewDotted(elems []*Sexpr, tail *Sexpr) *Sexpr {
+	if len(elems) == 0 {
+		return tail
+	}
+	s := NewList(elems...)
+	s.tail = tail
+	return s
+}
+
+// link standalone elements into a sequence of top-level forms, like the
+// one ParseAll returns, and return its first element (nil if there are
+// none)
+func NewForms(elems ...*Sexpr) *Sexpr {
+	for i := 0; i+1 < len(elems); i++ {
+		elems[i].next = elems[i+1]
+	}
+	if len(elems) == 0 {
+		return nil
+	}
+	return elems[0]
 }
 
 // pretty printer for lexer items
 func (i item) String() string {
-    switch i.typ {
-    case itemEOF:
-        return "EOF"
-    case itemError:
-        return i.val
-    }
-    if len(i.val) > 20 {
-        return fmt.Sprintf("%d:%.20q...", i.typ, i.val)
-    }
-    return fmt.Sprintf("%d:%q", i.typ, i.val)
+	switch i.typ {
+	case itemEOF:
+		return "EOF"
+	case itemError:
+		return i.val
+	}
+	if len(i.val) > 20 {
+		return fmt.Sprintf("%d:%.20q...", i.typ, i.val)
+	}
+	return fmt.Sprintf("%d:%q", i.typ, i.val)
 }
 
 // pretty printer for s-expression structures.  "pretty" is debatable...
-func (s sexpr) String() string {
-    switch s.sty {
-    case sexprList:
-        return fmt.Sprintf("LIST:\n  next=%s\n  list=%s\n",s.next,s.list)
-    case sexprAtom:
-        return fmt.Sprintf("%s -> %s",s.val,s.next)
-    }
-    return ""
-}
-
-// given a channel of lexer items, parse them into a s-expression structure
-func parse (ch chan item) (* sexpr) {
-    i, ok := <-ch
-
-    if !ok {
-        panic("channel feeding parse closed prematurely - malformed sexpr.")
-    }
-
-    switch i.typ {
-    case itemLParen:
-        slist := parse (ch)
-        snext := parse (ch)
-        s := &sexpr { 
-          aty  : atomInvalid,
-          sty  : sexprList,
-          val  : "",
-          list : slist,
-          next : snext }
-        return s
-    case itemRParen:
-        return nil
-    case itemAtom:
-        snext := parse (ch)
-        s := &sexpr { 
-          aty  : atomBasic,
-          sty  : sexprAtom, 
-          val  : i.val, 
-          list : nil,
-          next : snext }
-        return s
-    case itemEOF:
-         return nil
-    default:
-        panic("Bad lex item type")
-    }
-    return nil
+func (s Sexpr) String() string {
+	switch s.sty {
+	case sexprList:
+		if s.tail != nil {
+			return fmt.Sprintf("LIST:\n  next=%s\n  list=%s\n  tail=%s\n", s.next, s.list, s.tail)
+		}
+		return fmt.Sprintf("LIST:\n  next=%s\n  list=%s\n", s.next, s.list)
+	case sexprAtom:
+		return fmt.Sprintf("%s -> %s", s.val, s.next)
+	}
+	return ""
+}
+
+// a list being built by parse: the '(' that opened it (the zero item
+// for the top level), the elements so far, the quote prefixes waiting
+// for the next element, and the dots seen in it
+type frame struct {
+	open  item
+	first *Sexpr
+	last  *Sexpr
+
+	quotes []item
+
+	// the last dot and the one before it, the element before the last
+	// dot, and how many elements have followed it
+	dots      int
+	dot       item
+	prevDot   item
+	beforeDot *Sexpr
+	afterDot  int
+}
+
+// add the finished element s to the list, inside the quotes waiting for
+// it
+func (f *frame) add(s *Sexpr) {
+	for len(f.quotes) > 0 {
+		q := f.quotes[len(f.quotes)-1]
+		f.quotes = f.quotes[:len(f.quotes)-1]
+		head := &Sexpr{
+			aty:  Symbol,
+			sty:  sexprAtom,
+			val:  quoteNames[q.val],
+			pos:  q.pos,
+			end:  q.pos + len(q.val),
+			line: q.line,
+			col:  q.col}
+		head.next = s
+		s = &Sexpr{
+			aty:  NotAtom,
+			sty:  sexprList,
+			list: head,
+			pos:  q.pos,
+			end:  s.end,
+			line: q.line,
+			col:  q.col}
+	}
+	if f.first == nil {
+		f.first = s
+	} else {
+		f.last.next = s
+	}
+	f.last = s
+	if f.dots > 0 {
+		f.afterDot++
+	}
+}
+
+// the next item from the lexer
+func (p *parser) item() (item, error) {
+	var i item
+	var ok bool
+	select {
+	case i, ok = <-p.items:
+	case <-p.ctx.Done():
+		return i, p.ctx.Err()
+	}
+	if !ok {
+		if err := p.ctx.Err(); err != nil {
+			return i, err
+		}
+		return i, p.errorf(item{pos: len(p.input)}, "", ErrUnexpectedEOF,
+			"lexer stopped before end of input")
+	}
+	p.tokens++
+	return i, nil
+}
+
+// given a channel of lexer items, parse them into a s-expression
+// structure.  siblings are read in a loop and the lists still open are
+// kept on a stack, so however long the input, only nesting takes space.
+func (p *parser) parse() (*Sexpr, error) {
+	stack := []*frame{{}}
+	for {
+		f := stack[len(stack)-1]
+		i, err := p.item()
+		if err != nil {
+			return nil, err
+		}
+		atHead := p.atHead
+		if i.typ != itemComment {
+			p.atHead = false
+		}
+
+		switch i.typ {
+		case itemLParen:
+			logAt(p.ctx, slog.LevelDebug, "parse: open list", "pos", i.pos, "depth", len(p.open))
+			p.open = append(p.open, i)
+			p.atHead = true
+			stack = append(stack, &frame{open: i})
+		case itemRParen:
+			if len(p.open) == 0 {
+				return nil, p.balanceError(ErrUnexpectedParen, i)
+			}
+			if err := p.unquoted(f); err != nil {
+				return nil, err
+			}
+			s, err := p.close(f)
+			if err != nil {
+				return nil, err
+			}
+			p.open = p.open[:len(p.open)-1]
+			p.lastClose = i.pos + len(i.val)
+			s.end = p.lastClose
+			logAt(p.ctx, slog.LevelDebug, "parse: close list", "pos", i.pos, "depth", len(p.open))
+			stack = stack[:len(stack)-1]
+			stack[len(stack)-1].add(s)
+		case itemAtom:
+			if i.val == "." {
+				if err := p.dot(f, i, atHead); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if strings.HasPrefix(i.val, `#\`) && classifyAtom(i.val) != Char {
+				return nil, p.errorf(i, i.val, ErrBadChar, "unknown character %s", i.val)
+			}
+			if looksLikeBytes(i.val) && classifyAtom(i.val) != Bytes {
+				return nil, p.errorf(i, i.val, ErrBadBytes, "bad byte string %s", i.val)
+			}
+			f.add(&Sexpr{
+				aty:  classifyAtom(i.val),
+				sty:  sexprAtom,
+				val:  internAtom(i.val),
+				pos:  i.pos,
+				end:  i.pos + len(i.val),
+				line: i.line,
+				col:  i.col})
+		case itemEOF:
+			if len(p.open) > 0 {
+				return nil, p.balanceError(ErrUnexpectedEOF, i)
+			}
+			if err := p.unquoted(f); err != nil {
+				return nil, err
+			}
+			return f.first, nil
+		case itemError:
+			tok := `"`
+			if !p.stream {
+				tok = p.input[i.pos:]
+			}
+			return nil, p.errorf(i, tok, ErrUnterminatedString, "%s", i.val)
+		case itemComment:
+			if p.keepComments {
+				p.comments = append(p.comments, Comment{Text: i.val, Pos: p.position(i)})
+			}
+		case itemQuote:
+			p.atHead = true
+			f.quotes = append(f.quotes, i)
+		case itemBadEscape:
+			return nil, p.errorf(i, i.val, ErrBadEscape, "bad escape %s in string", i.val)
+		case itemBadComment:
+			return nil, p.errorf(i, "#|", ErrUnterminatedComment, "%s", i.val)
+		default:
+			return nil, p.errorf(i, i.val, nil, "bad lex item %s", i)
+		}
+	}
+}
+
+// the error for a quote prefix in f with nothing after it, if there is
+// one
+func (p *parser) unquoted(f *frame) error {
+	if len(f.quotes) == 0 {
+		return nil
+	}
+	q := f.quotes[len(f.quotes)-1]
+	return p.errorf(q, q.val, ErrNothingQuoted, "nothing after %s", q.val)
+}
+
+// the dot of a dotted list, read as item i.  there must be an element
+// before it, and exactly one after it, which close checks.
+func (p *parser) dot(f *frame, i item, atHead bool) error {
+	if len(p.open) == 0 {
+		return p.errorf(i, i.val, ErrBadDot, "dot outside a list")
+	}
+	if atHead {
+		return p.errorf(i, i.val, ErrBadDot, "nothing before dot")
+	}
+	f.dots++
+	f.prevDot, f.dot = f.dot, i
+	f.beforeDot, f.afterDot = f.last, 0
+	return nil
+}
+
+// the list f, now that its ')' has been read.  a dot must be followed by
+// exactly one element, which is split off as the tail.
+func (p *parser) close(f *frame) (*Sexpr, error) {
+	s := &Sexpr{
+		aty:  NotAtom,
+		sty:  sexprList,
+		list: f.first,
+		pos:  f.open.pos,
+		line: f.open.line,
+		col:  f.open.col}
+	if f.dots == 0 {
+		return s, nil
+	}
+	bad := f.dot
+	if f.afterDot == 1 && f.dots > 1 {
+		bad = f.prevDot
+	}
+	if f.afterDot != 1 || f.dots > 1 {
+		return nil, p.errorf(bad, bad.val, ErrBadDot, "dot must be followed by exactly one element")
+	}
+	s.tail = f.beforeDot.next
+	f.beforeDot.next = nil
+	return s, nil
+}
+
+// build the error for unbalanced parens, found at lexer item i.  the
+// error is placed at the best guess of where the problem really is.
+// without the input there is nothing to guess from, so a missing paren
+// is reported at the innermost list left open.
+func (p *parser) balanceError(err error, i item) error {
+	var be *BalanceError
+	var pos diag.Position
+	if p.stream {
+		be = &BalanceError{Err: err, Missing: len(p.open)}
+		pos = p.position(i)
+		if err == ErrUnexpectedEOF && len(p.open) > 0 {
+			be.Opened = p.position(p.open[len(p.open)-1])
+			pos = be.Opened
+		}
+	} else {
+		var at int
+		be, at = analyzeBalance(p.name, p.input, err, i.pos)
+		pos = diag.PositionFor(p.name, p.input, at)
+	}
+	e := &diag.SourceError{
+		Pos: pos,
+		Err: &SyntaxError{Offset: i.pos, Token: i.val, Err: be},
+	}
+	logAt(p.ctx, slog.LevelDebug, "parse: error", "err", e)
+	return e
+}
+
+// the position of lexer item i
+func (p *parser) position(i item) diag.Position {
+	if i.line == 0 && !p.stream {
+		return diag.PositionFor(p.name, p.input, i.pos)
+	}
+	return diag.Position{Filename: p.name, Offset: i.pos, Line: i.line, Column: i.col}
+}
+
+// build a positioned error for token tok, found at lexer item i
+func (p *parser) errorf(i item, tok string, err error, format string, args ...interface{}) error {
+	se := &SyntaxError{Offset: i.pos, Token: tok, Err: err}
+	e := diag.Errorf(p.position(i), se, format, args...)
+	logAt(p.ctx, slog.LevelDebug, "parse: error", "err", e)
+	return e
+}
+
+// parse a string holding a single s-expression.  this wires the lexer
+// go-routine up to the parser and returns the resulting structure.
+// malformed input yields a *diag.SourceError wrapping a *SyntaxError
+// wrapping one of the Err values above.  anything but whitespace and
+// comments after the form is an error too, ErrTrailingInput at the
+// start of the extra form, and so is input with no form at all,
+// ErrUnexpectedEOF.  ParseAll is for input holding any number of forms.
+func Parse(input string) (*Sexpr, error) {
+	return ParseContext(context.Background(), input)
+}
+
+// ParseContext is Parse, but gives up and returns ctx.Err() if ctx is
+// cancelled or its deadline passes before parsing finishes.  the lexer
+// go-routine is shut down either way.
+func ParseContext(ctx context.Context, input string) (*Sexpr, error) {
+	s, err := parseForms(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		se := &SyntaxError{Offset: len(input), Err: ErrUnexpectedEOF}
+		return nil, diag.Errorf(diag.PositionFor("", input, len(input)), se, "no form in input")
+	}
+	if extra := s.next; extra != nil {
+		// the first token of the extra form: an atom, a paren, or a
+		// quote prefix (which ends where the head it stands for does)
+		tok := extra.val
+		if extra.sty == sexprList {
+			tok = input[extra.pos : extra.pos+1]
+			if tok != "(" {
+				tok = input[extra.pos:extra.list.end]
+			}
+		}
+		se := &SyntaxError{Offset: extra.pos, Token: tok, Err: ErrTrailingInput}
+		return nil, diag.Errorf(extra.Position(), se, "unexpected %s after the form", tok)
+	}
+	return s, nil
+}
+
+// ParseAll parses input holding any number of top-level forms, as files
+// of s-expressions usually do, and returns them in order.  they are
+// still linked through Next, so the first leads the sequence that
+// functions taking the forms of a document, like EncodeCanonical and
+// Diff, expect.  errors are those of Parse, apart from the two about
+// how many forms there are.
+func ParseAll(input string) ([]*Sexpr, error) {
+	return ParseAllContext(context.Background(), input)
+}
+
+// ParseAllContext is ParseAll with a context, as ParseContext.
+func ParseAllContext(ctx context.Context, input string) ([]*Sexpr, error) {
+	s, err := parseForms(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return chainSlice(s), nil
+}
+
+// parse every form in input, returning the first, with the others
+// following it through Next
+func parseForms(ctx context.Context, input string) (*Sexpr, error) {
+	start := time.Now()
+	_, items := lex(ctx, "", input)
+	p := &parser{input: input, items: items, ctx: ctx}
+	s, err := p.parse()
+	if err != nil {
+		// let the lexer run to completion so its go-routine exits
+		for range items {
+			p.tokens++
+		}
+		recordParse(p.tokens, nil, err, start)
+		return nil, err
+	}
+	recordParse(p.tokens, s, nil, start)
+	return s, nil
 }
 
 // lexer that fires off a go-routine that lexes the input string and
 // emits items into a channel
-func lex(name, input string) (*lexer, chan item) {
-    l := &lexer{
-      name : name,
-      input: input,
-      items: make(chan item),
-    }
-    
-    go l.run()
-    
-    return l, l.items
+func lex(ctx context.Context, name, input string) (*lexer, chan item) {
+	l := &lexer{
+		name:  name,
+		input: input,
+		items: make(chan item),
+		ctx:   ctx,
+		line:  1,
+		col:   1,
+	}
+
+	go l.run()
+
+	return l, l.items
 }
 
 // body of lexer go-routine that just spins until the current state function
 // becomes nil, representing the final exit state.  state functions return
 // the next state function.
 func (l *lexer) run() {
-    for state := lexAtom; state != nil; {
-        state = state(l)
-    }
-    close(l.items)
+	for state := lexAtom; state != nil && !l.stopped; {
+		state = state(l)
+	}
+	close(l.items)
 }
 
 // emit a lexer item with the given type and the string representing
 // the current region that was being lexed
 func (l *lexer) emit(t itemType) {
-    l.items <- item{t, l.input[l.start:l.pos]}
-    l.start = l.pos
+	i := item{t, l.text(), l.start, l.line, l.col}
+	l.send(i)
+	l.ignore()
+}
+
+// hand an item to the parser, unless the context is cancelled first
+func (l *lexer) send(i item) {
+	logAt(l.ctx, LevelTrace, "lex", "item", i, "pos", i.pos)
+	select {
+	case l.items <- i:
+	case <-l.ctx.Done():
+		l.stopped = true
+	}
 }
 
 // state for lexing an atom
 func lexAtom(l *lexer) stateFn {
-    // helper function that we use over and over - avoid replicating
-    // code in the body of lexAtom
-    emitHelper := func (l *lexer, t itemType, nextState stateFn) stateFn {
-        if (l.pos > l.start) {
-            l.emit(t)
-        }
-        return nextState
-    }
-
-    for {
-        if l.peek() == '(' {
-            return emitHelper(l, itemAtom, lexLeftParen)
-        }
-        if l.peek() == ')' {
-            return emitHelper(l, itemAtom, lexRightParen)
-        }
-        if l.peek() == '"' {
-            nextState := emitHelper(l, itemAtom, lexDQuote)
-            l.next()
-            return nextState
-        }
-        if l.peek() == ' '  || l.peek() == '\t' || 
-           l.peek() == '\r' || l.peek() == '\n' {
-            return emitHelper(l, itemAtom, lexWhitespace)
-        }
-        if l.next() == eof { break }
-    }
-    if l.pos > l.start {
-        l.emit(itemAtom)
-    }
-    l.emit(itemEOF)
-    return nil
+	// helper function that we use over and over - avoid replicating
+	// code in the body of lexAtom
+	emitHelper := func(l *lexer, t itemType, nextState stateFn) stateFn {
+		if l.pos > l.start {
+			l.emit(t)
+		}
+		return nextState
+	}
+
+	for {
+		if l.peek() == ';' {
+			return emitHelper(l, itemAtom, lexLineComment)
+		}
+		// #| only opens a comment, #\ a character, and quotes only
+		// quote, at the start of a token; inside an atom they are
+		// ordinary characters
+		if l.pos == l.start {
+			switch l.peek() {
+			case '#':
+				l.next()
+				switch l.peek() {
+				case '|':
+					l.next()
+					l.nest = 1
+					return lexBlockComment
+				case '\\':
+					// the character after the backslash is taken
+					// whatever it is, so #\( and #\space both work
+					l.next()
+					l.next()
+				}
+				continue
+			case '\'', '`', ',':
+				return lexQuote
+			}
+		}
+		if l.peek() == '(' {
+			return emitHelper(l, itemAtom, lexLeftParen)
+		}
+		if l.peek() == ')' {
+			return emitHelper(l, itemAtom, lexRightParen)
+		}
+		if l.peek() == '"' {
+			nextState := emitHelper(l, itemAtom, lexDQuote)
+			l.next()
+			return nextState
+		}
+		if l.peek() == ' ' || l.peek() == '\t' ||
+			l.peek() == '\r' || l.peek() == '\n' {
+			return emitHelper(l, itemAtom, lexWhitespace)
+		}
+		if l.next() == eof {
+			break
+		}
+	}
+	if l.pos > l.start {
+		l.emit(itemAtom)
+	}
+	l.emit(itemEOF)
+	return nil
 }
 
 // state for lexing a double quoted string
 func lexDQuote(l *lexer) stateFn {
-    if l.accept("\"") {
-        l.emit(itemAtom)
-        return lexAtom
-    }
-    l.next()
-    return lexDQuote
+	for {
+		switch l.next() {
+		case '"':
+			l.emit(itemAtom)
+			return lexAtom
+		case eof:
+			l.send(item{itemError, "unterminated string", l.start, l.line, l.col})
+			return nil
+		case '\\':
+			if bad := l.escape(); bad != "" {
+				l.send(item{itemBadEscape, bad, l.start, l.line, l.col})
+				return nil
+			}
+		}
+	}
+}
+
+// lex the rest of an escape sequence, just past its backslash, returning
+// its text if it is malformed.  the escapes are those of Go and JSON
+// that make sense here: \" \\ \n \t \r and \uXXXX with four hex
+// digits.  the error is reported at the start of the string.
+func (l *lexer) escape() string {
+	switch l.next() {
+	case '"', '\\', 'n', 't', 'r':
+		return ""
+	case 'u':
+		for i := 0; i < 4; i++ {
+			if !isHex(l.peek()) {
+				return l.tail(2 + i)
+			}
+			l.next()
+		}
+		return ""
+	case eof:
+		// the missing close quote is the real problem
+		return ""
+	}
+	n := 1 + l.width
+	// reading from a reader a multibyte character comes a byte at a
+	// time, so take the rest of it
+	for l.r != nil && !utf8.FullRuneInString(l.tail(n-1)) {
+		if c := l.peek(); c < 0x80 || c >= 0xc0 {
+			break
+		}
+		l.next()
+		n++
+	}
+	return l.tail(n)
+}
+
+// the last n bytes lexed
+func (l *lexer) tail(n int) string {
+	t := l.text()
+	return t[len(t)-n:]
+}
+
+func isHex(r rune) bool {
+	return '0' <= r && r <= '9' || 'a' <= r && r <= 'f' || 'A' <= r && r <= 'F'
+}
+
+// the lists the quote shorthands stand for: 'x reads as (quote x)
+var quoteNames = map[string]string{
+	"'":  "quote",
+	"`":  "quasiquote",
+	",":  "unquote",
+	",@": "unquote-splicing",
+}
+
+// state for a quote shorthand
+func lexQuote(l *lexer) stateFn {
+	if l.next() == ',' && l.peek() == '@' {
+		l.next()
+	}
+	l.emit(itemQuote)
+	return lexAtom
+}
+
+// state for a ; comment, which runs to the end of the line
+func lexLineComment(l *lexer) stateFn {
+	for {
+		if r := l.peek(); r == '\n' || r == eof {
+			l.emit(itemComment)
+			return lexAtom
+		}
+		l.next()
+	}
+}
+
+// state inside a #| |# comment, past the opening #|.  these nest, so
+// commenting out a region that has one in it works.
+func lexBlockComment(l *lexer) stateFn {
+	for {
+		switch l.next() {
+		case eof:
+			l.send(item{itemBadComment, "unterminated block comment", l.start, l.line, l.col})
+			return nil
+		case '|':
+			if l.peek() == '#' {
+				l.next()
+				if l.nest--; l.nest == 0 {
+					l.emit(itemComment)
+					return lexAtom
+				}
+			}
+		case '#':
+			if l.peek() == '|' {
+				l.next()
+				l.nest++
+			}
+		}
+	}
 }
 
 // state to spin through whitespace and throw it out between atoms
 func lexWhitespace(l *lexer) stateFn {
-    whitespace := " \r\n\t"
-    if l.accept(whitespace) {
-        l.ignore()
-        return lexWhitespace
-    }
-    return lexAtom
+	whitespace := " \r\n\t"
+	if l.accept(whitespace) {
+		l.ignore()
+		return lexWhitespace
+	}
+	return lexAtom
 }
 
 // state matching a left paren
 func lexLeftParen(l *lexer) stateFn {
-    l.pos += 1
-    l.emit(itemLParen)
-    return lexAtom
+	l.next()
+	l.emit(itemLParen)
+	return lexAtom
 }
 
 // state matching a right paren
 func lexRightParen(l *lexer) stateFn {
-    l.pos += 1
-    l.emit(itemRParen)
-    return lexAtom
+	l.next()
+	l.emit(itemRParen)
+	return lexAtom
 }
 
-
 // see if we can match the next item in the string to some element in the
 // string provided
 func (l *lexer) accept(valid string) bool {
-    if strings.IndexRune(valid, l.next()) >= 0 {
-        return true
-    }
-    l.backup()
-    return false
+	if strings.IndexRune(valid, l.next()) >= 0 {
+		return true
+	}
+	l.backup()
+	return false
 }
 
-// ignore the most recent character
+// ignore the most recent character, moving start (and its line and
+// column) up to pos
 func (l *lexer) ignore() {
-    l.start = l.pos
+	var text []byte
+	if l.r != nil {
+		text = l.tok
+		l.tok = l.tok[:0]
+	} else {
+		text = []byte(l.input[l.start:l.pos])
+	}
+	for _, c := range text {
+		switch {
+		case c == '\n':
+			l.line++
+			l.col = 1
+		case !utf8.RuneStart(c):
+			// continuation bytes don't start a new column
+		default:
+			l.col++
+		}
+	}
+	l.start = l.pos
 }
 
 // back up one
 func (l *lexer) backup() {
-    l.pos -= l.width
+	if l.r != nil && l.width > 0 {
+		l.r.UnreadByte()
+		l.tok = l.tok[:len(l.tok)-1]
+	}
+	l.pos -= l.width
 }
 
-// peek ahead but don't advance the position
-func (l *lexer ) peek() int {
-    rune := l.next()
-    l.backup()
-    return rune
-}
-
-// advance the position (if we can) and return the rune that was consumed
-func (l *lexer) next() (rune int) {
-    if l.pos >= len(l.input) {
-        l.width = 0
-        return eof
-    }
-    rune, l.width =
-        utf8.DecodeRuneInString(l.input[l.pos:])
-    l.pos += l.width
-    return rune
-}
-
-// spin through a channel of items and print them out until we hit the EOF
-// item
-func printall(ch chan item) {
-    for { 
-        i := <- ch
-        fmt.Println(i) 
-        if i.typ == itemEOF {
-            break
-        }
-    }
-}
-
-func printTheChars(ch chan byte) {
-    for { 
-        i, ok := <- ch
-        if !ok {
-            break
-        }
-        fmt.Printf("%c",i) 
-    }
-    fmt.Printf("\n")
+// the text from start to pos
+func (l *lexer) text() string {
+	if l.r != nil {
+		return string(l.tok)
+	}
+	return l.input[l.start:l.pos]
 }
 
-//
-// main for testing
-//
-func main() {
-    // make a test string
-    testexpr := "(test (test2 \"i am long\" test3) blah a b c d e f)"
-
-    // fire off the lexer goroutine and get the channel of lex items that
-    // it is emitting into
-    _, items := lex("S-Expression Lexer",testexpr)
-
-    // connect the parser to consume the channel of lex items.  this
-    // routine yields the parsed s-expression structure
-    s := parse(items)
-
-    // given the struct, now we can...
-
-    // put it in a dot file to look at with graphviz
-    sexprToDotFile(s,"test.dot");
-
-    // or, make a new channel that we can unparse it into
-    ch := make(chan byte)
-
-    // fire off the goroutine to do the unparsing, which will push
-    // the unparsed characters into the channel
-    go unparse(s, ch)
+// peek ahead but don't advance the position
+func (l *lexer) peek() rune {
+	r := l.next()
+	l.backup()
+	return r
+}
 
-    // hook up a consumer to read from the channel until it closes
-    printTheChars(ch)
-}
\ No newline at end of file
+// advance the position (if we can) and return the rune that was consumed.
+// reading from a reader this goes a byte at a time, returning bytes of
+// multibyte characters as runes of their own: that is enough to find the
+// delimiters, which are all ascii, and keeps the input as it was.
+func (l *lexer) next() (r rune) {
+	if l.r != nil {
+		c, err := l.r.ReadByte()
+		if err != nil {
+			if err != io.EOF {
+				l.err = err
+			}
+			l.width = 0
+			return eof
+		}
+		l.tok = append(l.tok, c)
+		l.width = 1
+		l.pos++
+		return rune(c)
+	}
+	if l.pos >= len(l.input) {
+		l.width = 0
+		return eof
+	}
+	r, l.width =
+		utf8.DecodeRuneInString(l.input[l.pos:])
+	l.pos += l.width
+	return r
+}
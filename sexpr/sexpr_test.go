@@ -0,0 +1,48 @@
+package sexpr
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseOneForm(t *testing.T) {
+	tests := []struct {
+		input string
+		err   error
+		token string // of the error
+	}{
+		{"(a b)", nil, ""},
+		{"  (a b) ; done\n", nil, ""},
+		{"a #| c |#", nil, ""},
+		{"(a) (b)", ErrTrailingInput, "("},
+		{"(a) b", ErrTrailingInput, "b"},
+		{"a 'b", ErrTrailingInput, "'"},
+		{"", ErrUnexpectedEOF, ""},
+		{" ; nothing\n", ErrUnexpectedEOF, ""},
+		{"(a", ErrUnexpectedEOF, ""},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q) = %v, want %v", tt.input, err, tt.err)
+			continue
+		}
+		var se *SyntaxError
+		if tt.err == ErrTrailingInput && (!errors.As(err, &se) || se.Token != tt.token) {
+			t.Errorf("Parse(%q): error token %q, want %q", tt.input, se.Token, tt.token)
+		}
+	}
+}
+
+func TestParseAll(t *testing.T) {
+	forms, err := ParseAll("(a) b ; c\n'd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(forms) != 3 || forms[0].Next() != forms[1] || forms[2].Text() != "(quote d)" {
+		t.Errorf("ParseAll gave %v", forms)
+	}
+	if forms, err := ParseAll(" ; only a comment\n"); err != nil || len(forms) != 0 {
+		t.Errorf("ParseAll of no forms gave %v, %v", forms, err)
+	}
+}
@@ -0,0 +1,229 @@
+package sexpr
+
+import "fmt"
+
+// ScanForms is a bufio.SplitFunc that splits its input into top-level
+// forms, so a bufio.Scanner can step through a file of any size one form
+// at a time without parsing it or holding more than a form in memory:
+//
+//	sc := bufio.NewScanner(f)
+//	sc.Buffer(nil, maxFormSize)
+//	sc.Split(sexpr.ScanForms)
+//	for sc.Scan() {
+//		form := sc.Bytes()
+//		...
+//	}
+//
+// each token is the text of one form, from its first character to its
+// last, without the whitespace or comments around it (comments inside a
+// form are kept).  the forms are only split, not checked, beyond needing
+// balanced parens and terminated strings and comments; the scanner stops
+// with an error wrapping ErrUnexpectedParen, ErrUnexpectedEOF,
+// ErrUnterminatedString or ErrUnterminatedComment otherwise.  errors
+// can't know their offset in the whole stream, so callers that want one
+// should count the bytes of the tokens themselves.
+func ScanForms(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	start := 0
+	for {
+		for start < len(data) && isSpace(data[start]) {
+			start++
+		}
+		n, err := skipComment(data[start:], atEOF)
+		if err != nil {
+			return 0, nil, err
+		}
+		if n < 0 {
+			// need more data to find the end of the comment
+			return start, nil, nil
+		}
+		if n == 0 {
+			break
+		}
+		start += n
+	}
+	if start == len(data) {
+		return start, nil, nil
+	}
+	// quote shorthand belongs to the form after it, with any space or
+	// comments in between
+	body := start
+	for body < len(data) {
+		switch c := data[body]; {
+		case c == '\'' || c == '`' || c == ',':
+			body++
+			if c == ',' && body < len(data) && data[body] == '@' {
+				body++
+			}
+			continue
+		case body > start && isSpace(c):
+			body++
+			continue
+		}
+		n, err := skipComment(data[body:], atEOF)
+		if err != nil {
+			return 0, nil, err
+		}
+		if n < 0 {
+			return start, nil, nil
+		}
+		if n == 0 {
+			break
+		}
+		body += n
+	}
+	if body == len(data) {
+		if !atEOF {
+			return start, nil, nil
+		}
+		if body > start {
+			return 0, nil, fmt.Errorf("sexpr: splitting forms: %w", ErrNothingQuoted)
+		}
+	}
+	depth := 0
+	inString := false
+	atStart := true // at the start of a token, where the lexer would be
+	for i := body; i < len(data); i++ {
+		c := data[i]
+		if inString {
+			if c == '\\' {
+				// whatever follows is escaped, a quote included
+				i++
+				continue
+			}
+			if c == '"' {
+				inString = false
+				atStart = true
+				if depth == 0 {
+					return i + 1, data[start : i+1], nil
+				}
+			}
+			continue
+		}
+		tokStart := atStart
+		atStart = isDelim(c)
+		// #\ at the start of a token is a character literal, and the
+		// character after the backslash is never a delimiter
+		if c == '#' && tokStart && i+1 < len(data) && data[i+1] == '\\' {
+			i += 2
+			continue
+		}
+		// so is a quote prefix, and what follows it starts a token too
+		if tokStart && (c == '\'' || c == '`' || c == ',') {
+			if c == ',' && i+1 < len(data) && data[i+1] == '@' {
+				i++
+			}
+			atStart = true
+			continue
+		}
+		// a comment ends a bare atom, as in the lexer; #| only starts
+		// one at the start of a token
+		if c == ';' || c == '#' && tokStart {
+			if depth == 0 && i > body && c == ';' {
+				return i, data[start:i], nil
+			}
+			n, err := skipComment(data[i:], atEOF)
+			if err != nil {
+				return 0, nil, err
+			}
+			if n < 0 {
+				return start, nil, nil
+			}
+			if n > 0 {
+				i += n - 1
+				atStart = true
+				continue
+			}
+		}
+		switch {
+		case c == '"' || c == '(':
+			// a quote or paren ends a bare atom, as in the lexer
+			if depth == 0 && i > body {
+				return i, data[start:i], nil
+			}
+			if c == '"' {
+				inString = true
+			} else {
+				depth++
+			}
+		case c == ')':
+			if depth == 0 {
+				if i > body {
+					return i, data[start:i], nil
+				}
+				return 0, nil, fmt.Errorf("sexpr: splitting forms: %w", ErrUnexpectedParen)
+			}
+			depth--
+			if depth == 0 {
+				return i + 1, data[start : i+1], nil
+			}
+		case depth == 0 && isSpace(c):
+			return i, data[start:i], nil
+		}
+	}
+	if !atEOF {
+		// need more data to find the end of the form
+		return start, nil, nil
+	}
+	switch {
+	case inString:
+		return 0, nil, fmt.Errorf("sexpr: splitting forms: %w", ErrUnterminatedString)
+	case depth > 0:
+		return 0, nil, fmt.Errorf("sexpr: splitting forms: %w", ErrUnexpectedEOF)
+	}
+	return len(data), data[start:], nil
+}
+
+// the length of the comment data starts with, 0 if it doesn't start
+// with one, or -1 if more data is needed to tell or to find its end
+func skipComment(data []byte, atEOF bool) (int, error) {
+	switch {
+	case len(data) == 0:
+		return 0, nil
+	case data[0] == ';':
+		for i, c := range data {
+			if c == '\n' {
+				return i, nil
+			}
+		}
+		if atEOF {
+			return len(data), nil
+		}
+		return -1, nil
+	case data[0] != '#':
+		return 0, nil
+	case len(data) == 1:
+		if atEOF {
+			return 0, nil
+		}
+		return -1, nil
+	case data[1] != '|':
+		return 0, nil
+	}
+	nest := 1
+	for i := 2; i+1 < len(data); i++ {
+		switch {
+		case data[i] == '|' && data[i+1] == '#':
+			i++
+			if nest--; nest == 0 {
+				return i + 1, nil
+			}
+		case data[i] == '#' && data[i+1] == '|':
+			i++
+			nest++
+		}
+	}
+	if atEOF {
+		return 0, fmt.Errorf("sexpr: splitting forms: %w", ErrUnterminatedComment)
+	}
+	return -1, nil
+}
+
+// the whitespace the lexer skips between elements
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// characters that end a bare atom
+func isDelim(c byte) bool {
+	return isSpace(c) || c == '(' || c == ')' || c == '"'
+}
@@ -0,0 +1,92 @@
+package sexpr
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+// split input with ScanForms, returning the tokens
+func scanAll(t *testing.T, input string) []string {
+	t.Helper()
+	sc := bufio.NewScanner(strings.NewReader(input))
+	sc.Split(ScanForms)
+	var toks []string
+	for sc.Scan() {
+		toks = append(toks, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("ScanForms(%q): %v", input, err)
+	}
+	return toks
+}
+
+func TestScanForms(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"a b c", []string{"a", "b", "c"}},
+		{"(a b) ; c\n(d)", []string{"(a b)", "(d)"}},
+		{"'(a) `b ,@c", []string{"'(a)", "`b", ",@c"}},
+		{`"x;y" #\; #\(`, []string{`"x;y"`, `#\;`, `#\(`}},
+		{`(a '#\; b)`, []string{`(a '#\; b)`}},
+		{"(a `#\\) ,@#\\\" b)", []string{"(a `#\\) ,@#\\\" b)"}},
+		{`'#\;`, []string{`'#\;`}},
+		{`(a'#\b) c`, []string{`(a'#\b)`, "c"}},
+		{"(a #| x |# #\\; b)", []string{"(a #| x |# #\\; b)"}},
+	}
+	for _, tt := range tests {
+		got := scanAll(t, tt.input)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("ScanForms(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+// each token ScanForms gives parses to the form Parse finds there
+func TestScanFormsMatchesParse(t *testing.T) {
+	inputs := []string{
+		`(a '#\; b) c`,
+		"(x ,#\\; ,@#\\| `#\\\") ; done\n",
+		`#t "s;" 'q`,
+		"(a . #\\;)",
+	}
+	for _, input := range inputs {
+		want, err := ParseAll(input)
+		if err != nil {
+			t.Fatalf("ParseAll(%q): %v", input, err)
+		}
+		var forms []*Sexpr
+		for _, tok := range scanAll(t, input) {
+			f, err := Parse(tok)
+			if err != nil {
+				t.Fatalf("token %q of %q: %v", tok, input, err)
+			}
+			forms = append(forms, f)
+		}
+		if !EqualForms(NewForms(want...), NewForms(forms...)) {
+			t.Errorf("ScanForms(%q) gives %q", input, scanAll(t, input))
+		}
+	}
+}
+
+func TestDecoderCharAfterQuote(t *testing.T) {
+	d := NewDecoder(strings.NewReader(`(a '#\; b) (c)`))
+	var got []*Sexpr
+	for {
+		var s *Sexpr
+		err := d.Decode(&s)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, s)
+	}
+	if len(got) != 2 || got[0].Text() != `(a (quote #\;) b)` {
+		t.Errorf("decoded %v", got)
+	}
+}
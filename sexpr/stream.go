@@ -0,0 +1,125 @@
+package sexpr
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"unicode/utf8"
+
+	"github.com/mjsottile/gocode/diag"
+)
+
+// An Encoder writes values to a stream of forms, one form per value, as
+// encoding/json's Encoder does for JSON:
+//
+//	enc := sexpr.NewEncoder(w)
+//	for _, rec := range records {
+//		if err := enc.Encode(rec); err != nil {
+//			...
+//		}
+//	}
+//
+// a value is written as Marshal writes an element of a list, so a
+// struct or map is a list of its entries, ((host "example.org") (port
+// 8080)), and a Decoder or Unmarshal reads it back.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns an Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes v to the stream as one form, laid out by Format,
+// followed by a newline.
+func (enc *Encoder) Encode(v any) error {
+	e, err := marshalElem(v)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(enc.w, Format(e, FormatOptions{})+"\n")
+	return err
+}
+
+// A Decoder reads values from a stream of forms, one form per value.
+// it splits the stream with ScanForms, so only the form being decoded
+// is held in memory however long the stream is.
+type Decoder struct {
+	sc  *bufio.Scanner
+	pos diag.Position // of the first byte not yet split off
+	at  diag.Position // of the form being decoded
+}
+
+// NewDecoder returns a Decoder reading from r.  it may read from r
+// beyond the forms it has decoded.
+func NewDecoder(r io.Reader) *Decoder {
+	d := &Decoder{pos: diag.Position{Line: 1, Column: 1}}
+	d.sc = bufio.NewScanner(r)
+	d.sc.Buffer(nil, math.MaxInt)
+	d.sc.Split(d.split)
+	return d
+}
+
+// ScanForms, keeping track of where in the stream the forms are
+func (d *Decoder) split(data []byte, atEOF bool) (int, []byte, error) {
+	advance, token, err := ScanForms(data, atEOF)
+	if err != nil {
+		return 0, nil, &diag.SourceError{Pos: d.pos, Err: err}
+	}
+	if token != nil {
+		// ScanForms always stops right after the form
+		skip := advance - len(token)
+		d.move(data[:skip])
+		d.at = d.pos
+		d.move(token)
+	} else {
+		d.move(data[:advance])
+	}
+	return advance, token, nil
+}
+
+// move d.pos past b
+func (d *Decoder) move(b []byte) {
+	d.pos.Offset += len(b)
+	for len(b) > 0 {
+		r, n := utf8.DecodeRune(b)
+		b = b[n:]
+		if r == '\n' {
+			d.pos.Line++
+			d.pos.Column = 1
+		} else {
+			d.pos.Column++
+		}
+	}
+}
+
+// Decode reads the next form from the stream and stores it in the value
+// v points to, as Unmarshal does for a single form.  at the end of the
+// stream it returns io.EOF.  errors in the stream are *diag.SourceErrors
+// with positions in the whole stream; an error reading from it is
+// returned as it is.
+func (d *Decoder) Decode(v any) error {
+	if !d.sc.Scan() {
+		if err := d.sc.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	input := d.sc.Text()
+	forms, err := Parse(input)
+	if err == nil {
+		err = unmarshalForms(forms, input, v)
+	}
+	var se *diag.SourceError
+	if errors.As(err, &se) && se.Pos.IsValid() {
+		// positions in the form to positions in the stream
+		if se.Pos.Line == 1 {
+			se.Pos.Column += d.at.Column - 1
+		}
+		se.Pos.Line += d.at.Line - 1
+		se.Pos.Offset += d.at.Offset
+	}
+	return err
+}
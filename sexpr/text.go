@@ -0,0 +1,61 @@
+package sexpr
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Text returns s (not the elements following it) in s-expression
+// syntax: each atom as its text, lists in parens with their elements
+// separated by single spaces, and a dotted list's tail after " . ".  for trees that came from parsing, parsing
+// the result gives back an Equal element; atoms built with NewAtom are
+// written as given, so they have to be valid atom text for that to
+// hold.
+func (s *Sexpr) Text() string {
+	var b strings.Builder
+	s.writeText(&b)
+	return b.String()
+}
+
+// WriteTo writes s as Text does to w, implementing io.WriterTo.
+func (s *Sexpr) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	n := s.writeText(bw)
+	if err := bw.Flush(); err != nil {
+		return n - int64(bw.Buffered()), err
+	}
+	return n, nil
+}
+
+// what writeText needs; strings.Builder and bufio.Writer are both one
+type textWriter interface {
+	io.ByteWriter
+	io.StringWriter
+}
+
+// write s to w, returning the number of bytes written
+func (s *Sexpr) writeText(w textWriter) int64 {
+	if s == nil {
+		return 0
+	}
+	if s.sty == sexprAtom {
+		w.WriteString(s.val)
+		return int64(len(s.val))
+	}
+	n := int64(2)
+	w.WriteByte('(')
+	for cur := s.list; cur != nil; cur = cur.next {
+		n += cur.writeText(w)
+		if cur.next != nil {
+			w.WriteByte(' ')
+			n++
+		}
+	}
+	if s.tail != nil {
+		w.WriteString(" . ")
+		n += 3 + s.tail.writeText(w)
+	}
+	w.WriteByte(')')
+	return n
+}
@@ -0,0 +1,231 @@
+package sexpr
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/mjsottile/gocode/diag"
+)
+
+/*
+   XML
+
+   ToXML and FromXML bridge to XML: a list is an element named by its
+   head, keyword pairs in it are the element's attributes, and its other
+   elements are its content, atoms as text and lists as child elements:
+
+	(p :class "note" "see " (a :href "x.html" "here"))
+	<p class="note">see <a href="x.html">here</a></p>
+*/
+
+// ErrXML is wrapped by the errors ToXML returns for elements that can't
+// be written as XML, and by those FromXML returns for input that isn't
+// well-formed XML.
+var ErrXML = errors.New("sexpr: cannot convert XML")
+
+// ToXML writes s and every element following it as XML elements, one
+// per top-level form; a well-formed document has exactly one.  a list
+// (name ...) becomes <name ...>, and must be headed by an atom that is a
+// valid XML name.  a keyword followed by an atom, anywhere in the list,
+// is an attribute of the element, :href "x.html" giving href="x.html";
+// the rest of the list is the element's content in order, lists as
+// child elements and atoms as text, separated by a space from the atom
+// before them.  strings give their contents, other atoms their text.
+func ToXML(s *Sexpr) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	for cur := s; cur != nil; cur = cur.next {
+		if err := cur.writeXML(enc); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrXML, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *Sexpr) writeXML(enc *xml.Encoder) error {
+	kids := s.Children()
+	switch {
+	case s.IsAtom():
+		return diag.Errorf(s.Position(), ErrXML, "atom %s outside an element", s.val)
+	case s.tail != nil:
+		return diag.Errorf(s.Position(), ErrXML, "dotted list can't be an element")
+	case len(kids) == 0 || !kids[0].IsAtom() || kids[0].aty == String || !isXMLName(kids[0].val):
+		return diag.Errorf(s.Position(), ErrXML, "list isn't headed by an element name")
+	}
+	start := xml.StartElement{Name: xml.Name{Local: kids[0].val}}
+	var content []*Sexpr
+	seen := make(map[string]bool)
+	for i := 1; i < len(kids); i++ {
+		k := kids[i]
+		if !k.IsKeyword() {
+			content = append(content, k)
+			continue
+		}
+		name := k.val[1:]
+		switch {
+		case i+1 == len(kids) || !kids[i+1].IsAtom():
+			return diag.Errorf(k.Position(), ErrXML, "attribute %s needs an atom for its value", k.val)
+		case !isXMLName(name):
+			return diag.Errorf(k.Position(), ErrXML, "%s isn't an XML attribute name", name)
+		case seen[name]:
+			return diag.Errorf(k.Position(), ErrXML, "attribute %s given twice", name)
+		}
+		seen[name] = true
+		value, err := kids[i+1].xmlText()
+		if err != nil {
+			return err
+		}
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+		i++
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return s.xmlError(err)
+	}
+	for i, c := range content {
+		if c.IsList() {
+			if err := c.writeXML(enc); err != nil {
+				return err
+			}
+			continue
+		}
+		text, err := c.xmlText()
+		if err != nil {
+			return err
+		}
+		if i > 0 && content[i-1].IsAtom() {
+			text = " " + text
+		}
+		if err := enc.EncodeToken(xml.CharData(text)); err != nil {
+			return c.xmlError(err)
+		}
+	}
+	if err := enc.EncodeToken(start.End()); err != nil {
+		return s.xmlError(err)
+	}
+	return nil
+}
+
+// err, from writing s, as an error wrapping ErrXML at s
+func (s *Sexpr) xmlError(err error) error {
+	return &diag.SourceError{Pos: s.Position(), Err: fmt.Errorf("%w: %w", ErrXML, err)}
+}
+
+// the text an atom stands for in XML: a string's contents, or the text
+// of anything else
+func (s *Sexpr) xmlText() (string, error) {
+	if s.aty != String {
+		return s.val, nil
+	}
+	text, err := s.Str()
+	if err != nil {
+		return "", s.xmlError(err)
+	}
+	return text, nil
+}
+
+// true if name is an XML name, prefix and all
+func isXMLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r) || r == '_' || r == ':':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.' || unicode.In(r, unicode.Mn, unicode.Mc)):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// FromXML reads XML and returns its top-level elements as forms, the
+// way ToXML would write them: <name a="1">text<b/></name> gives
+// (name :a "1" "text" (b)).  names keep their namespace prefixes as
+// written, attribute values and text become strings, and text that is
+// only whitespace is dropped.  comments, processing instructions and
+// the doctype are skipped.  errors are *diag.SourceErrors wrapping
+// ErrXML.
+func FromXML(data []byte) (*Sexpr, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	fail := func(format string, args ...any) error {
+		pos := diag.PositionFor("", string(data), int(dec.InputOffset()))
+		return diag.Errorf(pos, ErrXML, format, args...)
+	}
+	var (
+		top   []*Sexpr
+		open  [][]*Sexpr // the elements of the lists being built
+		names []string
+		text  strings.Builder // text not yet added to its element
+	)
+	flush := func() {
+		if len(open) > 0 && strings.TrimSpace(text.String()) != "" {
+			open[len(open)-1] = append(open[len(open)-1], NewString(text.String()))
+		}
+		text.Reset()
+	}
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var se *xml.SyntaxError
+			if errors.As(err, &se) {
+				return nil, fail("%s", se.Msg)
+			}
+			return nil, fail("%v", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			flush()
+			name := xmlName(t.Name)
+			elems := []*Sexpr{NewAtom(name)}
+			for _, a := range t.Attr {
+				elems = append(elems, NewAtom(":"+xmlName(a.Name)), NewString(a.Value))
+			}
+			open = append(open, elems)
+			names = append(names, name)
+		case xml.EndElement:
+			if len(open) == 0 {
+				return nil, fail("unexpected </%s>", xmlName(t.Name))
+			}
+			if name := xmlName(t.Name); name != names[len(names)-1] {
+				return nil, fail("</%s> closes <%s>", name, names[len(names)-1])
+			}
+			flush()
+			el := NewList(open[len(open)-1]...)
+			open, names = open[:len(open)-1], names[:len(names)-1]
+			if len(open) == 0 {
+				top = append(top, el)
+			} else {
+				open[len(open)-1] = append(open[len(open)-1], el)
+			}
+		case xml.CharData:
+			if len(open) == 0 && len(bytes.TrimSpace(t)) > 0 {
+				return nil, fail("text outside an element")
+			}
+			text.Write(t)
+		}
+	}
+	if len(open) > 0 {
+		return nil, fail("<%s> not closed", names[len(names)-1])
+	}
+	return NewForms(top...), nil
+}
+
+// a name as written, with its prefix
+func xmlName(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return fmt.Sprintf("%s:%s", n.Space, n.Local)
+}
@@ -0,0 +1,132 @@
+package sexpr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mjsottile/gocode/diag"
+)
+
+func TestToXML(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`(p :class "note" "see " (a :href "x.html" "here"))`,
+			`<p class="note">see <a href="x.html">here</a></p>`},
+		{`(br)`, `<br></br>`},
+		{`(p one two 3)`, `<p>one two 3</p>`},
+		{`(p "a<b & c")`, `<p>a&lt;b &amp; c</p>`},
+		{`(p (b x) y)`, `<p><b>x</b>y</p>`},
+		{`(svg:rect :xml:lang en :w 2 "t" :h 1)`, `<svg:rect xml:lang="en" w="2" h="1">t</svg:rect>`},
+		{`(a) (b)`, `<a></a><b></b>`},
+	}
+	for _, tt := range tests {
+		forms, err := ParseAll(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ToXML(NewForms(forms...))
+		if err != nil {
+			t.Errorf("ToXML(%s): %v", tt.in, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("ToXML(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFromXML(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`<name a="1">text<b/></name>`, `(name :a "1" "text" (b))` + "\n"},
+		{"<?xml version=\"1.0\"?>\n<!DOCTYPE a>\n<a>\n  <!-- c -->\n  <b/>\n</a>", `(a (b))` + "\n"},
+		{`<x:a x:y="z">t &amp; u</x:a>`, `(x:a :x:y "z" "t & u")` + "\n"},
+		{`<a/><b/>`, "(a)\n(b)\n"},
+	}
+	for _, tt := range tests {
+		got, err := FromXML([]byte(tt.in))
+		if err != nil {
+			t.Errorf("FromXML(%s): %v", tt.in, err)
+			continue
+		}
+		if docText(got) != tt.want {
+			t.Errorf("FromXML(%s) = %s, want %s", tt.in, docText(got), tt.want)
+		}
+	}
+}
+
+// XML that FromXML reads is written back as it was
+func TestXMLRoundTrip(t *testing.T) {
+	for _, in := range []string{
+		`<p class="note">see <a href="x.html">here</a> and <b>there</b>.</p>`,
+		`<doc><item n="1">one</item><item n="2"></item></doc>`,
+		`<a>x &lt; y</a>`,
+	} {
+		forms, err := FromXML([]byte(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ToXML(forms)
+		if err != nil {
+			t.Errorf("ToXML(%s): %v", docText(forms), err)
+			continue
+		}
+		if string(out) != in {
+			t.Errorf("%s became %s and then %s", in, docText(forms), out)
+		}
+	}
+}
+
+func TestXMLErrors(t *testing.T) {
+	toXML := []struct {
+		in   *Sexpr
+		line int
+	}{
+		{mustParse(t, `a`), 1},
+		{mustParse(t, "(a\n (b . c))"), 2},
+		{mustParse(t, `("a" x)`), 1},
+		{mustParse(t, `(1a)`), 1},
+		{mustParse(t, "(a\n :href)"), 2},
+		{mustParse(t, `(a :b (c))`), 1},
+		{mustParse(t, `(a :b 1 :b 2)`), 1},
+		{mustParse(t, `(a :1b 1)`), 1},
+		{NewList(NewAtom("p"), NewAtom(`"\q"`)), 0},
+		{NewList(NewAtom("p"), NewAtom(":id"), NewAtom(`"\q"`)), 0},
+	}
+	for _, tt := range toXML {
+		_, err := ToXML(tt.in)
+		if !errors.Is(err, ErrXML) {
+			t.Errorf("ToXML(%s) = %v, not an ErrXML", docText(tt.in), err)
+			continue
+		}
+		var se *diag.SourceError
+		if tt.line > 0 && (!errors.As(err, &se) || se.Pos.Line != tt.line) {
+			t.Errorf("ToXML(%s) = %v, want an error on line %d", docText(tt.in), err, tt.line)
+		}
+	}
+
+	fromXML := []struct {
+		in   string
+		line int
+	}{
+		{"<a>\n<b></a>", 2},
+		{"<a></b>", 1},
+		{"</a>", 1},
+		{"text", 1},
+		{"<a>\n<b>\n", 3},
+		{"<a x=1>", 1},
+	}
+	for _, tt := range fromXML {
+		_, err := FromXML([]byte(tt.in))
+		var se *diag.SourceError
+		if !errors.Is(err, ErrXML) || !errors.As(err, &se) {
+			t.Errorf("FromXML(%q) = %v, not a positioned ErrXML", tt.in, err)
+			continue
+		}
+		if se.Pos.Line != tt.line {
+			t.Errorf("FromXML(%q) = %v, want an error on line %d", tt.in, err, tt.line)
+		}
+	}
+}
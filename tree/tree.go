@@ -0,0 +1,102 @@
+/*
+Package tree holds traversal code shared by the tree-shaped data
+structures in this repository.  anything that can list its children
+(see Node) gets walking, folding, size and depth computations, and an
+adapter to the viz package for free.
+*/
+package tree
+
+import (
+	"fmt"
+
+	"github.com/mjsottile/gocode/viz"
+)
+
+// Node is implemented by tree elements of type T that can enumerate
+// their immediate children.  leaves return an empty slice.
+type Node[T any] interface {
+	Children() []T
+}
+
+// Walk visits root and its descendants in pre-order, passing each node
+// along with its depth (the root is at depth 0).  if visit returns false
+// the children of that node are skipped.
+func Walk[T Node[T]](root T, visit func(n T, depth int) bool) {
+	walk(root, 0, visit)
+}
+
+func walk[T Node[T]](n T, depth int, visit func(T, int) bool) {
+	if !visit(n, depth) {
+		return
+	}
+	for _, c := range n.Children() {
+		walk(c, depth+1, visit)
+	}
+}
+
+// Fold reduces the tree bottom-up: f is called for each node with the
+// already-folded values of its children, in order.
+func Fold[T Node[T], A any](root T, f func(n T, children []A) A) A {
+	kids := root.Children()
+	vals := make([]A, len(kids))
+	for i, c := range kids {
+		vals[i] = Fold(c, f)
+	}
+	return f(root, vals)
+}
+
+// Size counts the nodes in the tree rooted at root.
+func Size[T Node[T]](root T) int {
+	return Fold(root, func(_ T, kids []int) int {
+		n := 1
+		for _, k := range kids {
+			n += k
+		}
+		return n
+	})
+}
+
+// Depth is the number of nodes on the longest path from root to a leaf,
+// so a lone leaf has depth 1.
+func Depth[T Node[T]](root T) int {
+	return Fold(root, func(_ T, kids []int) int {
+		d := 0
+		for _, k := range kids {
+			if k > d {
+				d = k
+			}
+		}
+		return d + 1
+	})
+}
+
+// Leaves returns the nodes without children, left to right.
+func Leaves[T Node[T]](root T) []T {
+	var out []T
+	Walk(root, func(n T, _ int) bool {
+		if len(n.Children()) == 0 {
+			out = append(out, n)
+		}
+		return true
+	})
+	return out
+}
+
+// ToGraph builds a viz graph with one node per tree node, labeled by
+// label, and an edge from each parent to each of its children.
+func ToGraph[T Node[T]](root T, label func(T) string) viz.Graph {
+	g := &viz.Digraph{}
+	id := 0
+	var build func(n T) string
+	build = func(n T) string {
+		id++
+		name := fmt.Sprintf("n%d", id)
+		g.AddNode(name, label(n))
+		for _, c := range n.Children() {
+			g.AddEdge(name, build(c), "")
+		}
+		return name
+	}
+	build(root)
+	return g
+}
@@ -0,0 +1,121 @@
+package tree
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+type node struct {
+	name string
+	kids []*node
+}
+
+func (n *node) Children() []*node { return n.kids }
+
+func n(name string, kids ...*node) *node { return &node{name, kids} }
+
+// a
+// ├── b
+// │   ├── d
+// │   └── e
+// │       └── g
+// └── c
+//
+//	└── f
+var sample = n("a", n("b", n("d"), n("e", n("g"))), n("c", n("f")))
+
+func TestWalk(t *testing.T) {
+	var order []string
+	Walk(sample, func(x *node, depth int) bool {
+		order = append(order, fmt.Sprint(x.name, depth))
+		return true
+	})
+	if got := strings.Join(order, " "); got != "a0 b1 d2 e2 g3 c1 f2" {
+		t.Errorf("Walk visited %s", got)
+	}
+
+	// skipping b's children
+	order = nil
+	Walk(sample, func(x *node, _ int) bool {
+		order = append(order, x.name)
+		return x.name != "b"
+	})
+	if got := strings.Join(order, " "); got != "a b c f" {
+		t.Errorf("Walk pruning b visited %s", got)
+	}
+}
+
+func TestFold(t *testing.T) {
+	// the tree written as an s-expression, children before parents
+	got := Fold(sample, func(x *node, kids []string) string {
+		if len(kids) == 0 {
+			return x.name
+		}
+		return "(" + x.name + " " + strings.Join(kids, " ") + ")"
+	})
+	if got != "(a (b d (e g)) (c f))" {
+		t.Errorf("Fold gave %s", got)
+	}
+}
+
+func TestMeasures(t *testing.T) {
+	tests := []struct {
+		root        *node
+		size, depth int
+		leaves      string
+	}{
+		{sample, 7, 4, "d g f"},
+		{n("x"), 1, 1, "x"},
+		{n("x", n("y"), n("z")), 3, 2, "y z"},
+	}
+	for _, tt := range tests {
+		var leaves []string
+		for _, l := range Leaves(tt.root) {
+			leaves = append(leaves, l.name)
+		}
+		if s, d, l := Size(tt.root), Depth(tt.root), strings.Join(leaves, " "); s != tt.size || d != tt.depth || l != tt.leaves {
+			t.Errorf("%s: size %d, depth %d, leaves %s; want %d, %d, %s", tt.root.name, s, d, l, tt.size, tt.depth, tt.leaves)
+		}
+	}
+}
+
+func TestToGraph(t *testing.T) {
+	g := ToGraph(sample, func(x *node) string { return x.name })
+	labels := make(map[string]string)
+	for _, v := range g.Nodes() {
+		labels[v.ID] = v.Label
+	}
+	var edges []string
+	for _, e := range g.Edges() {
+		edges = append(edges, labels[e.From]+"->"+labels[e.To])
+	}
+	if len(labels) != 7 || len(g.Nodes()) != 7 {
+		t.Errorf("ToGraph made nodes %v", g.Nodes())
+	}
+	sort.Strings(edges)
+	if got := strings.Join(edges, " "); got != "a->b a->c b->d b->e c->f e->g" {
+		t.Errorf("ToGraph made edges %s", got)
+	}
+
+	// a node reached twice is drawn twice
+	leaf := n("leaf")
+	g = ToGraph(n("r", leaf, leaf), func(x *node) string { return x.name })
+	if len(g.Nodes()) != 3 {
+		t.Errorf("ToGraph of a shared leaf made %d nodes", len(g.Nodes()))
+	}
+}
+
+// s-expressions are trees, their atoms the leaves
+func TestSexpr(t *testing.T) {
+	s, err := sexpr.Parse("(define (sq x) (* x x))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Size(s) != 9 || Depth(s) != 3 || len(Leaves(s)) != 6 {
+		t.Errorf("%s has size %d, depth %d and %d leaves", s.Text(), Size(s), Depth(s), len(Leaves(s)))
+	}
+}
@@ -0,0 +1,182 @@
+/*
+Package viz writes simple directed graphs out in formats that external
+tools can render: graphviz dot, mermaid and GraphML.
+
+Anything that can describe itself as a list of labeled nodes and
+directed edges between them (see Graph) can be handed to any of the
+writers, so the individual data structures in this repository only
+need to know how to enumerate themselves.
+*/
+package viz
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// a node in a graph.  IDs must be unique within a graph; labels are
+// free-form text and are escaped as needed by each writer.
+type Node struct {
+	ID    string
+	Label string
+}
+
+// a directed edge between two node IDs, with an optional label
+type Edge struct {
+	From  string
+	To    string
+	Label string
+}
+
+// Graph is the interface the writers consume.
+type Graph interface {
+	Nodes() []Node
+	Edges() []Edge
+}
+
+// Digraph is a plain slice-backed Graph for callers that want to build
+// a graph up incrementally rather than implement the interface.
+type Digraph struct {
+	NodeList []Node
+	EdgeList []Edge
+}
+
+// add a node to the graph
+func (g *Digraph) AddNode(id, label string) {
+	g.NodeList = append(g.NodeList, Node{ID: id, Label: label})
+}
+
+// add an edge to the graph
+func (g *Digraph) AddEdge(from, to, label string) {
+	g.EdgeList = append(g.EdgeList, Edge{From: from, To: to, Label: label})
+}
+
+func (g *Digraph) Nodes() []Node { return g.NodeList }
+func (g *Digraph) Edges() []Edge { return g.EdgeList }
+
+// WriteDOT writes g as a graphviz digraph with the given name.
+func WriteDOT(w io.Writer, name string, g Graph) error {
+	ew := &errWriter{w: w}
+	ew.printf("digraph %s {\n", dotID(name))
+	for _, n := range g.Nodes() {
+		ew.printf("  %s [label=%s];\n", dotID(n.ID), dotString(n.Label))
+	}
+	for _, e := range g.Edges() {
+		if e.Label != "" {
+			ew.printf("  %s -> %s [label=%s];\n",
+				dotID(e.From), dotID(e.To), dotString(e.Label))
+		} else {
+			ew.printf("  %s -> %s;\n", dotID(e.From), dotID(e.To))
+		}
+	}
+	ew.printf("}\n")
+	return ew.err
+}
+
+// WriteMermaid writes g as a mermaid flowchart.
+func WriteMermaid(w io.Writer, g Graph) error {
+	ew := &errWriter{w: w}
+	ew.printf("flowchart TD\n")
+	for _, n := range g.Nodes() {
+		ew.printf("  %s[\"%s\"]\n", mermaidID(n.ID), mermaidString(n.Label))
+	}
+	for _, e := range g.Edges() {
+		if e.Label != "" {
+			ew.printf("  %s -->|\"%s\"| %s\n",
+				mermaidID(e.From), mermaidString(e.Label), mermaidID(e.To))
+		} else {
+			ew.printf("  %s --> %s\n", mermaidID(e.From), mermaidID(e.To))
+		}
+	}
+	return ew.err
+}
+
+// WriteGraphML writes g as a GraphML document.  node and edge labels are
+// stored in a "label" data key.
+func WriteGraphML(w io.Writer, g Graph) error {
+	ew := &errWriter{w: w}
+	ew.printf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	ew.printf("<graphml xmlns=\"http://graphml.graphdrawing.org/xmlns\">\n")
+	ew.printf("  <key id=\"label\" for=\"all\" attr.name=\"label\" attr.type=\"string\"/>\n")
+	ew.printf("  <graph edgedefault=\"directed\">\n")
+	for _, n := range g.Nodes() {
+		ew.printf("    <node id=\"%s\"><data key=\"label\">%s</data></node>\n",
+			xmlString(n.ID), xmlString(n.Label))
+	}
+	for i, e := range g.Edges() {
+		ew.printf("    <edge id=\"e%d\" source=\"%s\" target=\"%s\">", i,
+			xmlString(e.From), xmlString(e.To))
+		if e.Label != "" {
+			ew.printf("<data key=\"label\">%s</data>", xmlString(e.Label))
+		}
+		ew.printf("</edge>\n")
+	}
+	ew.printf("  </graph>\n")
+	ew.printf("</graphml>\n")
+	return ew.err
+}
+
+// writer that remembers the first error so the writers above don't need
+// to check every single Fprintf
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err != nil {
+		return
+	}
+	_, ew.err = fmt.Fprintf(ew.w, format, args...)
+}
+
+// quote a dot identifier unless it is a plain alphanumeric name
+func dotID(s string) string {
+	for i, r := range s {
+		if !(r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(i > 0 && r >= '0' && r <= '9')) {
+			return dotString(s)
+		}
+	}
+	if s == "" {
+		return `""`
+	}
+	return s
+}
+
+// dot strings are double quoted with backslash escapes for quotes and
+// backslashes; newlines become \n
+func dotString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// mermaid ids are restricted to word characters, so anything else is
+// hex-encoded to keep distinct ids distinct
+func mermaidID(s string) string {
+	var b strings.Builder
+	b.WriteString("n")
+	for _, r := range s {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			fmt.Fprintf(&b, "_%x_", r)
+		}
+	}
+	return b.String()
+}
+
+// mermaid uses entity codes inside quoted labels
+func mermaidString(s string) string {
+	r := strings.NewReplacer(`"`, "#quot;", "\n", "<br/>")
+	return r.Replace(s)
+}
+
+func xmlString(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,133 @@
+package viz
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func sample() *Digraph {
+	g := &Digraph{}
+	g.AddNode("root", "LIST")
+	g.AddNode("n 1", `say "hi"`)
+	g.AddNode("2nd", "a\\b\nc & <d>")
+	g.AddEdge("root", "n 1", "list")
+	g.AddEdge("n 1", "2nd", "")
+	return g
+}
+
+func TestWriteDOT(t *testing.T) {
+	var b strings.Builder
+	if err := WriteDOT(&b, "my graph", sample()); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph "my graph" {
+  root [label="LIST"];
+  "n 1" [label="say \"hi\""];
+  "2nd" [label="a\\b\nc & <d>"];
+  root -> "n 1" [label="list"];
+  "n 1" -> "2nd";
+}
+`
+	if b.String() != want {
+		t.Errorf("WriteDOT wrote\n%s\nwant\n%s", b.String(), want)
+	}
+	for id, want := range map[string]string{"": `""`, "_x9": "_x9", "x-y": `"x-y"`, "λ": `"λ"`} {
+		if got := dotID(id); got != want {
+			t.Errorf("dotID(%q) = %s, want %s", id, got, want)
+		}
+	}
+}
+
+func TestWriteMermaid(t *testing.T) {
+	var b strings.Builder
+	if err := WriteMermaid(&b, sample()); err != nil {
+		t.Fatal(err)
+	}
+	want := `flowchart TD
+  nroot["LIST"]
+  nn_20_1["say #quot;hi#quot;"]
+  n2nd["a\b<br/>c & <d>"]
+  nroot -->|"list"| nn_20_1
+  nn_20_1 --> n2nd
+`
+	if b.String() != want {
+		t.Errorf("WriteMermaid wrote\n%s\nwant\n%s", b.String(), want)
+	}
+	// ids that differ only in characters mermaid can't take stay apart
+	if mermaidID("a-b") == mermaidID("a_b") || mermaidID("a b") == mermaidID("ab") {
+		t.Errorf("distinct ids became the same mermaid id")
+	}
+}
+
+func TestWriteGraphML(t *testing.T) {
+	var b strings.Builder
+	if err := WriteGraphML(&b, sample()); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Graph struct {
+			Nodes []struct {
+				ID    string `xml:"id,attr"`
+				Label string `xml:"data"`
+			} `xml:"node"`
+			Edges []struct {
+				Source string `xml:"source,attr"`
+				Target string `xml:"target,attr"`
+				Label  string `xml:"data"`
+			} `xml:"edge"`
+		} `xml:"graph"`
+	}
+	if err := xml.Unmarshal([]byte(b.String()), &doc); err != nil {
+		t.Fatalf("%v\n%s", err, b.String())
+	}
+	g := sample()
+	if len(doc.Graph.Nodes) != len(g.NodeList) || len(doc.Graph.Edges) != len(g.EdgeList) {
+		t.Fatalf("WriteGraphML wrote\n%s", b.String())
+	}
+	for i, n := range g.NodeList {
+		if got := doc.Graph.Nodes[i]; got.ID != n.ID || got.Label != n.Label {
+			t.Errorf("node %d reads back as %+v, want %+v", i, got, n)
+		}
+	}
+	for i, e := range g.EdgeList {
+		if got := doc.Graph.Edges[i]; got.Source != e.From || got.Target != e.To || got.Label != e.Label {
+			t.Errorf("edge %d reads back as %+v, want %+v", i, got, e)
+		}
+	}
+}
+
+// a writer taking n writes and failing the rest, which it counts
+type failWriter struct{ n, failed int }
+
+var errFull = errors.New("full")
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		w.failed++
+		return 0, errFull
+	}
+	w.n--
+	return len(p), nil
+}
+
+// the writers stop at the first error and return it
+func TestWriteErrors(t *testing.T) {
+	writers := map[string]func(*failWriter) error{
+		"dot":     func(w *failWriter) error { return WriteDOT(w, "g", sample()) },
+		"mermaid": func(w *failWriter) error { return WriteMermaid(w, sample()) },
+		"graphml": func(w *failWriter) error { return WriteGraphML(w, sample()) },
+	}
+	for name, write := range writers {
+		for n := 0; n < 3; n++ {
+			w := &failWriter{n: n}
+			if err := write(w); !errors.Is(err, errFull) {
+				t.Errorf("%s after %d writes = %v, want errFull", name, n, err)
+			}
+			if w.failed != 1 {
+				t.Errorf("%s went on writing after an error", name)
+			}
+		}
+	}
+}
@@ -0,0 +1,1004 @@
+package yamlconv
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mjsottile/gocode/diag"
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+// ErrSyntax is wrapped by the errors Decode returns for input it can't
+// read.  they are *diag.SourceErrors, with the position of the problem.
+var ErrSyntax = errors.New("yamlconv: bad YAML")
+
+// Decode reads the YAML stream data and returns the forms of each of its
+// documents, in the layout described in the package comment.  an empty
+// document has no forms, so its entry is nil.
+func Decode(data []byte) ([]*sexpr.Sexpr, error) {
+	p := &parser{src: string(data)}
+	nodes, err := p.documents()
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]*sexpr.Sexpr, len(nodes))
+	for i, n := range nodes {
+		if docs[i], err = p.document(n); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+/*
+   parsing
+
+   the parser reads the text into a tree of nodes, which are then turned
+   into s-expressions.  aliases are the node their anchor was on, so a
+   node can occur in the tree more than once; it becomes a separate copy
+   each time.
+*/
+
+type nodeKind int
+
+const (
+	scalarNode nodeKind = iota
+	seqNode
+	mapNode
+)
+
+type node struct {
+	kind  nodeKind
+	style byte // of a scalar: 0 for plain, or its quote or block indicator
+	tag   string
+	text  string
+	items []*node // a sequence's items, or a mapping's keys and values in turn
+	pos   int
+}
+
+type parser struct {
+	src     string
+	pos     int
+	anchors map[string]*node
+}
+
+func (p *parser) errorf(pos int, format string, args ...any) error {
+	return diag.Errorf(diag.PositionFor("", p.src, pos), ErrSyntax, format, args...)
+}
+
+// the byte off bytes ahead, or 0 past the end
+func (p *parser) at(off int) byte {
+	if p.pos+off < len(p.src) {
+		return p.src[p.pos+off]
+	}
+	return 0
+}
+
+func (p *parser) peek() byte { return p.at(0) }
+
+// true if c ends a token: space, a line break or the end of the input
+func blank(c byte) bool { return c == 0 || isBreakSpace(c) }
+
+// the column of the current position
+func (p *parser) col() int {
+	return p.pos - (strings.LastIndexByte(p.src[:p.pos], '\n') + 1)
+}
+
+// true at the end of a line or of the input
+func (p *parser) eol() bool {
+	return p.pos >= len(p.src) || p.src[p.pos] == '\n'
+}
+
+// the document marker, --- or ..., the current position is on, if any
+func (p *parser) marker() string {
+	if p.col() != 0 || p.pos+3 > len(p.src) || !blank(p.at(3)) {
+		return ""
+	}
+	switch m := p.src[p.pos : p.pos+3]; m {
+	case "---", "...":
+		return m
+	}
+	return ""
+}
+
+// true at a sequence entry's dash
+func (p *parser) dash() bool { return p.peek() == '-' && blank(p.at(1)) }
+
+// skip spaces and a comment on the current line
+func (p *parser) skipInline() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t' || p.src[p.pos] == '\r') {
+		p.pos++
+	}
+	if p.peek() == '#' && (p.pos == 0 || isBreakSpace(p.src[p.pos-1])) {
+		for !p.eol() {
+			p.pos++
+		}
+	}
+}
+
+// skip blank lines and comments, up to the next content, document
+// marker or the end
+func (p *parser) skipLines() {
+	for {
+		p.skipInline()
+		if p.pos >= len(p.src) || p.src[p.pos] != '\n' {
+			return
+		}
+		p.pos++
+		if p.marker() != "" {
+			return
+		}
+	}
+}
+
+// skip space, line breaks and comments inside a flow collection
+func (p *parser) skipFlow() {
+	for {
+		p.skipInline()
+		if p.pos >= len(p.src) || p.src[p.pos] != '\n' {
+			return
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) documents() ([]*node, error) {
+	var docs []*node
+	for {
+		p.skipLines()
+		for p.col() == 0 && p.peek() == '%' {
+			// a directive, like %YAML 1.2
+			for !p.eol() {
+				p.pos++
+			}
+			p.skipLines()
+		}
+		if p.pos >= len(p.src) {
+			return docs, nil
+		}
+		switch p.marker() {
+		case "---":
+			p.pos += 3
+		case "...":
+			p.pos += 3
+			continue
+		}
+		p.anchors = make(map[string]*node)
+		n, err := p.block(-1, false)
+		if err != nil {
+			return nil, err
+		}
+		p.skipLines()
+		switch {
+		case p.marker() == "...":
+			p.pos += 3
+			p.skipInline()
+			if !p.eol() {
+				return nil, p.errorf(p.pos, "unexpected text after ...")
+			}
+		case p.pos < len(p.src) && p.marker() != "---":
+			return nil, p.errorf(p.pos, "unexpected %q", p.lineRest())
+		}
+		docs = append(docs, n)
+	}
+}
+
+// an error if the current position is indented with a tab, which YAML
+// doesn't allow: the only thing before it on its line is space, and
+// that includes a tab
+func (p *parser) tabIndent() error {
+	lineStart := strings.LastIndexByte(p.src[:p.pos], '\n') + 1
+	indent := p.src[lineStart:p.pos]
+	if strings.Trim(indent, " \t") != "" {
+		return nil
+	}
+	if i := strings.IndexByte(indent, '\t'); i >= 0 {
+		return p.errorf(lineStart+i, "tabs can't be used for indentation")
+	}
+	return nil
+}
+
+// the rest of the current line, for error messages
+func (p *parser) lineRest() string {
+	end := strings.IndexByte(p.src[p.pos:], '\n')
+	if end < 0 {
+		return p.src[p.pos:]
+	}
+	return p.src[p.pos : p.pos+end]
+}
+
+// parse a node in block context, starting on the current line after a
+// "key:", a "- " or a "---", or at the start of a document.  a node on
+// the lines below has to be indented more than indent, or as much for
+// a sequence if seqOK, as after a "key:"; if there is none the node is
+// null.
+func (p *parser) block(indent int, seqOK bool) (*node, error) {
+	start := p.pos
+	p.skipInline()
+	anchor, tag, err := p.props(false)
+	if err != nil {
+		return nil, err
+	}
+	var n *node
+	// a block collection can start on the line of a "- " or "---", but
+	// not on that of the key it is the value of
+	nested := !seqOK
+	if p.eol() {
+		p.skipLines()
+		c := p.col()
+		if p.pos >= len(p.src) || p.marker() != "" || c < indent || c == indent && !(seqOK && p.dash()) {
+			n = &node{kind: scalarNode, pos: start}
+			return p.finish(n, anchor, tag)
+		}
+		nested = true
+	}
+	if err := p.tabIndent(); err != nil {
+		return nil, err
+	}
+	if p.peek() == '*' && anchor+tag != "" {
+		return nil, p.errorf(p.pos, "an alias can't have an anchor or tag")
+	}
+	if n, err = p.inline(indent, nested); err != nil {
+		return nil, err
+	}
+	return p.finish(n, anchor, tag)
+}
+
+// give n the anchor and tag found before it
+func (p *parser) finish(n *node, anchor, tag string) (*node, error) {
+	if tag != "" {
+		n.tag = tag
+	}
+	if anchor != "" {
+		p.anchors[anchor] = n
+	}
+	return n, nil
+}
+
+// parse the anchor and tag, in either order, that may come before a
+// node
+func (p *parser) props(flow bool) (anchor, tag string, err error) {
+	for {
+		start := p.pos
+		switch p.peek() {
+		case '&':
+			p.pos++
+			if anchor = p.name(flow); anchor == "" {
+				return "", "", p.errorf(start, "anchor without a name")
+			}
+		case '!':
+			tag = p.name(flow)
+		default:
+			return anchor, tag, nil
+		}
+		if flow {
+			p.skipFlow()
+		} else {
+			p.skipInline()
+		}
+	}
+}
+
+// read an anchor name or tag
+func (p *parser) name(flow bool) string {
+	start := p.pos
+	for p.pos < len(p.src) && !isBreakSpace(p.src[p.pos]) &&
+		!(flow && strings.IndexByte(",[]{}", p.src[p.pos]) >= 0) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// parse a node that starts at the current position, in block context.
+// nested is false if a block mapping or sequence can't start here.
+func (p *parser) inline(indent int, nested bool) (*node, error) {
+	c, start := p.col(), p.pos
+	switch ch := p.peek(); {
+	case p.dash():
+		if !nested {
+			return nil, p.errorf(start, "a block sequence can't start on the line of its key")
+		}
+		return p.sequence(c)
+	case ch == '|' || ch == '>':
+		return p.blockScalar(indent)
+	case ch == '?' && blank(p.at(1)):
+		return nil, p.errorf(start, "complex mapping keys aren't supported")
+	}
+	alias := p.peek() == '*'
+	n, err := p.scalar(false)
+	if err != nil {
+		return nil, err
+	}
+	p.skipInline()
+	if p.peek() == ':' && blank(p.at(1)) {
+		if n.kind != scalarNode {
+			return nil, p.errorf(start, "complex mapping keys aren't supported")
+		}
+		if !nested {
+			return nil, p.errorf(start, "a block mapping can't start on the line of its key")
+		}
+		return p.mapping(c, n)
+	}
+	if !p.eol() {
+		return nil, p.errorf(p.pos, "unexpected %q", p.lineRest())
+	}
+	if n.kind == scalarNode && n.style == 0 && !alias {
+		p.continuePlain(n, indent)
+	}
+	return n, nil
+}
+
+// parse a flow collection, a quoted scalar, an alias or a plain scalar
+func (p *parser) scalar(flow bool) (*node, error) {
+	start := p.pos
+	switch p.peek() {
+	case '[':
+		return p.flowSeq()
+	case '{':
+		return p.flowMap()
+	case '"':
+		return p.doubleQuoted()
+	case '\'':
+		return p.singleQuoted()
+	case '*':
+		p.pos++
+		name := p.name(flow)
+		n, ok := p.anchors[name]
+		if !ok {
+			return nil, p.errorf(start, "unknown anchor %q", name)
+		}
+		return n, nil
+	}
+	text := p.plain(flow)
+	if text == "" {
+		return nil, p.errorf(start, "expected a value")
+	}
+	return &node{kind: scalarNode, text: text, pos: start}, nil
+}
+
+// read a plain scalar up to the end of the line, a ": " or a " #", and
+// in flow context a flow indicator
+func (p *parser) plain(flow bool) string {
+	start := p.pos
+	for ; p.pos < len(p.src); p.pos++ {
+		c := p.src[p.pos]
+		if c == '\n' ||
+			c == ':' && (blank(p.at(1)) || flow && strings.IndexByte(",[]{}", p.at(1)) >= 0) ||
+			c == '#' && p.pos > start && isBreakSpace(p.src[p.pos-1]) ||
+			flow && strings.IndexByte(",[]{}", c) >= 0 {
+			break
+		}
+	}
+	return strings.TrimRight(p.src[start:p.pos], " \t\r")
+}
+
+// add the lines that continue the plain scalar n, those indented more
+// than indent, folding the line breaks between them
+func (p *parser) continuePlain(n *node, indent int) {
+	for {
+		save, breaks := p.pos, 0
+		for {
+			for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t' || p.src[p.pos] == '\r') {
+				p.pos++
+			}
+			if p.pos >= len(p.src) || p.src[p.pos] != '\n' {
+				break
+			}
+			p.pos++
+			breaks++
+		}
+		if breaks == 0 || p.pos >= len(p.src) || p.col() <= indent || p.peek() == '#' || p.marker() != "" {
+			p.pos = save
+			return
+		}
+		text := p.plain(false)
+		if text == "" || p.peek() == ':' {
+			// a mapping entry, which is an error left to the caller
+			p.pos = save
+			return
+		}
+		if breaks == 1 {
+			n.text += " "
+		} else {
+			n.text += strings.Repeat("\n", breaks-1)
+		}
+		n.text += text
+		p.skipInline()
+	}
+}
+
+// parse a block mapping whose entries are at column col, the first of
+// which has key key; the current position is at its colon
+func (p *parser) mapping(col int, key *node) (*node, error) {
+	m := &node{kind: mapNode, pos: key.pos}
+	for {
+		p.pos++
+		val, err := p.block(col, true)
+		if err != nil {
+			return nil, err
+		}
+		m.items = append(m.items, key, val)
+		p.skipLines()
+		if p.pos >= len(p.src) || p.marker() != "" || p.col() < col {
+			return m, nil
+		}
+		if err := p.tabIndent(); err != nil {
+			return nil, err
+		}
+		if p.col() > col {
+			return nil, p.errorf(p.pos, "bad indentation of a mapping entry")
+		}
+		start := p.pos
+		switch ch := p.peek(); {
+		case ch == '?' && blank(p.at(1)), ch == '[', ch == '{':
+			return nil, p.errorf(start, "complex mapping keys aren't supported")
+		case p.dash():
+			return nil, p.errorf(start, "expected a mapping key, not a sequence entry")
+		}
+		if key, err = p.scalar(false); err != nil {
+			return nil, err
+		}
+		p.skipInline()
+		if p.peek() != ':' || !blank(p.at(1)) {
+			return nil, p.errorf(start, "expected a mapping key")
+		}
+	}
+}
+
+// parse a block sequence whose dashes are at column col
+func (p *parser) sequence(col int) (*node, error) {
+	s := &node{kind: seqNode, pos: p.pos}
+	for {
+		p.pos++
+		item, err := p.block(col, false)
+		if err != nil {
+			return nil, err
+		}
+		s.items = append(s.items, item)
+		p.skipLines()
+		if p.pos >= len(p.src) || p.marker() != "" || p.col() < col || p.col() == col && !p.dash() {
+			return s, nil
+		}
+		if err := p.tabIndent(); err != nil {
+			return nil, err
+		}
+		if p.col() > col {
+			return nil, p.errorf(p.pos, "bad indentation of a sequence entry")
+		}
+	}
+}
+
+// parse a | or > block scalar, whose lines are indented more than
+// indent
+func (p *parser) blockScalar(indent int) (*node, error) {
+	start := p.pos
+	style := p.src[p.pos]
+	p.pos++
+	var chomp byte
+	explicit := 0
+	for i := 0; i < 2; i++ {
+		switch c := p.peek(); {
+		case c == '+' || c == '-':
+			chomp = c
+			p.pos++
+		case '1' <= c && c <= '9':
+			explicit = int(c - '0')
+			p.pos++
+		}
+	}
+	p.skipInline()
+	if !p.eol() {
+		return nil, p.errorf(p.pos, "bad block scalar header")
+	}
+	if p.pos < len(p.src) {
+		p.pos++
+	}
+	// the lines, and their lengths with their line breaks
+	var raw []string
+	var size []int
+	for rest := p.src[p.pos:]; rest != ""; {
+		line, more, found := strings.Cut(rest, "\n")
+		raw = append(raw, strings.TrimSuffix(line, "\r"))
+		size = append(size, len(line))
+		if found {
+			size[len(size)-1]++
+		}
+		rest = more
+	}
+	width := indent + explicit
+	if explicit == 0 {
+		// the indentation of the first line that isn't empty
+		width = indent
+		for _, line := range raw {
+			if strings.Trim(line, " ") != "" {
+				width = len(line) - len(strings.TrimLeft(line, " "))
+				break
+			}
+		}
+	}
+	var lines []string
+	if width > indent {
+		for i, line := range raw {
+			spaces := len(line) - len(strings.TrimLeft(line, " "))
+			if spaces < len(line) && (spaces < width || width == 0 && p.marker() != "") {
+				break
+			}
+			lines = append(lines, line[min(spaces, width):])
+			p.pos += size[i]
+		}
+	}
+	// trailing empty lines are kept or not by the chomping indicator
+	trail := 0
+	for len(lines) > 0 && strings.Trim(lines[len(lines)-1], " ") == "" {
+		lines = lines[:len(lines)-1]
+		trail++
+	}
+	var text string
+	if style == '|' {
+		text = strings.Join(lines, "\n")
+	} else {
+		text = fold(lines)
+	}
+	switch {
+	case chomp == '-':
+	case chomp == '+':
+		if len(lines) > 0 {
+			text += "\n"
+		}
+		text += strings.Repeat("\n", trail)
+	case len(lines) > 0:
+		text += "\n"
+	}
+	return &node{kind: scalarNode, style: style, text: text, pos: start}, nil
+}
+
+// the lines of a > block scalar, folded: a line break between two lines
+// of text becomes a space, and empty lines become line breaks, except
+// around lines indented more than the rest
+func fold(lines []string) string {
+	var b strings.Builder
+	breaks, prevMore := 0, false
+	for i, line := range lines {
+		if strings.Trim(line, " ") == "" {
+			breaks++
+			continue
+		}
+		more := line[0] == ' ' || line[0] == '\t'
+		switch {
+		case i == breaks:
+			// the first line of text
+			b.WriteString(strings.Repeat("\n", breaks))
+		case more || prevMore:
+			b.WriteString(strings.Repeat("\n", breaks+1))
+		case breaks == 0:
+			b.WriteByte(' ')
+		default:
+			b.WriteString(strings.Repeat("\n", breaks))
+		}
+		b.WriteString(line)
+		breaks, prevMore = 0, more
+	}
+	return b.String()
+}
+
+// at a line break inside a quoted scalar: drop the space around it and
+// write the break folded, as a space, or as one line break fewer than
+// there are
+func (p *parser) foldBreak(b *strings.Builder) {
+	s := strings.TrimRight(b.String(), " \t\r")
+	b.Reset()
+	b.WriteString(s)
+	breaks := 0
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '\n':
+			breaks++
+		case ' ', '\t', '\r':
+		default:
+			goto done
+		}
+		p.pos++
+	}
+done:
+	if breaks == 1 {
+		b.WriteByte(' ')
+	} else {
+		b.WriteString(strings.Repeat("\n", breaks-1))
+	}
+}
+
+func (p *parser) singleQuoted() (*node, error) {
+	start := p.pos
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == '\'' && p.at(1) == '\'':
+			b.WriteByte('\'')
+			p.pos += 2
+		case c == '\'':
+			p.pos++
+			return &node{kind: scalarNode, style: '\'', text: b.String(), pos: start}, nil
+		case c == '\n':
+			p.foldBreak(&b)
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return nil, p.errorf(start, "unterminated string")
+}
+
+// the characters that follow a backslash in a double-quoted scalar and
+// stand for a single character
+var escapes = map[byte]rune{
+	'0': 0, 'a': '\a', 'b': '\b', 't': '\t', '\t': '\t', 'n': '\n', 'v': '\v',
+	'f': '\f', 'r': '\r', 'e': 0x1b, ' ': ' ', '"': '"', '/': '/', '\\': '\\',
+	'N': 0x85, '_': 0xa0, 'L': 0x2028, 'P': 0x2029,
+}
+
+func (p *parser) doubleQuoted() (*node, error) {
+	start := p.pos
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return &node{kind: scalarNode, style: '"', text: b.String(), pos: start}, nil
+		case c == '\n':
+			p.foldBreak(&b)
+		case c != '\\':
+			b.WriteByte(c)
+			p.pos++
+		case p.at(1) == '\n' || p.at(1) == '\r' && p.at(2) == '\n':
+			// an escaped line break joins the lines without a space
+			p.pos += 2
+			for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+				p.pos++
+			}
+		default:
+			e := p.at(1)
+			if r, ok := escapes[e]; ok {
+				b.WriteRune(r)
+				p.pos += 2
+				continue
+			}
+			digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+			n, err := strconv.ParseUint(p.src[min(p.pos+2, len(p.src)):min(p.pos+2+digits, len(p.src))], 16, 32)
+			if digits == 0 || err != nil || !utf8.ValidRune(rune(n)) {
+				return nil, p.errorf(p.pos, "bad escape in string")
+			}
+			b.WriteRune(rune(n))
+			p.pos += 2 + digits
+		}
+	}
+	return nil, p.errorf(start, "unterminated string")
+}
+
+// a node inside a flow collection, with its anchor and tag
+func (p *parser) flowValue() (*node, error) {
+	anchor, tag, err := p.props(true)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() == '*' && anchor+tag != "" {
+		return nil, p.errorf(p.pos, "an alias can't have an anchor or tag")
+	}
+	if p.peek() == ',' || p.peek() == ']' || p.peek() == '}' {
+		// only properties, on an empty node
+		return p.finish(&node{kind: scalarNode, pos: p.pos}, anchor, tag)
+	}
+	n, err := p.scalar(true)
+	if err != nil {
+		return nil, err
+	}
+	return p.finish(n, anchor, tag)
+}
+
+// parse the value after a colon in a flow collection, up to the , or
+// closing bracket; there may not be one
+func (p *parser) flowPairValue() (*node, error) {
+	p.pos++
+	p.skipFlow()
+	if c := p.peek(); c == ',' || c == ']' || c == '}' {
+		return &node{kind: scalarNode, pos: p.pos}, nil
+	}
+	return p.flowValue()
+}
+
+func (p *parser) flowSeq() (*node, error) {
+	s := &node{kind: seqNode, pos: p.pos}
+	p.pos++
+	for {
+		p.skipFlow()
+		switch p.peek() {
+		case 0:
+			return nil, p.errorf(s.pos, "unterminated flow sequence")
+		case ']':
+			p.pos++
+			return s, nil
+		}
+		item, err := p.flowValue()
+		if err != nil {
+			return nil, err
+		}
+		p.skipFlow()
+		if p.peek() == ':' {
+			// a mapping of a single pair, [a: 1]
+			val, err := p.flowPairValue()
+			if err != nil {
+				return nil, err
+			}
+			item = &node{kind: mapNode, items: []*node{item, val}, pos: item.pos}
+			p.skipFlow()
+		}
+		s.items = append(s.items, item)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		case 0:
+			return nil, p.errorf(s.pos, "unterminated flow sequence")
+		default:
+			return nil, p.errorf(p.pos, "expected , or ] in flow sequence")
+		}
+	}
+}
+
+func (p *parser) flowMap() (*node, error) {
+	m := &node{kind: mapNode, pos: p.pos}
+	p.pos++
+	for {
+		p.skipFlow()
+		switch p.peek() {
+		case 0:
+			return nil, p.errorf(m.pos, "unterminated flow mapping")
+		case '}':
+			p.pos++
+			return m, nil
+		}
+		key, err := p.flowValue()
+		if err != nil {
+			return nil, err
+		}
+		p.skipFlow()
+		val := &node{kind: scalarNode, pos: p.pos}
+		if p.peek() == ':' {
+			if val, err = p.flowPairValue(); err != nil {
+				return nil, err
+			}
+			p.skipFlow()
+		}
+		m.items = append(m.items, key, val)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+		case 0:
+			return nil, p.errorf(m.pos, "unterminated flow mapping")
+		default:
+			return nil, p.errorf(p.pos, "expected , or } in flow mapping")
+		}
+	}
+}
+
+/*
+   conversion
+*/
+
+// the forms of the document n
+func (p *parser) document(n *node) (*sexpr.Sexpr, error) {
+	var elems []*sexpr.Sexpr
+	var err error
+	switch {
+	case n.kind == mapNode:
+		elems, err = p.entries(n)
+	case n.kind == seqNode:
+		for _, item := range n.items {
+			el, err := p.elem(item)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, el)
+		}
+	case !isNull(n):
+		elems = []*sexpr.Sexpr{atom(n)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sexpr.NewForms(elems...), nil
+}
+
+func isNull(n *node) bool {
+	if n.kind != scalarNode || n.style != 0 || n.tag != "" {
+		return false
+	}
+	switch n.text {
+	case "", "~", "null", "Null", "NULL":
+		return true
+	}
+	return false
+}
+
+// the element for the node n
+func (p *parser) elem(n *node) (*sexpr.Sexpr, error) {
+	switch n.kind {
+	case scalarNode:
+		return atom(n), nil
+	case mapNode:
+		entries, err := p.entries(n)
+		if err != nil {
+			return nil, err
+		}
+		return sexpr.NewList(entries...), nil
+	}
+	elems, tail, err := p.items(n)
+	if err != nil {
+		return nil, err
+	}
+	if tail == nil {
+		return sexpr.NewList(elems...), nil
+	}
+	return sexpr.NewDotted(elems, tail), nil
+}
+
+// the elements of the sequence n, and the tail after a plain . before
+// its last item
+func (p *parser) items(n *node) ([]*sexpr.Sexpr, *sexpr.Sexpr, error) {
+	items := n.items
+	var tail *sexpr.Sexpr
+	if k := len(items); k >= 3 && items[k-2].kind == scalarNode && items[k-2].style == 0 &&
+		items[k-2].tag == "" && items[k-2].text == "." {
+		var err error
+		if tail, err = p.elem(items[k-1]); err != nil {
+			return nil, nil, err
+		}
+		items = items[:k-2]
+	}
+	elems := make([]*sexpr.Sexpr, 0, len(items))
+	for _, item := range items {
+		el, err := p.elem(item)
+		if err != nil {
+			return nil, nil, err
+		}
+		elems = append(elems, el)
+	}
+	return elems, tail, nil
+}
+
+// true for the << key, whose value is merged into the mapping it is in
+func isMerge(n *node) bool {
+	return n.kind == scalarNode && n.style == 0 && n.tag == "" && n.text == "<<"
+}
+
+// the entries of the mapping n.  the entries of mappings merged in with
+// << come where the << is, apart from those whose names the mapping has
+// itself or an earlier merge had.
+func (p *parser) entries(n *node) ([]*sexpr.Sexpr, error) {
+	seen := make(map[string]bool)
+	for i := 0; i < len(n.items); i += 2 {
+		k := n.items[i]
+		if isMerge(k) {
+			continue
+		}
+		if k.kind != scalarNode {
+			return nil, p.errorf(k.pos, "complex mapping keys aren't supported")
+		}
+		name := atom(k).Value()
+		if seen[name] {
+			return nil, p.errorf(k.pos, "duplicate mapping key %s", name)
+		}
+		seen[name] = true
+	}
+	var out []*sexpr.Sexpr
+	for i := 0; i < len(n.items); i += 2 {
+		k, v := n.items[i], n.items[i+1]
+		if !isMerge(k) {
+			e, err := p.entry(k, v)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, e)
+			continue
+		}
+		from := []*node{v}
+		if v.kind == seqNode {
+			from = v.items
+		}
+		for _, m := range from {
+			if m.kind != mapNode {
+				return nil, p.errorf(m.pos, "<< needs a mapping or a sequence of them")
+			}
+			merged, err := p.entries(m)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range merged {
+				if name := e.Children()[0].Value(); !seen[name] {
+					seen[name] = true
+					out = append(out, e)
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// the entry for the key k and value v: (k v) for a scalar, k followed by
+// the elements of a sequence or the entries of a mapping otherwise
+func (p *parser) entry(k, v *node) (*sexpr.Sexpr, error) {
+	name := atom(k)
+	switch v.kind {
+	case scalarNode:
+		return sexpr.NewList(name, atom(v)), nil
+	case mapNode:
+		entries, err := p.entries(v)
+		if err != nil {
+			return nil, err
+		}
+		return sexpr.NewList(append([]*sexpr.Sexpr{name}, entries...)...), nil
+	}
+	elems, tail, err := p.items(v)
+	if err != nil {
+		return nil, err
+	}
+	return sexpr.NewDotted(append([]*sexpr.Sexpr{name}, elems...), tail), nil
+}
+
+// the atom for the scalar n
+func atom(n *node) *sexpr.Sexpr {
+	switch n.tag {
+	case "!!str":
+		return sexpr.NewString(n.text)
+	case "!!binary":
+		// base64, which may be broken over lines; if it doesn't
+		// decode, it is kept as a string
+		text := strings.Join(strings.Fields(n.text), "")
+		if b, err := base64.StdEncoding.DecodeString(text); err == nil {
+			return sexpr.NewBytes(b)
+		}
+		return sexpr.NewString(n.text)
+	case "!sexpr":
+		if bare(n.text) {
+			return sexpr.NewAtom(n.text)
+		}
+		return sexpr.NewString(n.text)
+	}
+	switch n.style {
+	case '"', '|', '>':
+		return sexpr.NewString(n.text)
+	case '\'':
+		// quoting makes a string, but symbols and keywords are quoted
+		// when their plain text would read as something else
+		if bare(n.text) {
+			if k := sexpr.NewAtom(n.text).AtomKind(); k == sexpr.Symbol || k == sexpr.Keyword {
+				return sexpr.NewAtom(n.text)
+			}
+		}
+		return sexpr.NewString(n.text)
+	}
+	switch {
+	case isNull(n):
+		return sexpr.NewAtom("nil")
+	case n.text == "true" || n.text == "True" || n.text == "TRUE":
+		return sexpr.NewAtom("#t")
+	case n.text == "false" || n.text == "False" || n.text == "FALSE":
+		return sexpr.NewAtom("#f")
+	case bare(n.text):
+		return sexpr.NewAtom(n.text)
+	}
+	return sexpr.NewString(n.text)
+}
+
+// true if text is an atom that isn't a string, as the parser would read
+// it
+func bare(text string) bool {
+	s, err := sexpr.Parse(text)
+	return err == nil && s.IsAtom() && s.Value() == text && s.AtomKind() != sexpr.String
+}
@@ -0,0 +1,99 @@
+package yamlconv
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mjsottile/gocode/diag"
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+// the canonical text of each document Decode reads from src
+func decoded(t *testing.T, src string) []string {
+	t.Helper()
+	docs, err := Decode([]byte(src))
+	if err != nil {
+		t.Fatalf("Decode(%q): %v", src, err)
+	}
+	var out []string
+	for _, d := range docs {
+		out = append(out, strings.TrimSpace(string(sexpr.EncodeCanonical(d))))
+	}
+	return out
+}
+
+func TestDecodeScalars(t *testing.T) {
+	tests := []struct {
+		yaml, want string
+	}{
+		{"a: 12", "(a 12)"},
+		{"a: '12'", `(a "12")`},
+		{`a: "12"`, `(a "12")`},
+		{"a: 1.5", "(a 1.5)"},
+		{"a: '1.5'", `(a "1.5")`},
+		{"a: '1/2'", `(a "1/2")`},
+		{"a: true", "(a #t)"},
+		{"a: '#t'", `(a "#t")`},
+		{"a: 'nil'", `(a "nil")`},
+		{"a: null", "(a nil)"},
+		{"a: 'null'", "(a null)"},
+		{"a: 'true'", "(a true)"},
+		{"a: ':key'", "(a :key)"},
+		{"a: 'x y'", `(a "x y")`},
+		{"a: 'it''s'", "(a it's)"},
+		{"a: 'it''s here'", `(a "it's here")`},
+		{`a: '#\('`, `(a "#\\(")`},
+		{`a: !sexpr '#\('`, `(a #\()`},
+		{"a: !sexpr '12'", "(a 12)"},
+		{"a: !!str 12", `(a "12")`},
+		{"a: !!binary YWJj", "(a |YWJj|)"},
+		{"a: some text", `(a "some text")`},
+		{"a: sym", "(a sym)"},
+		{"a: |\n  line\n", `(a "line\n")`},
+		{"a:\tb", "(a b)"},
+		{"- a: b\n  c: d", "((a b) (c d))"},
+		{"- - a\n  - b", "(a b)"},
+		{"a:\n  b: c", "(a (b c))"},
+		{"a:\n- b\n- c", "(a b c)"},
+	}
+	for _, tt := range tests {
+		got := decoded(t, tt.yaml)
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("Decode(%q) = %q, want %s", tt.yaml, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		yaml string
+		line int
+		col  int
+	}{
+		{"a: b: c", 1, 4},
+		{"x: 1\na: b: c\n", 2, 4},
+		{"a: - b", 1, 4},
+		{"a:\n\tb: c", 2, 1},
+		{"a:\n  b: 1\n\tc: 2", 3, 1},
+		{"\ta: 1", 1, 1},
+		{"-\n\t- a", 2, 1},
+		{"a: 'open", 1, 4},
+		{`a: "bad \q"`, 1, 9},
+		{"a: [1, 2", 1, 4},
+		{"a: 1\n b: 2", 2, 2},
+		{"a: *nope", 1, 4},
+		{"a: 1\na: 2", 2, 1},
+	}
+	for _, tt := range tests {
+		_, err := Decode([]byte(tt.yaml))
+		var se *diag.SourceError
+		if !errors.Is(err, ErrSyntax) || !errors.As(err, &se) {
+			t.Errorf("Decode(%q) = %v, want a positioned ErrSyntax", tt.yaml, err)
+			continue
+		}
+		if se.Pos.Line != tt.line || se.Pos.Column != tt.col {
+			t.Errorf("Decode(%q): error at %d:%d, want %d:%d (%v)", tt.yaml, se.Pos.Line, se.Pos.Column, tt.line, tt.col, err)
+		}
+	}
+}
@@ -0,0 +1,460 @@
+/*
+Package yamlconv converts between s-expressions and YAML, so the same
+data can be looked at and edited in whichever of the two is more
+familiar.  documents in the (name value) layout of the schema package
+come out as YAML mappings,
+
+	(host "example.org")                host: "example.org"
+	(port 8443)                         port: 8443
+	(tls #t)                    <->     tls: true
+	(limits (burst 10) (rate 2.5))      limits:
+	                                      burst: 10
+	                                      rate: 2.5
+	(routes "/" "/api")                 routes: ["/", "/api"]
+
+and anything else as sequences.  the rules, which go both ways:
+
+  - a list whose elements are all lists headed by a distinct symbol,
+    keyword or string is a mapping, with one entry per element.  an
+    element (name v) is the entry name: v when v is an atom, and
+    (name v...) otherwise is name followed by v... as a mapping, if
+    they are all entries, or else as a sequence.
+  - any other list is a sequence of its elements.  a dotted list's
+    sequence has a plain . before its tail.
+  - the top-level forms of a document are treated like the elements of
+    a list.
+  - strings are double-quoted; symbols, keywords and numbers are plain,
+    and symbols and keywords single-quoted if plain text would read back
+    as something else; #t and #f are true and false, nil is null, byte
+    strings are !!binary, and characters, which have no plain spelling,
+    are tagged !sexpr, as in !sexpr '#\('.  a string comes back with the
+    same contents, though not always with the same escapes, and a byte
+    string with the same bytes, in base64.
+
+going the other way, plain scalars are read as atoms when they are
+valid atom text and as strings otherwise, so hand-written YAML like
+name: some text needs no quotes.  quoted scalars are strings, except
+that single-quoted symbols and keywords stay symbols and keywords, so
+'12' and '#t' are strings but 'true' is the symbol true.  null, ~ and
+empty values are nil, true and false are booleans, !!str makes any
+scalar a string, !!binary base64 is a byte string, and !sexpr text is
+the atom the text spells.
+
+Decode reads every document of a YAML stream, with block and flow
+styles, quoted and block scalars, anchors and aliases, and << merge
+keys.  complex keys (?) and tags other than !!str, !!binary and !sexpr
+aren't supported, and are rejected or ignored.  tabs can't indent, and
+a block mapping or sequence can't start on the line of the key it is
+the value of, as YAML has it.  Encode writes one YAML
+document per forms chain, and can write repeated subtrees once, as
+anchors.
+*/
+package yamlconv
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+// Options controls Encode.  the zero value writes every subtree in full.
+type Options struct {
+	// write a mapping or sequence that occurs more than once in a
+	// document in full the first time only, with an anchor, and as an
+	// alias to it after that
+	Anchors bool
+}
+
+// the column a sequence of atoms has to fit in to be written [a, b]
+const flowWidth = 80
+
+// Encode writes docs to w as a YAML stream, one document per forms
+// chain (an element and the ones following it, like the result of
+// Parse), separated by ---.
+func Encode(w io.Writer, opts Options, docs ...*sexpr.Sexpr) error {
+	e := &encoder{opts: opts}
+	for i, d := range docs {
+		if i > 0 {
+			e.b.WriteString("---\n")
+		}
+		if err := e.document(d); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, e.b.String())
+	return err
+}
+
+type encoder struct {
+	opts    Options
+	b       strings.Builder
+	counts  map[string]int    // how often each collection occurs
+	anchors map[string]string // anchors written so far
+}
+
+func (e *encoder) document(forms *sexpr.Sexpr) error {
+	var elems []*sexpr.Sexpr
+	for cur := forms; cur != nil; cur = cur.Next() {
+		elems = append(elems, cur)
+	}
+	if len(elems) == 0 {
+		e.b.WriteString("[]\n")
+		return nil
+	}
+	e.counts, e.anchors = nil, nil
+	if e.opts.Anchors {
+		e.counts = make(map[string]int)
+		e.count(elems, nil)
+	}
+	return e.collection(elems, nil, false, 0, 0)
+}
+
+// an entry is a proper list headed by a symbol, keyword or string
+func isEntry(s *sexpr.Sexpr) bool {
+	if !s.IsList() || s.Tail() != nil {
+		return false
+	}
+	kids := s.Children()
+	if len(kids) == 0 {
+		return false
+	}
+	switch kids[0].AtomKind() {
+	case sexpr.Symbol, sexpr.Keyword, sexpr.String:
+		return true
+	}
+	return false
+}
+
+// true if elems are written as a mapping: all entries, with distinct
+// names
+func isMapping(elems []*sexpr.Sexpr, tail *sexpr.Sexpr) bool {
+	if len(elems) == 0 || tail != nil {
+		return false
+	}
+	seen := make(map[string]bool)
+	for _, el := range elems {
+		if !isEntry(el) {
+			return false
+		}
+		name := el.Children()[0].Value()
+		if seen[name] {
+			return false
+		}
+		seen[name] = true
+	}
+	return true
+}
+
+// the text identifying the collection of elems and tail, for anchors
+func key(elems []*sexpr.Sexpr, tail *sexpr.Sexpr) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for i, el := range elems {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(el.Text())
+	}
+	if tail != nil {
+		b.WriteString(" . ")
+		b.WriteString(tail.Text())
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// count the collections in elems (and tail), in the order they will be
+// written, without looking inside ones seen before: those are written
+// as aliases
+func (e *encoder) count(elems []*sexpr.Sexpr, tail *sexpr.Sexpr) {
+	visit := func(elems []*sexpr.Sexpr, tail *sexpr.Sexpr) {
+		if len(elems) == 0 {
+			return
+		}
+		k := key(elems, tail)
+		e.counts[k]++
+		if e.counts[k] == 1 {
+			e.count(elems, tail)
+		}
+	}
+	if isMapping(elems, tail) {
+		for _, el := range elems {
+			if vals := el.Children()[1:]; len(vals) != 1 || !vals[0].IsAtom() {
+				visit(vals, nil)
+			}
+		}
+		return
+	}
+	for _, el := range append(elems[:len(elems):len(elems)], tail) {
+		if el.IsList() {
+			visit(el.Children(), el.Tail())
+		}
+	}
+}
+
+// the anchor or alias to write before the collection of elems and tail,
+// and whether it is an alias, which is all there is to write
+func (e *encoder) anchor(elems []*sexpr.Sexpr, tail *sexpr.Sexpr) (string, bool) {
+	if e.counts == nil || len(elems) == 0 {
+		return "", false
+	}
+	k := key(elems, tail)
+	if name, ok := e.anchors[k]; ok {
+		return "*" + name, true
+	}
+	if e.counts[k] < 2 {
+		return "", false
+	}
+	if e.anchors == nil {
+		e.anchors = make(map[string]string)
+	}
+	name := fmt.Sprintf("a%d", len(e.anchors)+1)
+	e.anchors[k] = name
+	return "&" + name, false
+}
+
+// write the collection of elems and tail, as a mapping at column mapCol
+// or a sequence with its dashes at column seqCol.  inline means the
+// first line has been started (by a "- ") and the collection begins on
+// it; otherwise the current line is finished first, if need be.
+func (e *encoder) collection(elems []*sexpr.Sexpr, tail *sexpr.Sexpr, inline bool, mapCol, seqCol int) error {
+	line := func(i, col int) {
+		if i > 0 || !inline {
+			e.b.WriteString(strings.Repeat(" ", col))
+		}
+	}
+	if isMapping(elems, tail) {
+		for i, el := range elems {
+			kids := el.Children()
+			line(i, mapCol)
+			name, err := scalar(kids[0])
+			if err != nil {
+				return err
+			}
+			e.b.WriteString(name)
+			e.b.WriteByte(':')
+			if err := e.value(kids[1:], mapCol); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	items := elems
+	if tail != nil {
+		items = append(append(items[:len(items):len(items)], sexpr.NewAtom(".")), tail)
+	}
+	for i, el := range items {
+		line(i, seqCol)
+		e.b.WriteString("-")
+		if tail != nil && i == len(items)-2 {
+			// the dot, which scalar would quote
+			e.b.WriteString(" .\n")
+			continue
+		}
+		if err := e.item(el, seqCol+2); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write the values of an entry at column col, after its name and colon
+func (e *encoder) value(vals []*sexpr.Sexpr, col int) error {
+	if len(vals) == 1 && vals[0].IsAtom() {
+		text, err := scalar(vals[0])
+		if err != nil {
+			return err
+		}
+		e.b.WriteString(" " + text + "\n")
+		return nil
+	}
+	mark, alias := e.anchor(vals, nil)
+	if mark != "" {
+		e.b.WriteString(" " + mark)
+	}
+	if alias {
+		e.b.WriteByte('\n')
+		return nil
+	}
+	if text, ok := flow(vals, nil, col+len(mark)+2); ok {
+		e.b.WriteString(" " + text + "\n")
+		return nil
+	}
+	e.b.WriteByte('\n')
+	return e.collection(vals, nil, false, col+2, col)
+}
+
+// write an element of a sequence after its "-", with its contents at
+// column col
+func (e *encoder) item(el *sexpr.Sexpr, col int) error {
+	if el.IsAtom() {
+		text, err := scalar(el)
+		if err != nil {
+			return err
+		}
+		e.b.WriteString(" " + text + "\n")
+		return nil
+	}
+	elems, tail := el.Children(), el.Tail()
+	mark, alias := e.anchor(elems, tail)
+	if mark != "" {
+		e.b.WriteString(" " + mark)
+	}
+	if alias {
+		e.b.WriteByte('\n')
+		return nil
+	}
+	if text, ok := flow(elems, tail, col+len(mark)); ok {
+		e.b.WriteString(" " + text + "\n")
+		return nil
+	}
+	if mark != "" {
+		// an anchored collection starts on the line after it
+		e.b.WriteByte('\n')
+		return e.collection(elems, tail, false, col, col)
+	}
+	e.b.WriteByte(' ')
+	return e.collection(elems, tail, true, col, col)
+}
+
+// elems and tail as a flow sequence, [a, b], if they are all atoms and
+// it fits after column col
+func flow(elems []*sexpr.Sexpr, tail *sexpr.Sexpr, col int) (string, bool) {
+	if len(elems) == 0 {
+		return "[]", true
+	}
+	if isMapping(elems, tail) {
+		return "", false
+	}
+	parts := make([]string, 0, len(elems)+2)
+	for _, el := range elems {
+		text, err := scalar(el)
+		if !el.IsAtom() || err != nil {
+			return "", false
+		}
+		parts = append(parts, text)
+	}
+	if tail != nil {
+		text, err := scalar(tail)
+		if !tail.IsAtom() || err != nil {
+			return "", false
+		}
+		parts = append(parts, ".", text)
+	}
+	text := "[" + strings.Join(parts, ", ") + "]"
+	if col+1+utf8.RuneCountInString(text) > flowWidth {
+		return "", false
+	}
+	return text, true
+}
+
+// the YAML for the atom s
+func scalar(s *sexpr.Sexpr) (string, error) {
+	switch s.AtomKind() {
+	case sexpr.String:
+		text, err := s.Str()
+		if err != nil {
+			return "", err
+		}
+		return doubleQuote(text), nil
+	case sexpr.Boolean:
+		if b, _ := s.Bool(); b {
+			return "true", nil
+		}
+		return "false", nil
+	case sexpr.Nil:
+		return "null", nil
+	case sexpr.Bytes:
+		b, _ := s.Bytes()
+		if len(b) == 0 {
+			return `!!binary ""`, nil
+		}
+		return "!!binary " + base64.StdEncoding.EncodeToString(b), nil
+	}
+	text := s.Value()
+	if plainOK(text) {
+		return text, nil
+	}
+	// '' is the only escape; a line break is written as an empty line
+	quoted := "'" + strings.NewReplacer("'", "''", "\n", "\n\n").Replace(text) + "'"
+	if k := s.AtomKind(); k != sexpr.Symbol && k != sexpr.Keyword {
+		// quoted, anything else reads back as a string
+		return "!sexpr " + quoted, nil
+	}
+	return quoted, nil
+}
+
+// true if text can be written as a plain scalar and read back, by this
+// package and by other YAML readers, as the same text
+func plainOK(text string) bool {
+	if text == "" || text == "." || text == "<<" || isSpecial(text) ||
+		strings.IndexByte(",[]{}#&*!|>'\"%@`", text[0]) >= 0 {
+		return false
+	}
+	if strings.IndexByte("-?:", text[0]) >= 0 && (len(text) == 1 || isBreakSpace(text[1])) {
+		return false
+	}
+	for i, r := range text {
+		switch {
+		case r == ',' || r == '[' || r == ']' || r == '{' || r == '}':
+			return false
+		case r == ':' && (i+1 == len(text) || isBreakSpace(text[i+1])):
+			return false
+		case r == '#' && i > 0 && isBreakSpace(text[i-1]):
+			return false
+		case !unicode.IsPrint(r) || r == ' ':
+			return false
+		}
+	}
+	return true
+}
+
+// the plain scalars YAML readers take for booleans or null, including
+// the YAML 1.1 ones, which some readers still use
+func isSpecial(text string) bool {
+	switch strings.ToLower(text) {
+	case "true", "false", "null", "~", "yes", "no", "on", "off", "y", "n":
+		return true
+	}
+	return false
+}
+
+func isBreakSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// text as a double-quoted scalar
+func doubleQuote(text string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range text {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == 0:
+			b.WriteString(`\0`)
+		case !unicode.IsPrint(r) && r != ' ':
+			if r > 0xffff {
+				fmt.Fprintf(&b, `\U%08x`, r)
+			} else {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
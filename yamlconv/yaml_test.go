@@ -0,0 +1,90 @@
+package yamlconv
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/mjsottile/gocode/sexpr"
+)
+
+func parse(t *testing.T, src string) *sexpr.Sexpr {
+	t.Helper()
+	forms, err := sexpr.ParseAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sexpr.NewForms(forms...)
+}
+
+// the example in the package comment, both ways
+func TestExample(t *testing.T) {
+	doc := parse(t, `(host "example.org")
+(port 8443)
+(tls #t)
+(limits (burst 10) (rate 2.5))
+(routes "/" "/api")`)
+	want := `host: "example.org"
+port: 8443
+tls: true
+limits:
+  burst: 10
+  rate: 2.5
+routes: ["/", "/api"]
+`
+	var b bytes.Buffer
+	if err := Encode(&b, Options{}, doc); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimPrefix(b.String(), "---\n"); got != want {
+		t.Errorf("Encode gave\n%s\nwant\n%s", got, want)
+	}
+	docs, err := Decode([]byte(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 || !sexpr.EqualForms(docs[0], doc) {
+		t.Errorf("Decode gave %v", docs)
+	}
+}
+
+// documents come back Equal from YAML, with or without anchors, several
+// to a stream
+func TestRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(10))
+	for i := 0; i < 3000; i++ {
+		docs := []*sexpr.Sexpr{sexpr.Random(r, 20)}
+		for r.Intn(3) == 0 {
+			docs = append(docs, sexpr.Random(r, 20))
+		}
+		// repeat a subtree, for anchors to find
+		repeated := false
+		if kids := docs[0].Children(); len(kids) > 0 {
+			text := kids[0].Text()
+			docs = append(docs, parse(t, "("+text+" "+text+")"))
+			repeated = !kids[0].IsAtom() && len(kids[0].Children()) > 0
+		}
+		opts := Options{Anchors: r.Intn(2) == 0}
+		var b bytes.Buffer
+		if err := Encode(&b, opts, docs...); err != nil {
+			t.Fatal(err)
+		}
+		if opts.Anchors && repeated && !strings.Contains(b.String(), "*") {
+			t.Errorf("no alias in\n%s", b.String())
+		}
+		got, err := Decode(b.Bytes())
+		if err != nil {
+			t.Fatalf("Decode(%q): %v", b.String(), err)
+		}
+		if len(got) != len(docs) {
+			t.Fatalf("%q decoded to %d documents, want %d", b.String(), len(got), len(docs))
+		}
+		for j := range docs {
+			if !sexpr.EqualForms(got[j], docs[j]) {
+				t.Fatalf("%q: document %d decoded to %s, want %s", b.String(), j,
+					sexpr.EncodeCanonical(got[j]), sexpr.EncodeCanonical(docs[j]))
+			}
+		}
+	}
+}